@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+  Получение сведений из расширения сертификата Authority Information Access (RFC5280, 4.2.2.1):
+  URL OCSP сервера (id-ad-ocsp) и URL сертификата издателя (id-ad-caIssuers).
+*/
+
+// максимальный размер загружаемого по caIssuers ответа (сертификат или PKCS#7 certs-only)
+const aiaMaxResponseSize int64 = 65536 // байт
+
+// таймаут загрузки сертификата издателя по caIssuers, если таймаут цели мониторинга не задан
+const aiaDefaultTimeout = 10 * time.Second
+
+// aiaDiscoveryError - ошибка загрузки сертификата издателя по AIA при проверке. Считается сетевой
+// ошибкой проверки (см. runProbe): загрузка повторяется при следующей проверке.
+type aiaDiscoveryError struct {
+	err error
+}
+
+func (e *aiaDiscoveryError) Error() string {
+	return fmt.Sprintf("issuer certificate discovery: [%s]", e.err.Error())
+}
+
+func (e *aiaDiscoveryError) Unwrap() error {
+	return e.err
+}
+
+// aiaIssuerDiscovery загружает сертификат издателя сертификата по AIA при проверках, а не при загрузке
+// конфигурации: недоступность caIssuers URL не мешает запуску приложения, загрузка повторяется при каждой
+// проверке до первой успешной. Объект общий для копий конфигурации цели мониторинга.
+type aiaIssuerDiscovery struct {
+	// блокировка удерживается на время загрузки и установки сертификата издателя в конфигурации
+	mu sync.Mutex
+
+	cert    *x509.Certificate
+	timeout time.Duration
+
+	// загруженный сертификат издателя и URL, по которому он загружен (nil, если еще не загружен)
+	issuer *x509.Certificate
+	url    string
+}
+
+// newAIAIssuerDiscovery создает объект загрузки сертификата издателя сертификата cert с таймаутом timeout
+// (aiaDefaultTimeout, если timeout не больше 0).
+func newAIAIssuerDiscovery(cert *x509.Certificate, timeout time.Duration) *aiaIssuerDiscovery {
+	if timeout <= 0 {
+		timeout = aiaDefaultTimeout
+	}
+	return &aiaIssuerDiscovery{cert: cert, timeout: timeout}
+}
+
+// fetch загружает сертификат издателя, если он еще не загружен. Загрузка прерывается при отмене ctx.
+// Вызывается при удерживаемой блокировке mu. Ошибка загрузки возвращается как *aiaDiscoveryError.
+func (d *aiaIssuerDiscovery) fetch(ctx context.Context) error {
+	if d.issuer != nil {
+		return nil
+	}
+	issuer, u, err := aiaFetchIssuer(ctx, d.cert, d.timeout)
+	if err != nil {
+		return &aiaDiscoveryError{err}
+	}
+	d.issuer, d.url = issuer, u
+	getAppContext().Logger.Log().Str("subject", d.cert.Subject.String()).Str("issuerUrl", u).
+		Msg("issuer certificate discovered from AIA")
+	return nil
+}
+
+// reject отбрасывает загруженный сертификат издателя, который не удалось установить в конфигурации,
+// и возвращает ошибку err как *aiaDiscoveryError: сертификат загружается повторно при следующей проверке.
+// Вызывается при удерживаемой блокировке mu.
+func (d *aiaIssuerDiscovery) reject(err error) error {
+	d.issuer, d.url = nil, ""
+	return &aiaDiscoveryError{err}
+}
+
+// aiaHTTPURL возвращает первый URL с протоколом http(s) из списка urls (пустая строка, если таких нет).
+func aiaHTTPURL(urls []string) string {
+	for _, u := range urls {
+		if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+			return u
+		}
+	}
+	return ""
+}
+
+// aiaFetchIssuer загружает сертификат издателя сертификата cert по URL-ам caIssuers расширения AIA.
+// URL-ы перебираются по порядку до первого загруженного сертификата, которым выпущен cert.
+// Загрузка прерывается при отмене ctx.
+//
+// Возвращает сертификат издателя и URL, по которому он был загружен.
+func aiaFetchIssuer(ctx context.Context, cert *x509.Certificate, timeout time.Duration) (*x509.Certificate, string, error) {
+	if len(cert.IssuingCertificateURL) == 0 {
+		return nil, "", errors.New("certificate has no caIssuers URL in AIA extension")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{},
+		Timeout:   timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	var errs []error
+	for _, u := range cert.IssuingCertificateURL {
+		issuer, err := aiaFetchIssuerFrom(ctx, client, u, cert)
+		if err == nil {
+			return issuer, u, nil
+		}
+		errs = append(errs, fmt.Errorf("[%s]: [%w]", u, err))
+	}
+	return nil, "", fmt.Errorf("failed to fetch issuer certificate: [%w]", errors.Join(errs...))
+}
+
+// aiaFetchIssuerFrom загружает по URL u сертификат(-ы) и ищет среди них издателя сертификата cert.
+func aiaFetchIssuerFrom(ctx context.Context, client *http.Client, u string, cert *x509.Certificate) (*x509.Certificate, error) {
+	if aiaHTTPURL([]string{u}) == "" {
+		return nil, errors.New("unsupported URL scheme")
+	}
+
+	nr, err := sendRequest(ctx, client, http.MethodGet, u, "", aiaMaxResponseSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	if nr.StatusCode < http.StatusOK || nr.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("invalid HTTP status code: [%d]: [%s]", nr.StatusCode, http.StatusText(nr.StatusCode))
+	}
+
+	certs, err := aiaParseCertificates(nr.Body)
+	if err != nil {
+		return nil, err
+	}
+	for _, issuer := range certs {
+		if verifyIssuedBy(cert, issuer) == nil {
+			return issuer, nil
+		}
+	}
+	return nil, errors.New("issuer certificate not found")
+}
+
+// aiaParseCertificates разбирает сертификаты, загруженные по caIssuers URL. Поддерживаются
+// сертификат в ASN.1 DER или PEM и PKCS#7 certs-only (CMS SignedData без подписей, RFC5280 4.2.2.1).
+func aiaParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("invalid certificate PEM header: [%s]", block.Type)
+		}
+		data = block.Bytes
+	}
+
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+
+	var contentInfo cmsEncapsulatedContentInfoSigned
+	if _, err := asn1.Unmarshal(data, &contentInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate or PKCS#7 certs-only: [%w]", err)
+	}
+	if !contentInfo.ContentType.Equal(oidTSPCmsSignedData) {
+		return nil, fmt.Errorf("invalid PKCS#7 content type: [%s]", contentInfo.ContentType.String())
+	}
+	return cmsCertificates(&contentInfo.Content)
+}
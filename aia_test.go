@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOCSPCertResolveIssuer(t *testing.T) {
+	issuer, issuerKey := testCA(t, "test CA")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(issuer.Raw)
+	}))
+	defer srv.Close()
+
+	template := testResponderTemplate()
+	template.IssuingCertificateURL = []string{srv.URL}
+	cert, _ := testIssueCert(t, template, issuer, issuerKey)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		digestOID asn1.ObjectIdentifier
+		wantErr   bool
+	}{
+		{name: "canceled", ctx: canceled, digestOID: oidDigestSHA1, wantErr: true},
+		// сертификат издателя загружен, но хеши издателя не вычисляются - загрузка повторяется
+		{name: "unsupported digest", ctx: context.Background(), digestOID: asn1.ObjectIdentifier{1, 2, 3}, wantErr: true},
+		{name: "resolved", ctx: context.Background(), digestOID: oidDigestSHA1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := &ocspCertConfig{CertName: "test", Certificate: cert, discovery: newAIAIssuerDiscovery(cert, time.Second)}
+
+			err := cc.resolveIssuer(tt.ctx, tt.digestOID)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("resolveIssuer: %v", err)
+				}
+				if cc.IssuerCertificate == nil || !cc.IssuerCertificate.Equal(issuer) || cc.IssuerURL != srv.URL {
+					t.Errorf("issuer = %v, issuer URL = %q, want [%s], %q", cc.IssuerCertificate, cc.IssuerURL, issuer.Subject, srv.URL)
+				}
+				return
+			}
+
+			var discoveryError *aiaDiscoveryError
+			if !errors.As(err, &discoveryError) {
+				t.Fatalf("resolveIssuer error = %v, want *aiaDiscoveryError", err)
+			}
+			if tt.ctx.Err() != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("resolveIssuer error = %v, want context canceled", err)
+			}
+			if cc.IssuerCertificate != nil || cc.discovery.issuer != nil {
+				t.Error("issuer certificate is set after error")
+			}
+		})
+	}
+}
+
+// TestRunProbeDiscoveryCanceled проверяет, что проверка, загрузка сертификата издателя которой прервана
+// отменой контекста, не учитывается.
+func TestRunProbeDiscoveryCanceled(t *testing.T) {
+	maxSize := defaultCRLMaxResponseSize
+	cfg := &crlConfig{Name: "test", URL: "http://127.0.0.1:1/test.crl", MaxResponseSize: &maxSize}
+	cfg.issuerDiscovery = newAIAIssuerDiscovery(&x509.Certificate{IssuingCertificateURL: []string{"http://127.0.0.1:1/ca.der"}}, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := runProbe(ctx, &crlProber{cfg, false, &crlState{}}, &http.Client{}, nil, false, nil)
+	if err != nil {
+		t.Fatalf("runProbe: %v", err)
+	}
+	if !result.Canceled {
+		t.Errorf("Canceled = false, want true (error type %q: %v)", result.ErrorType, result.Err)
+	}
+}
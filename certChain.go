@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+/*
+  Построение цепочки сертификатов до доверенного сертификата (trust anchor). Стандартная проверка
+  x509.Certificate.Verify не поддерживает алгоритмы ГОСТ, поэтому цепочка строится самостоятельно:
+  подписи проверяются verifyIssuedBy (см. signature.go, gostSignature.go).
+*/
+
+// Причины ошибок проверки цепочки сертификатов (метка reason метрики response_error_reasons)
+const (
+	certChainReasonIssuerNotFound = "chain_issuer_not_found" // не найден сертификат издателя
+	certChainReasonSignature      = "chain_signature"        // подпись сертификата не подтверждается ключом издателя
+	certChainReasonNotCA          = "chain_not_ca"           // сертификат издателя не является сертификатом CA
+	certChainReasonExpired        = "chain_expired"          // срок действия сертификата цепочки истек или не наступил
+	certChainReasonTooLong        = "chain_too_long"         // превышена максимальная длина цепочки
+	certChainReasonUntrusted      = "chain_untrusted"        // цепочка заканчивается недоверенным корневым сертификатом
+)
+
+// certChainMaxDepth определяет максимальное количество сертификатов издателей в цепочке.
+const certChainMaxDepth = 8
+
+// certChainBuild строит цепочку от сертификата cert до одного из доверенных сертификатов anchors.
+// Сертификаты издателей ищутся среди anchors и промежуточных сертификатов intermediates (например,
+// вложенных в CMS). Для каждого сертификата цепочки проверяется срок действия на момент checkTime,
+// для сертификатов издателей - признак CA.
+//
+// Возвращает цепочку, начиная с cert и заканчивая доверенным сертификатом. Ошибка создается
+// newValidationErrorReason с типом responseErrorSignature и причиной certChainReason*.
+func certChainBuild(cert *x509.Certificate, intermediates, anchors []*x509.Certificate, checkTime time.Time) ([]*x509.Certificate, error) {
+	chain := []*x509.Certificate{cert}
+	current := cert
+	for range certChainMaxDepth + 1 {
+		if checkTime.Before(current.NotBefore) || checkTime.After(current.NotAfter) {
+			return chain, newValidationErrorReason(responseErrorSignature, certChainReasonExpired,
+				fmt.Errorf("certificate is not valid at [%s]: [%s], validity [%s - %s]", checkTime.UTC().Format(time.RFC3339),
+					current.Subject.String(), current.NotBefore.UTC().Format(time.RFC3339), current.NotAfter.UTC().Format(time.RFC3339)))
+		}
+
+		// дошли до доверенного сертификата
+		if certChainContains(anchors, current) {
+			return chain, nil
+		}
+		if bytes.Equal(current.RawIssuer, current.RawSubject) && verifyIssuedBy(current, current) == nil {
+			return chain, newValidationErrorReason(responseErrorSignature, certChainReasonUntrusted,
+				fmt.Errorf("untrusted root certificate: [%s]", current.Subject.String()))
+		}
+		if len(chain) > certChainMaxDepth {
+			break
+		}
+
+		issuer, err := certChainFindIssuer(current, anchors, intermediates)
+		if err != nil {
+			return chain, err
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+	return chain, newValidationErrorReason(responseErrorSignature, certChainReasonTooLong,
+		fmt.Errorf("certificate chain is longer than [%d]: [%s]", certChainMaxDepth, cert.Subject.String()))
+}
+
+// certChainFindIssuer ищет сертификат издателя cert сначала среди доверенных сертификатов anchors,
+// затем среди intermediates. Кандидатами считаются сертификаты с именем субъекта, равным имени издателя
+// cert. Выбирается первый кандидат, подпись которым подтверждается и который является CA.
+func certChainFindIssuer(cert *x509.Certificate, anchors, intermediates []*x509.Certificate) (*x509.Certificate, error) {
+	var lastError error
+	for _, candidates := range [][]*x509.Certificate{anchors, intermediates} {
+		for _, issuer := range candidates {
+			if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) || bytes.Equal(cert.Raw, issuer.Raw) {
+				continue
+			}
+			if err := verifyIssuedBy(cert, issuer); err != nil {
+				lastError = newValidationErrorReason(responseErrorSignature, certChainReasonSignature,
+					fmt.Errorf("certificate [%s]: [%w]", cert.Subject.String(), err))
+				continue
+			}
+			if !issuer.BasicConstraintsValid || !issuer.IsCA {
+				lastError = newValidationErrorReason(responseErrorSignature, certChainReasonNotCA,
+					fmt.Errorf("issuer certificate is not CA: [%s]", issuer.Subject.String()))
+				continue
+			}
+			return issuer, nil
+		}
+	}
+	if lastError != nil {
+		return nil, lastError
+	}
+	return nil, newValidationErrorReason(responseErrorSignature, certChainReasonIssuerNotFound,
+		fmt.Errorf("issuer certificate not found: [%s], issuer [%s]", cert.Subject.String(), cert.Issuer.String()))
+}
+
+// certChainContains проверяет наличие сертификата cert в certs.
+func certChainContains(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if bytes.Equal(c.Raw, cert.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// certChainSubjects возвращает имена субъектов сертификатов цепочки chain (для протокола).
+func certChainSubjects(chain []*x509.Certificate) []string {
+	out := make([]string, 0, len(chain))
+	for _, cert := range chain {
+		out = append(out, cert.Subject.String())
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+  Контроль срока действия сертификатов: проверяемых OCSP сертификатов, сертификатов OCSP серверов
+  и сертификатов подписи TSA.
+*/
+
+// Роли сертификатов (метка role метрики cert_not_after_seconds)
+const (
+	certRoleOCSPCert      = "ocsp_cert"
+	certRoleOCSPResponder = "ocsp_responder"
+	certRoleTSA           = "tsa"
+)
+
+// certExpiryParseThresholds разбирает список порогов предупреждений об истечении срока действия
+// сертификатов, разделенных запятыми (например, "720h,168h,24h"). Нулевые пороги игнорируются.
+// Возвращает пороги без повторов в порядке убывания (пустой список - предупреждения не выводятся).
+func certExpiryParseThresholds(list string) ([]time.Duration, error) {
+	var out []time.Duration
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		threshold, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+		if threshold < 0 {
+			return nil, fmt.Errorf("negative threshold: [%s]", item)
+		}
+		if threshold > 0 && !slices.Contains(out, threshold) {
+			out = append(out, threshold)
+		}
+	}
+	slices.Sort(out)
+	slices.Reverse(out)
+	return out, nil
+}
+
+// certExpiryLevel возвращает количество пройденных порогов thresholds (в порядке убывания) для сертификата,
+// срок действия которого истекает через left. Для истекшего сертификата возвращает len(thresholds)+1.
+func certExpiryLevel(left time.Duration, thresholds []time.Duration) int {
+	if left <= 0 {
+		return len(thresholds) + 1
+	}
+	level := 0
+	for _, threshold := range thresholds {
+		if left < threshold {
+			level++
+		}
+	}
+	return level
+}
+
+// certExpiryWarning возвращает предупреждение, если срок действия сертификата cert с ролью role
+// истекает (NotAfter) менее чем через наибольший из порогов thresholds относительно now или уже истек.
+// Возвращает пустую строку, если предупреждать не о чем или порогов нет.
+func certExpiryWarning(role string, cert *x509.Certificate, thresholds []time.Duration, now time.Time) string {
+	if cert == nil || len(thresholds) == 0 {
+		return ""
+	}
+	left := cert.NotAfter.Sub(now)
+	switch {
+	case left <= 0:
+		return fmt.Sprintf("%s certificate [%s] expired: [%s]", role, cert.Subject.String(), cert.NotAfter.UTC().Format(time.RFC3339))
+	case left < thresholds[0]:
+		return fmt.Sprintf("%s certificate [%s] expires in [%s]: [%s]", role, cert.Subject.String(), left.Round(time.Second), cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return ""
+}
+
+// certExpiryCheck учитывает в метриках mt срок действия сертификатов certs с ролью role цели мониторинга
+// target и дописывает в warnings предупреждения об истекающих сертификатах (см. certExpiryWarning).
+// О прохождении каждого из порогов thresholds (и об истечении срока действия) однократно пишется
+// предупреждение в протокол приложения (см. certExpiryTracker).
+func certExpiryCheck(mt *metrics, target, role string, certs []*x509.Certificate, thresholds []time.Duration, warnings []string) []string {
+	mt.CertNotAfter(target, role, certs...)
+	now := time.Now()
+	for _, cert := range certs {
+		if w := certExpiryWarning(role, cert, thresholds, now); w != "" {
+			warnings = append(warnings, w)
+		}
+		getAppContext().CertExpiry.check(target, role, cert, thresholds, now)
+	}
+	return warnings
+}
+
+// certExpiryTracker запоминает пройденные пороги предупреждений об истечении срока действия сертификатов,
+// чтобы писать в протокол приложения только прохождение очередного порога. Методы безопасны для вызова
+// из разных goroutine-н и для nil объекта (в протокол ничего не пишется).
+type certExpiryTracker struct {
+	mu sync.Mutex
+	// количество пройденных порогов по цели мониторинга, роли и серийному номеру сертификата
+	levels map[string]int
+}
+
+// newCertExpiryTracker создает объект учета пройденных порогов.
+func newCertExpiryTracker() *certExpiryTracker {
+	return &certExpiryTracker{levels: make(map[string]int)}
+}
+
+// check определяет количество пройденных порогов thresholds для сертификата cert с ролью role цели
+// мониторинга target на момент now и, если с прошлой проверки пройден новый порог или истек срок действия
+// сертификата, пишет предупреждение в протокол приложения.
+func (t *certExpiryTracker) check(target, role string, cert *x509.Certificate, thresholds []time.Duration, now time.Time) {
+	if t == nil || cert == nil || len(thresholds) == 0 {
+		return
+	}
+	left := cert.NotAfter.Sub(now)
+	level := certExpiryLevel(left, thresholds)
+	key := target + "/" + role + "/" + cert.SerialNumber.Text(16)
+
+	t.mu.Lock()
+	lastLevel := t.levels[key]
+	t.levels[key] = level
+	t.mu.Unlock()
+
+	if level <= lastLevel {
+		return
+	}
+	le := getAppContext().Logger.Warn().
+		Str("target", target).Str("role", role).
+		Str("subject", cert.Subject.String()).Str("serial", cert.SerialNumber.Text(16)).
+		Time("notAfter", cert.NotAfter)
+	if level > len(thresholds) {
+		le.Msg("certificate expired")
+		return
+	}
+	le.Dur("threshold", thresholds[level-1]).Dur("left", left.Round(time.Second)).Msg("certificate expires soon")
+}
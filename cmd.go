@@ -20,7 +20,18 @@ gathering succeed/failed request count.
 Failed request are partitioned on types:
   - "net" - network related errors (HTTP timeout, disconnects, etc...);
   - "format" - received requests failed to parse (not ASN.1/wrong ASN.1);
-  - "contents" - request succeeds to parse, but contains unexpected contents (wrong status, not expected nonce, etc...).
+  - "contents" - request succeeds to parse, but contains unexpected contents (wrong status, not expected nonce, etc...);
+  - "signature" - response signature verification failed.
+
+Validation errors may be further detailed by reason (e.g. certificate chain or CRL freshness errors).
+
+Config file may contain a list of named targets for each protocol (one monitor per target).
+Command line flags "ocsp.*", "tsp.*", "http.*" and "crl.*" are applied to all targets of the protocol.
+CRL monitoring is disabled unless config file contains "crl" section or "crl.*" flags are given.
+
+Config file may also define probe modules (section "modules"). Metrics server then serves
+"/probe?module=<name>&target=<url>" endpoint running a single probe with module settings
+and returning its metrics (blackbox_exporter style).
 
 Command line flags:
 `)
@@ -37,32 +48,57 @@ Command line flags:
 	clpMetricsEnabled = flag.Bool("metrics.enabled", false, "flag allows to enable metrics monitoring via HTTP (Prometheus)")
 	clpMetricsAddress = flag.String("metrics.address", "", "serve metrics on given [host:port]")
 
+	// конфигурация хранилища доверенных сертификатов
+	clpTrustFiles = flag.String("trust.files", "", "comma separated `list of trusted certificate files` (PEM bundles or DER) shared by all OCSP and TSP targets for certificate chain building")
+	clpTrustDirs  = flag.String("trust.dirs", "", "comma separated `list of trusted certificate directories` (*.pem, *.crt, *.cer, *.der files are loaded)")
+
 	// конфигурация OCSP
-	clpOCSPDisabled        = flag.Bool("ocsp.disabled", false, "flag allows to disable quering OCSP server (true)")
-	clpOCSPURL             = flag.String("ocsp.url", "", "OCSP server URL")
-	clpOCSPTimeout         = flag.String("ocsp.timeout", "", "network timeout for OCSP server (empty string - no timeout)")
-	clpOCSPDigestOID       = flag.String("ocsp.digestoid", "", "digest OID used to create OCSP CertID")
-	clpOCSPNameDigest      = flag.String("ocsp.namedigest", "", "base64 encoded digest value of queried certificate issuer name")
-	clpOCSPKeyDigest       = flag.String("ocsp.keydigest", "", "base64 encoded digest value of queried certificate issuer public key")
-	clpOCSPCert            = flag.String("ocsp.cert", "", "base64 encoded certificate to query OCSP status (here - ASN.1 DER in BASE64)")
-	clpOCSPCertFile        = flag.String("ocsp.certfile", "", "`path to certificate file` whose status is required to ask. Certificate file is loaded only if `cert` is empty (including config)")
-	clpOCSPNonceSize       = flag.Int("ocsp.noncesize", defaultOCSPNonceSize, "OCSP nonce (randomly generated data) size (in bytes, 0 - do not use)")
-	clpOCSPRetryCount      = flag.Int("ocsp.retrycount", 0, "number of times to send OCSP request with retryinterval timeout between them (0 - endless)")
-	clpOCSPRetryInterval   = flag.String("ocsp.retryinterval", defaultOCSPRetryInterval, "timeout between sending two OCSP requests attempts (empty string - no timeout)")
-	clpOCSPMaxResponseSize = flag.Int64("ocsp.maxresponsesize", defaultOCSPMaxResponseSize, "maximum size of OCSP server response (bytes)")
+	clpOCSPDisabled          = flag.Bool("ocsp.disabled", false, "flag allows to disable quering OCSP server (true)")
+	clpOCSPURL               = flag.String("ocsp.url", "", "OCSP server URL (empty - taken from certificate AIA extension)")
+	clpOCSPTimeout           = flag.String("ocsp.timeout", "", "network timeout for OCSP server (empty string - no timeout)")
+	clpOCSPMethod            = flag.String("ocsp.method", defaultOCSPMethod, "OCSP request method: get, post or both (RFC6960 Appendix A.1)")
+	clpOCSPKind              = flag.String("ocsp.kind", defaultOCSPKind, "OCSP probe kind: status (certificate status), unknownserial (random serial, expects unknown or revoked) or malformed (truncated request, expects malformedRequest)")
+	clpOCSPDigestOID         = flag.String("ocsp.digestoid", "", "digest OID used to create OCSP CertID")
+	clpOCSPNameDigest        = flag.String("ocsp.namedigest", "", "base64 encoded digest value of queried certificate issuer name")
+	clpOCSPKeyDigest         = flag.String("ocsp.keydigest", "", "base64 encoded digest value of queried certificate issuer public key")
+	clpOCSPCert              = flag.String("ocsp.cert", "", "base64 encoded certificate to query OCSP status (here - ASN.1 DER in BASE64)")
+	clpOCSPCertFile          = flag.String("ocsp.certfile", "", "`path to certificate file` whose status is required to ask. Certificate file is loaded only if `cert` is empty (including config)")
+	clpOCSPIssuerCert        = flag.String("ocsp.issuercert", "", "base64 encoded issuer certificate of queried certificate used to compute CertID name and key digests (here - ASN.1 DER in BASE64). If neither issuer nor digests are given, issuer is downloaded from certificate AIA caIssuers URL")
+	clpOCSPIssuerCertFile    = flag.String("ocsp.issuercertfile", "", "`path to issuer certificate file` of queried certificate. Loaded only if `issuercert` is empty (including config)")
+	clpOCSPResponderCert     = flag.String("ocsp.respondercert", "", "base64 encoded pinned OCSP responder certificate used to verify response signature (here - ASN.1 DER in BASE64)")
+	clpOCSPResponderCertFile = flag.String("ocsp.respondercertfile", "", "`path to pinned OCSP responder certificate file`. Loaded only if `respondercert` is empty (including config)")
+	clpOCSPRequestorCert     = flag.String("ocsp.requestorcert", "", "base64 encoded certificate used to sign OCSP requests (here - ASN.1 DER in BASE64). Requests are signed only if requestor certificate and key are given")
+	clpOCSPRequestorCertFile = flag.String("ocsp.requestorcertfile", "", "`path to requestor certificate file` used to sign OCSP requests. Loaded only if `requestorcert` is empty (including config)")
+	clpOCSPRequestorKeyFile  = flag.String("ocsp.requestorkeyfile", "", "`path to requestor private key file` (RSA or ECDSA; PKCS#8, PKCS#1 or SEC1 in PEM or PKCS#8 DER)")
+	clpOCSPExpectedStatus    = flag.String("ocsp.expectedstatus", defaultOCSPExpectedStatus, "expected OCSP certificate status: good, revoked or unknown (mismatch is reported as contents error)")
+	clpOCSPMaxProducedAtAge  = flag.String("ocsp.maxproducedatage", "", "maximum age of OCSP response producedAt (empty string - do not check)")
+	clpOCSPMaxThisUpdateAge  = flag.String("ocsp.maxthisupdateage", "", "maximum age of OCSP response thisUpdate (empty string - do not check)")
+	clpOCSPNonceSize         = flag.Int("ocsp.noncesize", defaultOCSPNonceSize, "OCSP nonce (randomly generated data) size (in bytes, 0 - do not use)")
+	clpOCSPRetryCount        = flag.Int("ocsp.retrycount", 0, "number of times to send OCSP request with retryinterval timeout between them (0 - endless)")
+	clpOCSPRetryInterval     = flag.String("ocsp.retryinterval", defaultOCSPRetryInterval, "timeout between sending two OCSP requests attempts (empty string - no timeout)")
+	clpOCSPCertExpiryWarning = flag.String("ocsp.certexpirywarning", defaultOCSPCertExpiryWarning, "comma separated `list of thresholds` (e.g. 720h,168h,24h): crossing of each threshold by queried or OCSP responder certificate expiry is logged at warn level (0 - no warnings)")
+	clpOCSPTrustFile         = flag.String("ocsp.trustfile", "", "`path to trusted certificates file` (PEM bundle or DER) used in addition to trust store to build OCSP responder certificate chain")
+	clpOCSPCRLCheck          = flag.Bool("ocsp.crlcheck", false, "flag enables cross-check of queried certificate statuses against CRL from certificate CRL distribution point (mismatch is reported as contents error with reason revocation_mismatch)")
+	clpOCSPCRLGracePeriod    = flag.String("ocsp.crlgraceperiod", defaultOCSPCRLGracePeriod, "allowed revocation propagation delay between OCSP and CRL for CRL cross-check")
+	clpOCSPCRLTimeout        = flag.String("ocsp.crltimeout", defaultOCSPCRLTimeout, "network timeout for CRL download for CRL cross-check")
+	clpOCSPMaxResponseSize   = flag.Int64("ocsp.maxresponsesize", defaultOCSPMaxResponseSize, "maximum size of OCSP server response (bytes)")
 
 	// конфигурация TSP
-	clpTSPDisabled        = flag.Bool("tsp.disabled", false, "flag allows to disable quering TSP server (true)")
-	clpTSPURL             = flag.String("tsp.url", "", "TSP server URL")
-	clpTSPTimeout         = flag.String("tsp.timeout", "", "network timeout for TSP server (empty string - no timeout)")
-	clpTSPDigestOID       = flag.String("tsp.digestoid", "", "digest OID used to digest TSP timestamp-ed data (here MessageImprint.HashAlgorithm)")
-	clpTSPPolicyOID       = flag.String("tsp.policyoid", "", "policy OID under which TSP timestamp must be created")
-	clpTSPDigest          = flag.String("tsp.digest", "", "base64 encoded TSP timestamp-ed digest value. This or `tsp.digestsize` parameters must be given (here value of MessageImprint.HashedMessage)")
-	clpTSPDigestSize      = flag.Int("tsp.digestsize", 0, "digest size of algorithm used to digest TSP timestamp-ed data. If `tsp.digest` is empty then random data of given size is generated and used to create TSP MessageImprint")
-	clpTSPNonceSize       = flag.Int("tsp.noncesize", defaultTSPNonceSize, "TSP nonce (randomly generated data) size (in bytes, 0 - do not use)")
-	clpTSPRetryCount      = flag.Int("tsp.retrycount", 0, "number of times to send TSP request with retryinterval timeout between them (0 - endless)")
-	clpTSPRetryInterval   = flag.String("tsp.retryinterval", defaultTSPRetryInterval, "timeout between sending two TSP requests attempts (empty string - no timeout)")
-	clpTSPMaxResponseSize = flag.Int64("tsp.maxresponsesize", defaultTSPMaxResponseSize, "maximum size of TSP server response (bytes)")
+	clpTSPDisabled          = flag.Bool("tsp.disabled", false, "flag allows to disable quering TSP server (true)")
+	clpTSPURL               = flag.String("tsp.url", "", "TSP server URL")
+	clpTSPTimeout           = flag.String("tsp.timeout", "", "network timeout for TSP server (empty string - no timeout)")
+	clpTSPKind              = flag.String("tsp.kind", defaultTSPKind, "TSP probe kind: timestamp (request timestamp), badpolicy (unsupported policy, expects unacceptedPolicy), baddigestsize (digest size mismatch, expects badDataFormat) or badalg (unknown digest algorithm, expects badAlg)")
+	clpTSPDigestOID         = flag.String("tsp.digestoid", "", "digest OID used to digest TSP timestamp-ed data (here MessageImprint.HashAlgorithm)")
+	clpTSPPolicyOID         = flag.String("tsp.policyoid", "", "policy OID under which TSP timestamp must be created")
+	clpTSPDigest            = flag.String("tsp.digest", "", "base64 encoded TSP timestamp-ed digest value. This or `tsp.digestsize` parameters must be given (here value of MessageImprint.HashedMessage)")
+	clpTSPDigestSize        = flag.Int("tsp.digestsize", 0, "digest size of algorithm used to digest TSP timestamp-ed data. If `tsp.digest` is empty then random data of given size is generated and used to create TSP MessageImprint")
+	clpTSPNonceSize         = flag.Int("tsp.noncesize", defaultTSPNonceSize, "TSP nonce (randomly generated data) size (in bytes, 0 - do not use)")
+	clpTSPRetryCount        = flag.Int("tsp.retrycount", 0, "number of times to send TSP request with retryinterval timeout between them (0 - endless)")
+	clpTSPRetryInterval     = flag.String("tsp.retryinterval", defaultTSPRetryInterval, "timeout between sending two TSP requests attempts (empty string - no timeout)")
+	clpTSPMaxClockSkew      = flag.String("tsp.maxclockskew", "", "maximum TSA clock skew (TSTInfo.genTime vs local time) in addition to declared accuracy and half of round trip (empty string - do not check)")
+	clpTSPCertExpiryWarning = flag.String("tsp.certexpirywarning", defaultTSPCertExpiryWarning, "comma separated `list of thresholds` (e.g. 720h,168h,24h): crossing of each threshold by TSA signing certificate expiry is logged at warn level (0 - no warnings)")
+	clpTSPTrustFile         = flag.String("tsp.trustfile", "", "`path to trusted certificates file` (PEM bundle or DER) used in addition to trust store to build TSA signing certificate chain")
+	clpTSPMaxResponseSize   = flag.Int64("tsp.maxresponsesize", defaultTSPMaxResponseSize, "maximum size of TSP server response (bytes)")
 
 	// конфигурация HTTP
 	clpHTTPDisabled        = flag.Bool("http.disabled", false, "flag allows to disable quering HTTP server (true)")
@@ -71,4 +107,19 @@ Command line flags:
 	clpHTTPRetryCount      = flag.Int("http.retrycount", 0, "number of times to send HTTP request with retryinterval timeout between them (0 - endless)")
 	clpHTTPRetryInterval   = flag.String("http.retryinterval", defaultHTTPRetryInterval, "timeout between sending two HTTP requests attempts (empty string - no timeout)")
 	clpHTTPMaxResponseSize = flag.Int64("http.maxresponsesize", defaultHTTPMaxResponseSize, "maximum size of HTTP server response (bytes)")
+
+	// конфигурация CRL
+	clpCRLDisabled         = flag.Bool("crl.disabled", false, "flag allows to disable downloading CRL (true)")
+	clpCRLURL              = flag.String("crl.url", "", "CRL URL (empty - taken from certificate CRL distribution points extension)")
+	clpCRLDelta            = flag.Bool("crl.delta", false, "flag enables downloading and validation of delta CRL (separate monitor with \"_delta\" target name suffix)")
+	clpCRLDeltaURL         = flag.String("crl.deltaurl", "", "delta CRL URL (empty - taken from certificate freshest CRL extension)")
+	clpCRLCert             = flag.String("crl.cert", "", "base64 encoded certificate used to discover CRL, delta CRL and CRL issuer URLs (here - ASN.1 DER in BASE64)")
+	clpCRLCertFile         = flag.String("crl.certfile", "", "`path to certificate file` used to discover CRL URLs. Loaded only if `cert` is empty (including config)")
+	clpCRLIssuerCert       = flag.String("crl.issuercert", "", "base64 encoded CRL issuer certificate used to verify CRL signature (here - ASN.1 DER in BASE64). If not given, issuer is downloaded from certificate AIA caIssuers URL or searched in trust store")
+	clpCRLIssuerCertFile   = flag.String("crl.issuercertfile", "", "`path to CRL issuer certificate file`. Loaded only if `issuercert` is empty (including config)")
+	clpCRLTimeout          = flag.String("crl.timeout", "", "network timeout for CRL download (empty string - no timeout)")
+	clpCRLMaxThisUpdateAge = flag.String("crl.maxthisupdateage", "", "maximum age of CRL thisUpdate (empty string - do not check)")
+	clpCRLRetryCount       = flag.Int("crl.retrycount", 0, "number of times to download CRL with retryinterval timeout between them (0 - endless)")
+	clpCRLRetryInterval    = flag.String("crl.retryinterval", defaultCRLRetryInterval, "timeout between two CRL downloads (empty string - no timeout)")
+	clpCRLMaxResponseSize  = flag.Int64("crl.maxresponsesize", defaultCRLMaxResponseSize, "maximum size of CRL (bytes)")
 )
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+/*
+  Проверка подписи CMS SignedData (RFC5652), используемой в TSP TimeStampToken.
+*/
+
+// Определение OID-ов алгоритмов открытого ключа, которые могут быть указаны в
+// SignerInfo.SignatureAlgorithm вместо алгоритма подписи (алгоритм хеширования в этом
+// случае определяется SignerInfo.DigestAlgorithm).
+var (
+	oidPublicKeyRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	oidPublicKeyGostR341001      = asn1.ObjectIdentifier{1, 2, 643, 2, 2, 19}
+	oidPublicKeyGostR34102012256 = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 1, 1}
+	oidPublicKeyGostR34102012512 = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 1, 2}
+)
+
+// cmsSignatureAlgorithm возвращает алгоритм подписи для SignerInfo с учетом того, что в поле
+// SignatureAlgorithm может быть указан только алгоритм открытого ключа.
+func cmsSignatureAlgorithm(signerInfo *cmsSignerInfo) pkix.AlgorithmIdentifier {
+	digestOID := signerInfo.DigestAlgorithm.Algorithm
+	switch {
+	case signerInfo.SignatureAlgorithm.Algorithm.Equal(oidPublicKeyRSA):
+		for _, candidate := range []struct{ digest, signature asn1.ObjectIdentifier }{
+			{oidDigestSHA1, oidSignatureSHA1WithRSA},
+			{oidDigestSHA256, oidSignatureSHA256WithRSA},
+			{oidDigestSHA384, oidSignatureSHA384WithRSA},
+			{oidDigestSHA512, oidSignatureSHA512WithRSA},
+		} {
+			if digestOID.Equal(candidate.digest) {
+				return pkix.AlgorithmIdentifier{Algorithm: candidate.signature}
+			}
+		}
+	case signerInfo.SignatureAlgorithm.Algorithm.Equal(oidPublicKeyECDSA):
+		for _, candidate := range []struct{ digest, signature asn1.ObjectIdentifier }{
+			{oidDigestSHA1, oidSignatureECDSAWithSHA1},
+			{oidDigestSHA256, oidSignatureECDSAWithSHA256},
+			{oidDigestSHA384, oidSignatureECDSAWithSHA384},
+			{oidDigestSHA512, oidSignatureECDSAWithSHA512},
+		} {
+			if digestOID.Equal(candidate.digest) {
+				return pkix.AlgorithmIdentifier{Algorithm: candidate.signature}
+			}
+		}
+	case signerInfo.SignatureAlgorithm.Algorithm.Equal(oidPublicKeyGostR341001),
+		signerInfo.SignatureAlgorithm.Algorithm.Equal(oidPublicKeyGostR34102012256),
+		signerInfo.SignatureAlgorithm.Algorithm.Equal(oidPublicKeyGostR34102012512):
+		if gostAlg := gostSignatureAlgorithmByDigest(digestOID); gostAlg != nil {
+			return pkix.AlgorithmIdentifier{Algorithm: gostAlg.oid}
+		}
+	}
+	return signerInfo.SignatureAlgorithm
+}
+
+// cmsCertificates разбирает сертификаты из поля Certificates CMS SignedData.
+// Элементы CertificateChoices, отличные от Certificate, пропускаются.
+func cmsCertificates(signedData *cmsSignedData) ([]*x509.Certificate, error) {
+	out := make([]*x509.Certificate, 0, len(signedData.Certificates))
+	for i := range signedData.Certificates {
+		if signedData.Certificates[i].Class != asn1.ClassUniversal || signedData.Certificates[i].Tag != asn1.TagSequence {
+			continue
+		}
+		cert, err := x509.ParseCertificate(signedData.Certificates[i].FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CMS certificate: [%d], [%w]", i, err)
+		}
+		out = append(out, cert)
+	}
+	return out, nil
+}
+
+// cmsFindSigner ищет среди certs сертификат, соответствующий SignerIdentifier.
+func cmsFindSigner(signerInfo *cmsSignerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	sid := signerInfo.RawSignerIdentifier
+	switch {
+	case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+		var ias cmsIssuerAndSerialNumber
+		if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("failed to decode CMS IssuerAndSerialNumber: [%w]", err)
+		}
+		for _, cert := range certs {
+			if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+				return cert, nil
+			}
+		}
+
+	case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+		for _, cert := range certs {
+			if len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported CMS SignerIdentifier: class [%d], tag [%d]", sid.Class, sid.Tag)
+	}
+	return nil, errors.New("CMS signer certificate not found")
+}
+
+// cmsSignedAttributes декодирует подписываемые атрибуты SignerInfo и возвращает их вместе с
+// ASN.1 DER, над которым вычисляется подпись (SET OF вместо [0] IMPLICIT).
+func cmsSignedAttributes(signerInfo *cmsSignerInfo) ([]cmsAttribute, []byte, error) {
+	if len(signerInfo.SignedAttributes.FullBytes) == 0 {
+		return nil, nil, nil
+	}
+
+	// подпись вычисляется над явным тегом SET OF
+	signed := append([]byte{}, signerInfo.SignedAttributes.FullBytes...)
+	signed[0] = asn1.TagSet | 0x20 // constructed
+
+	var attributes []cmsAttribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attributes, "set"); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode CMS signed attributes: [%w]", err)
+	}
+	return attributes, signed, nil
+}
+
+// cmsAttributeValue возвращает единственное значение атрибута с указанным OID.
+func cmsAttributeValue(attributes []cmsAttribute, oid asn1.ObjectIdentifier) (asn1.RawValue, error) {
+	for i := range attributes {
+		if attributes[i].Type.Equal(oid) {
+			if len(attributes[i].Values) != 1 {
+				return asn1.RawValue{}, fmt.Errorf("single value of CMS attribute expected: [%s], [%d]", oid.String(), len(attributes[i].Values))
+			}
+			return attributes[i].Values[0], nil
+		}
+	}
+	return asn1.RawValue{}, fmt.Errorf("CMS attribute not found: [%s]", oid.String())
+}
+
+// cmsVerify проверяет подпись signerInfo над вложенными данными signedData (RFC5652, раздел 5.6):
+//   - ищет сертификат подписанта в signedData.Certificates по SignerIdentifier;
+//   - при наличии подписываемых атрибутов проверяет атрибут contentType и сравнивает атрибут
+//     messageDigest с хешем EContent, после чего проверяет подпись над DER атрибутов;
+//   - иначе проверяет подпись непосредственно над EContent.
+//
+// Возвращает сертификат подписанта.
+func cmsVerify(signedData *cmsSignedData, signerInfo *cmsSignerInfo) (*x509.Certificate, error) {
+	certs, err := cmsCertificates(signedData)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := cmsFindSigner(signerInfo, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, signed, err := cmsSignedAttributes(signerInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if signed == nil {
+		// подписываемых атрибутов нет - подпись над содержимым
+		signed = signedData.EncapContentInfo.EContent
+	} else {
+		// проверяем тип содержимого
+		value, attrError := cmsAttributeValue(attributes, oidCmsAttributeContentType)
+		if attrError != nil {
+			return nil, attrError
+		}
+		var contentType asn1.ObjectIdentifier
+		if _, decodeError := asn1.Unmarshal(value.FullBytes, &contentType); decodeError != nil {
+			return nil, fmt.Errorf("failed to decode CMS contentType attribute: [%w]", decodeError)
+		}
+		if !contentType.Equal(signedData.EncapContentInfo.EContentType) {
+			return nil, fmt.Errorf("CMS contentType attribute mismatch: [%s], [%s]", contentType.String(), signedData.EncapContentInfo.EContentType.String())
+		}
+
+		// вычисляем хеш содержимого и сравниваем с атрибутом
+		value, attrError = cmsAttributeValue(attributes, oidCmsAttributeMessageDigest)
+		if attrError != nil {
+			return nil, attrError
+		}
+		var messageDigest []byte
+		if _, decodeError := asn1.Unmarshal(value.FullBytes, &messageDigest); decodeError != nil {
+			return nil, fmt.Errorf("failed to decode CMS messageDigest attribute: [%w]", decodeError)
+		}
+		h, digestError := newDigest(signerInfo.DigestAlgorithm.Algorithm)
+		if digestError != nil {
+			return nil, fmt.Errorf("CMS digest: [%w]", digestError)
+		}
+		h.Write(signedData.EncapContentInfo.EContent)
+		if !bytes.Equal(h.Sum(nil), messageDigest) {
+			return nil, errors.New("CMS messageDigest attribute mismatch")
+		}
+	}
+
+	if err = verifySignature(signer, cmsSignatureAlgorithm(signerInfo), signed, signerInfo.Signature); err != nil {
+		return nil, fmt.Errorf("CMS signature verification failed: [%w]", err)
+	}
+	return signer, nil
+}
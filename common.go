@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
@@ -25,18 +28,70 @@ const (
 	protoOCSP protocolType = "ocsp"
 	protoTSP  protocolType = "tsp"
 	protoHTTP protocolType = "http"
+	protoCRL  protocolType = "crl"
 )
 
+// имя цели мониторинга по умолчанию (если в конфигурации указана одна цель без имени)
+const defaultTargetName = "default"
+
 // поддерживаемы типы ошибок
 type responseErrorType string
 
 const (
-	responseErrorNet      responseErrorType = "net"
-	responseErrorHTTP     responseErrorType = "http"
-	responseErrorAsn      responseErrorType = "asn1"
-	responseErrorContents responseErrorType = "contents"
+	responseErrorNet       responseErrorType = "net"
+	responseErrorHTTP      responseErrorType = "http"
+	responseErrorAsn       responseErrorType = "asn1"
+	responseErrorContents  responseErrorType = "contents"
+	responseErrorSignature responseErrorType = "signature"
 )
 
+// validationError определяет ошибку проверки содержимого ответа с типом, отличным от
+// responseErrorContents (например, ошибка проверки подписи), и, возможно, с уточняющей причиной.
+type validationError struct {
+	errorType responseErrorType
+	reason    string
+	err       error
+}
+
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *validationError) Unwrap() error {
+	return e.err
+}
+
+// newValidationError создает ошибку проверки содержимого ответа указанного типа.
+func newValidationError(et responseErrorType, err error) error {
+	return &validationError{errorType: et, err: err}
+}
+
+// newValidationErrorReason создает ошибку проверки содержимого ответа указанного типа с уточняющей
+// причиной reason (метка reason метрики response_error_reasons).
+func newValidationErrorReason(et responseErrorType, reason string, err error) error {
+	return &validationError{errorType: et, reason: reason, err: err}
+}
+
+// validationErrorType возвращает тип ошибки проверки содержимого ответа.
+// Для ошибок, созданных не через newValidationError, возвращает responseErrorContents.
+func validationErrorType(err error) responseErrorType {
+	var ve *validationError
+	if errors.As(err, &ve) {
+		return ve.errorType
+	}
+	return responseErrorContents
+}
+
+// validationErrorReason возвращает уточняющую причину ошибки проверки содержимого ответа.
+// Возвращает пустую строку, если причина не указана.
+func validationErrorReason(err error) string {
+	var ve *validationError
+	if errors.As(err, &ve) {
+		return ve.reason
+	}
+	return ""
+}
+
 // waitForTimeout сервисная функция, позволяющая дождаться таймаута или отмены контекста
 func waitForTimeout(ctx context.Context, timeout time.Duration) {
 	if timeout == 0 || ctx.Err() != nil {
@@ -95,6 +150,45 @@ func oidToAsn(oid string) (asn1.ObjectIdentifier, error) {
 	return asn1.ObjectIdentifier(intIDs), nil
 }
 
+// loadPrivateKey загружает закрытый ключ (RSA или ECDSA) из файла keyFileName.
+// Файл может содержать ключ в PEM (PKCS#8, PKCS#1 RSA или SEC1 EC) или в ASN.1 DER (PKCS#8).
+func loadPrivateKey(keyFileName string) (crypto.Signer, error) {
+	fn := filepath.Clean(keyFileName)
+	derKey, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from keyfile: [%s], [%w]", fn, err)
+	}
+
+	// пытаемся декодировать как PEM, если не получилось - это ASN.1 DER (PKCS#8)
+	keyType := "PRIVATE KEY"
+	if pemblock, _ := pem.Decode(derKey); pemblock != nil {
+		keyType, derKey = pemblock.Type, pemblock.Bytes
+	}
+
+	var key any
+	switch keyType {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(derKey)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(derKey)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(derKey)
+	default:
+		return nil, fmt.Errorf("invalid private key PEM header: [%s]", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: [%w]", err)
+	}
+
+	switch signer := key.(type) {
+	case *rsa.PrivateKey:
+		return signer, nil
+	case *ecdsa.PrivateKey:
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type: [%T]", key)
+}
+
 // loadCertificate позволяет загрузить и разобрать сертификат.
 //
 // Сначала проверяем параметр `cert` - если не пустая строка, то должна содержать ASN.1 DER в base64.
@@ -148,3 +242,51 @@ func loadCertificate(cert, certFileName string) (*x509.Certificate, error) {
 	}
 	return out, nil
 }
+
+// loadCertificates позволяет загрузить и разобрать набор сертификатов из файла certFileName.
+// Файл может содержать один или несколько сертификатов в PEM либо один сертификат в ASN.1 DER.
+// Блоки PEM, отличные от CERTIFICATE, пропускаются.
+func loadCertificates(certFileName string) ([]*x509.Certificate, error) {
+	fn := filepath.Clean(certFileName)
+	fileContents, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from certfile: [%s], [%w]", fn, err)
+	}
+
+	out, err := parseCertificatesPEM(fileContents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: [%w]", fn, err)
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+
+	// PEM блоков сертификатов нет - это ASN.1 DER
+	cert, err := x509.ParseCertificate(fileContents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: [%s], [%w]", fn, err)
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// parseCertificatesPEM разбирает сертификаты из блоков PEM CERTIFICATE данных data (прочие блоки
+// пропускаются). Возвращает пустой список, если блоков сертификатов нет.
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var out []*x509.Certificate
+	rest := data
+	for {
+		var pemblock *pem.Block
+		pemblock, rest = pem.Decode(rest)
+		if pemblock == nil {
+			return out, nil
+		}
+		if pemblock.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(pemblock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: [%d], [%w]", len(out), err)
+		}
+		out = append(out, cert)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -21,12 +23,122 @@ type appConfig struct {
 	Log logConfig `json:"log" yaml:"log"`
 	// Настройки предоставления метрик по HTTP
 	Metrics metricsConfig `json:"metrics" yaml:"metrics"`
-	// Настройки взаимодействия с OCSP сервером
-	OCSP ocspConfig `json:"ocsp,omitempty" yaml:"ocsp,omitempty"`
-	// Настройки взаимодействия с TSP сервером
-	TSP tspConfig `json:"tsp,omitempty" yaml:"tsp,omitempty"`
-	// Настройки взаимодействия с HTTP сервером
-	HTTP httpConfig `json:"http,omitempty" yaml:"http,omitempty"`
+	// Общее хранилище доверенных сертификатов для построения цепочек сертификатов
+	Trust trustConfig `json:"trust" yaml:"trust"`
+	// Настройки взаимодействия с OCSP серверами (список целей)
+	OCSP ocspTargets `json:"ocsp,omitempty" yaml:"ocsp,omitempty"`
+	// Настройки взаимодействия с TSP серверами (список целей)
+	TSP tspTargets `json:"tsp,omitempty" yaml:"tsp,omitempty"`
+	// Настройки взаимодействия с HTTP серверами (список целей)
+	HTTP httpTargets `json:"http,omitempty" yaml:"http,omitempty"`
+	// Настройки загрузки и проверки CRL (список целей)
+	CRL crlTargets `json:"crl,omitempty" yaml:"crl,omitempty"`
+	// Модули проверок, выполняемых по запросу к /probe сервера метрик
+	Modules probeModules `json:"modules,omitempty" yaml:"modules,omitempty"`
+}
+
+// targetConfig определяет общие методы настроек одной цели мониторинга (OCSP, TSP или HTTP сервера).
+type targetConfig interface {
+	SetDefaults()
+	UpdateCommandLine(givenFlags []*flag.Flag)
+	Validate() error
+	TargetName() string
+	SetTargetName(name string)
+}
+
+// ocspTargets определяет список целей мониторинга OCSP.
+type ocspTargets []*ocspConfig
+
+// UnmarshalYAML позволяет указывать в конфигурации как список целей, так и одну секцию (формат предыдущих версий).
+func (t *ocspTargets) UnmarshalYAML(value *yaml.Node) error {
+	return decodeTargetList(value, (*[]*ocspConfig)(t))
+}
+
+// tspTargets определяет список целей мониторинга TSP.
+type tspTargets []*tspConfig
+
+// UnmarshalYAML позволяет указывать в конфигурации как список целей, так и одну секцию (формат предыдущих версий).
+func (t *tspTargets) UnmarshalYAML(value *yaml.Node) error {
+	return decodeTargetList(value, (*[]*tspConfig)(t))
+}
+
+// httpTargets определяет список целей мониторинга HTTP.
+type httpTargets []*httpConfig
+
+// UnmarshalYAML позволяет указывать в конфигурации как список целей, так и одну секцию (формат предыдущих версий).
+func (t *httpTargets) UnmarshalYAML(value *yaml.Node) error {
+	return decodeTargetList(value, (*[]*httpConfig)(t))
+}
+
+// crlTargets определяет список целей мониторинга CRL.
+type crlTargets []*crlConfig
+
+// UnmarshalYAML позволяет указывать в конфигурации как список целей, так и одну секцию.
+func (t *crlTargets) UnmarshalYAML(value *yaml.Node) error {
+	return decodeTargetList(value, (*[]*crlConfig)(t))
+}
+
+// decodeTargetList декодирует список целей мониторинга. Если в конфигурации указана
+// одна секция (mapping), то она считается списком из одной цели.
+//
+// Декодирование выполняется повторно через отдельный декодер, т.к. yaml.Node.Decode
+// не поддерживает проверку неизвестных полей (KnownFields).
+func decodeTargetList(value *yaml.Node, out any) error {
+	switch value.Kind {
+	case yaml.MappingNode:
+		value = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{value}}
+	case yaml.SequenceNode:
+	default:
+		return fmt.Errorf("line %d: targets list or single target section expected", value.Line)
+	}
+
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("line %d: failed to encode targets: [%w]", value.Line, err)
+	}
+	yamlDecoder := yaml.NewDecoder(bytes.NewReader(encoded))
+	yamlDecoder.KnownFields(true)
+	if err = yamlDecoder.Decode(out); err != nil {
+		return fmt.Errorf("line %d: [%w]", value.Line, err)
+	}
+	return nil
+}
+
+// setupTargets устанавливает значения по умолчанию, применяет параметры командной строки
+// и проверяет настройки каждой цели из списка.
+//
+// Если список пуст, то в него добавляется одна цель, созданная newTarget (настройки
+// которой задаются только параметрами командной строки). Параметры командной строки
+// применяются ко всем целям списка.
+//
+// Цели без имени получают имя по умолчанию (только если цель в списке одна), имена
+// целей одного протокола должны быть уникальны.
+func setupTargets[C targetConfig](proto protocolType, targets []C, newTarget func() C, givenFlags []*flag.Flag) ([]C, error) {
+	if len(targets) == 0 {
+		targets = append(targets, newTarget())
+	}
+
+	names := make(map[string]struct{}, len(targets))
+	for i, target := range targets {
+		target.SetDefaults()
+		target.UpdateCommandLine(givenFlags)
+
+		if target.TargetName() == "" {
+			if len(targets) != 1 {
+				return nil, fmt.Errorf("invalid %s config: empty name of target #%d", proto, i+1)
+			}
+			target.SetTargetName(defaultTargetName)
+		}
+		if _, exists := names[target.TargetName()]; exists {
+			return nil, fmt.Errorf("invalid %s config: duplicate target name: [%s]", proto, target.TargetName())
+		}
+		names[target.TargetName()] = struct{}{}
+
+		if validateError := target.Validate(); validateError != nil {
+			return nil, fmt.Errorf("target [%s]: [%w]", target.TargetName(), validateError)
+		}
+	}
+	return targets, nil
 }
 
 // buildConfig создает объект конфигурации, считав настройки из файла и дополнив
@@ -55,8 +167,7 @@ func buildConfig() (*appConfig, error) {
 	// установим параметры по умолчанию
 	out.Log.SetDefaults()
 	out.Metrics.SetDefaults()
-	out.OCSP.SetDefaults()
-	out.TSP.SetDefaults()
+	out.Trust.SetDefaults()
 
 	// обработаем параметры командной строки. Сначала получим их список
 	var givenFlags []*flag.Flag
@@ -67,8 +178,7 @@ func buildConfig() (*appConfig, error) {
 	// затем вызовем функции обновления соответствующих объектов
 	out.Log.UpdateCommandLine(givenFlags)
 	out.Metrics.UpdateCommandLine(givenFlags)
-	out.OCSP.UpdateCommandLine(givenFlags)
-	out.TSP.UpdateCommandLine(givenFlags)
+	out.Trust.UpdateCommandLine(givenFlags)
 
 	// проверим, декодируя переданные параметры в нужный формат
 	if validateError := out.Log.Validate(); validateError != nil {
@@ -77,15 +187,56 @@ func buildConfig() (*appConfig, error) {
 	if validateError := out.Metrics.Validate(); validateError != nil {
 		return nil, validateError
 	}
-	if validateError := out.OCSP.Validate(); validateError != nil {
+	if validateError := out.Trust.Validate(); validateError != nil {
 		return nil, validateError
 	}
-	if validateError := out.TSP.Validate(); validateError != nil {
-		return nil, validateError
+
+	// настройки целей мониторинга обрабатываем для каждой цели отдельно
+	var err error
+	if out.OCSP, err = setupTargets(protoOCSP, out.OCSP, func() *ocspConfig { return &ocspConfig{} }, givenFlags); err != nil {
+		return nil, err
 	}
-	if validateError := out.HTTP.Validate(); validateError != nil {
-		return nil, validateError
+	if out.TSP, err = setupTargets(protoTSP, out.TSP, func() *tspConfig { return &tspConfig{} }, givenFlags); err != nil {
+		return nil, err
+	}
+	if out.HTTP, err = setupTargets(protoHTTP, out.HTTP, func() *httpConfig { return &httpConfig{} }, givenFlags); err != nil {
+		return nil, err
 	}
+	// мониторинг CRL добавлен позже остальных протоколов: без секции crl и параметров crl.* он отключен
+	crlEnabled := len(out.CRL) > 0 || slices.ContainsFunc(givenFlags, func(f *flag.Flag) bool { return strings.HasPrefix(f.Name, "crl.") })
+	if out.CRL, err = setupTargets(protoCRL, out.CRL, func() *crlConfig { return &crlConfig{Disabled: !crlEnabled} }, givenFlags); err != nil {
+		return nil, err
+	}
+	if err = out.Modules.Validate(); err != nil {
+		return nil, err
+	}
+	out.applyTrust()
 
 	return &out, nil
 }
+
+// applyTrust дополняет доверенные сертификаты целей мониторинга OCSP, TSP и CRL (в том числе модулей
+// проверки) сертификатами общего хранилища Trust.
+func (cfg *appConfig) applyTrust() {
+	ocspTargets, tspTargets, crlTargets := cfg.OCSP, cfg.TSP, cfg.CRL
+	for _, m := range cfg.Modules {
+		if m.OCSP != nil {
+			ocspTargets = append(ocspTargets, m.OCSP)
+		}
+		if m.TSP != nil {
+			tspTargets = append(tspTargets, m.TSP)
+		}
+		if m.CRL != nil {
+			crlTargets = append(crlTargets, m.CRL)
+		}
+	}
+	for _, target := range ocspTargets {
+		target.TrustCertificates = trustMerge(cfg.Trust.Certificates, target.TrustCertificates)
+	}
+	for _, target := range tspTargets {
+		target.TrustCertificates = trustMerge(cfg.Trust.Certificates, target.TrustCertificates)
+	}
+	for _, target := range crlTargets {
+		target.TrustCertificates = trustMerge(cfg.Trust.Certificates, target.TrustCertificates)
+	}
+}
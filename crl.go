@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// суффикс имени цели мониторинга для проверки delta CRL
+const crlDeltaTargetSuffix = "_delta"
+
+// Причины ошибок проверки CRL (метка reason метрики response_error_reasons)
+const (
+	crlReasonIssuerNotFound = "crl_issuer_not_found" // не найден сертификат издателя CRL
+	crlReasonIssuerKeyUsage = "crl_issuer_key_usage" // сертификат издателя CRL не допускает подпись CRL
+	crlReasonThisUpdate     = "crl_this_update"      // thisUpdate в будущем или слишком старое
+	crlReasonNextUpdate     = "crl_next_update"      // nextUpdate не указано или уже наступило
+	crlReasonNumber         = "crl_number"           // нет номера CRL или нарушена монотонность номеров
+	crlReasonDelta          = "crl_delta"            // несоответствие вида CRL (полный/delta) или номера базового CRL
+)
+
+// crlState хранит сведения о последних проверенных CRL цели мониторинга (общие для мониторов
+// полного и delta CRL) для контроля монотонности номеров CRL.
+type crlState struct {
+	mu sync.Mutex
+
+	// номер и время выпуска последнего проверенного полного CRL (nil, если CRL еще не проверялся)
+	baseNumber     *big.Int
+	baseThisUpdate time.Time
+
+	// номер и время выпуска последнего проверенного delta CRL
+	deltaNumber     *big.Int
+	deltaThisUpdate time.Time
+}
+
+// crlProber реализует Probe для проверки CRL: загружает полный или delta CRL, проверяет его подпись,
+// актуальность и монотонность номеров.
+type crlProber struct {
+	cfg   *crlConfig
+	delta bool
+	state *crlState
+}
+
+// Protocol возвращает тип проверки.
+func (p *crlProber) Protocol() protocolType {
+	return protoCRL
+}
+
+// Settings возвращает общие настройки проверки.
+func (p *crlProber) Settings() probeSettings {
+	settings := probeSettings{
+		Name:            p.cfg.Name,
+		URL:             p.cfg.URL,
+		Method:          http.MethodGet,
+		Timeout:         p.cfg.TimeoutValue,
+		MaxResponseSize: *p.cfg.MaxResponseSize,
+		RetryCount:      p.cfg.RetryCount,
+		RetryInterval:   p.cfg.RetryIntervalValue,
+	}
+	if p.delta {
+		settings.Name += crlDeltaTargetSuffix
+		settings.URL = p.cfg.DeltaURL
+	}
+	return settings
+}
+
+// NewRequest формирует GET запрос CRL и его проверку. Сертификат издателя CRL, загружаемый по AIA,
+// загружается до запроса CRL (до первой успешной загрузки - при каждой проверке).
+func (p *crlProber) NewRequest(ctx context.Context, _ bool, _ *zerolog.Event) (*probeRequest, error) {
+	if err := p.cfg.resolveIssuer(ctx); err != nil {
+		return nil, err
+	}
+
+	target := p.Settings().Name
+	return &probeRequest{
+		Validate: func(nr *networkResult, mt *metrics, verbose bool, le *zerolog.Event) error {
+			rl, err := crlParse(nr.Body)
+			if err != nil {
+				return newValidationError(responseErrorAsn, err)
+			}
+
+			checkTime := time.Now()
+			crlLog(rl, verbose, le)
+			mt.CRL(target, len(nr.Body), rl, checkTime)
+
+			if validateError := p.validate(rl, checkTime, verbose, le); validateError != nil {
+				return fmt.Errorf("validate CRL: [%w]", validateError)
+			}
+
+			// проверенный полный CRL используется для сверки статусов сертификатов OCSP
+			if !p.delta {
+				getAppContext().CRLCache.Put(p.Settings().URL, rl, checkTime)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// validate проверяет подпись, актуальность, вид и номер CRL rl на момент checkTime.
+func (p *crlProber) validate(rl *x509.RevocationList, checkTime time.Time, verbose bool, le *zerolog.Event) error {
+	// проверяем подпись
+	issuer, err := crlVerifySignature(rl, p.cfg.IssuerCertificate, p.cfg.IssuerURL != "", p.cfg.TrustCertificates, checkTime)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		le.Str("crlSigner", issuer.Subject.String())
+	}
+
+	// проверяем актуальность
+	if rl.ThisUpdate.After(checkTime) {
+		return newValidationErrorReason(responseErrorContents, crlReasonThisUpdate,
+			fmt.Errorf("CRL thisUpdate is in the future: [%s]", rl.ThisUpdate.UTC().Format(time.RFC3339)))
+	}
+	if age := checkTime.Sub(rl.ThisUpdate); p.cfg.MaxThisUpdateAgeValue > 0 && age > p.cfg.MaxThisUpdateAgeValue {
+		return newValidationErrorReason(responseErrorContents, crlReasonThisUpdate,
+			fmt.Errorf("CRL thisUpdate is too old: [%s], max age [%s]", age.Round(time.Second), p.cfg.MaxThisUpdateAgeValue))
+	}
+	if rl.NextUpdate.IsZero() {
+		return newValidationErrorReason(responseErrorContents, crlReasonNextUpdate, errors.New("CRL has no nextUpdate"))
+	}
+	if !rl.NextUpdate.After(checkTime) {
+		return newValidationErrorReason(responseErrorContents, crlReasonNextUpdate,
+			fmt.Errorf("CRL nextUpdate is in the past: [%s]", rl.NextUpdate.UTC().Format(time.RFC3339)))
+	}
+
+	// проверяем вид CRL и номер базового CRL
+	baseNumber, isDelta, err := crlDeltaIndicator(rl)
+	if err != nil {
+		return newValidationErrorReason(responseErrorContents, crlReasonDelta, err)
+	}
+	if isDelta != p.delta {
+		return newValidationErrorReason(responseErrorContents, crlReasonDelta,
+			fmt.Errorf("unexpected CRL kind: delta [%t], expected delta [%t]", isDelta, p.delta))
+	}
+	if rl.Number == nil {
+		return newValidationErrorReason(responseErrorContents, crlReasonNumber, errors.New("CRL has no CRL number"))
+	}
+
+	return p.checkNumber(rl, baseNumber)
+}
+
+// checkNumber проверяет монотонность номеров CRL относительно ранее проверенных CRL цели мониторинга
+// и запоминает номер rl. Для delta CRL также проверяется, что его базовый CRL baseNumber не новее
+// последнего проверенного полного CRL (RFC5280 5.2.4).
+func (p *crlProber) checkNumber(rl *x509.RevocationList, baseNumber *big.Int) error {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	lastNumber, lastThisUpdate := &p.state.baseNumber, &p.state.baseThisUpdate
+	if p.delta {
+		lastNumber, lastThisUpdate = &p.state.deltaNumber, &p.state.deltaThisUpdate
+
+		if p.state.baseNumber != nil && baseNumber.Cmp(p.state.baseNumber) > 0 {
+			return newValidationErrorReason(responseErrorContents, crlReasonDelta,
+				fmt.Errorf("delta CRL base CRL number is newer than last base CRL: [%s], [%s]", baseNumber.String(), p.state.baseNumber.String()))
+		}
+	}
+
+	if *lastNumber != nil {
+		switch cmp := rl.Number.Cmp(*lastNumber); {
+		case cmp < 0:
+			return newValidationErrorReason(responseErrorContents, crlReasonNumber,
+				fmt.Errorf("CRL number decreased: [%s], last [%s]", rl.Number.String(), (*lastNumber).String()))
+		case cmp == 0 && !rl.ThisUpdate.Equal(*lastThisUpdate):
+			return newValidationErrorReason(responseErrorContents, crlReasonNumber,
+				fmt.Errorf("CRL reissued with the same number: [%s], thisUpdate [%s], last [%s]", rl.Number.String(),
+					rl.ThisUpdate.UTC().Format(time.RFC3339), lastThisUpdate.UTC().Format(time.RFC3339)))
+		}
+	}
+	*lastNumber, *lastThisUpdate = rl.Number, rl.ThisUpdate
+	return nil
+}
+
+// crlLog записывает сведения о CRL rl в событие протокола le.
+func crlLog(rl *x509.RevocationList, verbose bool, le *zerolog.Event) {
+	if rl.Number != nil {
+		le.Str("crlNumber", rl.Number.String())
+	}
+	le.Int("crlEntries", len(rl.RevokedCertificateEntries)).
+		Time("thisUpdate", rl.ThisUpdate).
+		Time("nextUpdate", rl.NextUpdate)
+	if verbose {
+		le.Str("crlIssuer", rl.Issuer.String())
+	}
+}
+
+// crlParse разбирает CRL в ASN.1 DER или PEM (блок X509 CRL).
+func crlParse(data []byte) (*x509.RevocationList, error) {
+	if pemblock, _ := pem.Decode(data); pemblock != nil {
+		if pemblock.Type != "X509 CRL" {
+			return nil, fmt.Errorf("invalid CRL PEM header: [%s]", pemblock.Type)
+		}
+		data = pemblock.Bytes
+	}
+	rl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL: [%w]", err)
+	}
+	return rl, nil
+}
+
+// crlVerifySignature проверяет подпись CRL rl сертификатом издателя. Издатель ищется по имени
+// среди issuer (если не nil) и доверенных сертификатов trust. Сертификат издателя должен допускать
+// подпись CRL (keyUsage cRLSign). Поддерживаются алгоритмы ГОСТ (см. verifySignature).
+//
+// Если сертификат издателя issuer загружен по AIA (issuerDiscovered) и доверенные сертификаты заданы, то для
+// него дополнительно строится цепочка до одного из trust на момент checkTime (см. certChainBuild).
+//
+// Возвращает сертификат, которым подтверждена подпись. Ошибки имеют тип responseErrorSignature.
+func crlVerifySignature(rl *x509.RevocationList, issuer *x509.Certificate, issuerDiscovered bool, trust []*x509.Certificate, checkTime time.Time) (*x509.Certificate, error) {
+	var raw crlRaw
+	if _, err := asn1.Unmarshal(rl.Raw, &raw); err != nil {
+		return nil, newValidationError(responseErrorSignature, fmt.Errorf("failed to decode CRL: [%w]", err))
+	}
+
+	candidates := trust
+	if issuer != nil {
+		candidates = append([]*x509.Certificate{issuer}, trust...)
+	}
+	var lastError error
+	for _, cert := range candidates {
+		if !bytes.Equal(cert.RawSubject, rl.RawIssuer) {
+			continue
+		}
+		// RFC5280 4.2.1.3: сертификат издателя CRL должен содержать keyUsage с cRLSign
+		if cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+			lastError = newValidationErrorReason(responseErrorSignature, crlReasonIssuerKeyUsage,
+				fmt.Errorf("CRL issuer certificate key usage does not permit CRL signing: [%s]", cert.Subject.String()))
+			continue
+		}
+		if err := verifySignature(cert, raw.SignatureAlgorithm, rl.RawTBSRevocationList, raw.SignatureValue.RightAlign()); err != nil {
+			lastError = newValidationError(responseErrorSignature, fmt.Errorf("CRL signature verification failed: [%w]", err))
+			continue
+		}
+		if cert == issuer && issuerDiscovered && len(trust) > 0 {
+			if _, err := certChainBuild(cert, nil, trust, checkTime); err != nil {
+				return nil, fmt.Errorf("CRL issuer certificate downloaded from AIA is not trusted: [%w]", err)
+			}
+		}
+		return cert, nil
+	}
+	if lastError != nil {
+		return nil, lastError
+	}
+	return nil, newValidationErrorReason(responseErrorSignature, crlReasonIssuerNotFound,
+		fmt.Errorf("CRL issuer certificate not found: [%s]", rl.Issuer.String()))
+}
+
+// crlDeltaIndicator возвращает номер базового CRL из расширения deltaCRLIndicator и признак
+// delta CRL (наличие расширения).
+func crlDeltaIndicator(rl *x509.RevocationList) (*big.Int, bool, error) {
+	for i := range rl.Extensions {
+		if !rl.Extensions[i].Id.Equal(oidExtensionDeltaCRLIndicator) {
+			continue
+		}
+		baseNumber := new(big.Int)
+		if _, err := asn1.Unmarshal(rl.Extensions[i].Value, &baseNumber); err != nil {
+			return nil, true, fmt.Errorf("failed to decode delta CRL indicator: [%w]", err)
+		}
+		return baseNumber, true, nil
+	}
+	return nil, false, nil
+}
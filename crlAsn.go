@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+/*
+  ASN.1 структуры, необходимые для разбора CRL и расширений сертификата, указывающих на CRL.
+  Определение в RFC5280 - https://www.rfc-editor.org/rfc/rfc5280.html
+*/
+
+// Определение OID-ов расширений, необходимых для разбора CRL
+var (
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionFreshestCRL       = asn1.ObjectIdentifier{2, 5, 29, 46}
+)
+
+// Тег uniformResourceIdentifier в GeneralName
+const crlGeneralNameURI = 6
+
+// crlRaw определяет структуру CRL верхнего уровня (для получения алгоритма подписи в виде
+// AlgorithmIdentifier, в т.ч. для алгоритмов ГОСТ).
+//
+//	CertificateList  ::=  SEQUENCE  {
+//	  tbsCertList          TBSCertList,
+//	  signatureAlgorithm   AlgorithmIdentifier,
+//	  signatureValue       BIT STRING  }
+type crlRaw struct {
+	TBSCertList        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// crlDistributionPoint определяет точку распространения CRL (расширения cRLDistributionPoints
+// и freshestCRL имеют одинаковый синтаксис).
+//
+//	DistributionPoint ::= SEQUENCE {
+//	  distributionPoint       [0]     DistributionPointName OPTIONAL,
+//	  reasons                 [1]     ReasonFlags OPTIONAL,
+//	  cRLIssuer               [2]     GeneralNames OPTIONAL }
+//
+//	DistributionPointName ::= CHOICE {
+//	  fullName                [0]     GeneralNames,
+//	  nameRelativeToCRLIssuer [1]     RelativeDistinguishedName }
+type crlDistributionPoint struct {
+	DistributionPoint crlDistributionPointName `asn1:"optional,tag:0"`
+	Reason            asn1.BitString           `asn1:"optional,tag:1"`
+	CRLIssuer         asn1.RawValue            `asn1:"optional,tag:2"`
+}
+
+type crlDistributionPointName struct {
+	FullName     []asn1.RawValue  `asn1:"optional,tag:0"`
+	RelativeName pkix.RDNSequence `asn1:"optional,tag:1"`
+}
+
+// crlDistributionPointURLs возвращает URL-ы (uniformResourceIdentifier из fullName) значения
+// расширения value с синтаксисом CRLDistributionPoints.
+func crlDistributionPointURLs(value []byte) ([]string, error) {
+	var points []crlDistributionPoint
+	if _, err := asn1.Unmarshal(value, &points); err != nil {
+		return nil, fmt.Errorf("failed to decode CRL distribution points: [%w]", err)
+	}
+
+	var out []string
+	for i := range points {
+		for _, name := range points[i].DistributionPoint.FullName {
+			if name.Class == asn1.ClassContextSpecific && name.Tag == crlGeneralNameURI {
+				out = append(out, string(name.Bytes))
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+  Кеш последних загруженных полных CRL (по URL). Используется для сверки статусов сертификатов
+  из ответов OCSP серверов с CRL (см. ocspCRLCheck.go). Кеш пополняется мониторами CRL (секция crl)
+  и, если CRL в кеше нет или он устарел, загрузкой CRL по запросу.
+*/
+
+// время, в течение которого CRL в кеше считается актуальным (с момента загрузки), если его nextUpdate
+// еще не наступило. Позволяет обнаруживать CRL, выпущенные раньше nextUpdate предыдущего.
+const crlCacheMaxAge = time.Hour
+
+// время, в течение которого ошибка загрузки или проверки CRL возвращается из кеша без повторной загрузки
+// (чтобы не загружать недоступный или некорректный CRL при каждой проверке OCSP)
+const crlCacheRetryInterval = 5 * time.Minute
+
+// crlRecord содержит сведения о загруженном и проверенном полном CRL. После создания не изменяется.
+type crlRecord struct {
+	// URL, по которому загружен CRL
+	URL string
+
+	// Имя издателя CRL (DER и строковое представление)
+	RawIssuer []byte
+	Issuer    string
+
+	// Номер CRL (nil, если не указан)
+	Number *big.Int
+
+	// Время выпуска CRL и время выпуска следующего CRL
+	ThisUpdate time.Time
+	NextUpdate time.Time
+
+	// Время загрузки CRL
+	Fetched time.Time
+
+	// время отзыва сертификатов по серийному номеру (hex)
+	revoked map[string]time.Time
+}
+
+// newCRLRecord создает сведения о CRL rl, загруженном по URL u в момент fetched.
+func newCRLRecord(u string, rl *x509.RevocationList, fetched time.Time) *crlRecord {
+	out := &crlRecord{
+		URL:        u,
+		RawIssuer:  rl.RawIssuer,
+		Issuer:     rl.Issuer.String(),
+		Number:     rl.Number,
+		ThisUpdate: rl.ThisUpdate,
+		NextUpdate: rl.NextUpdate,
+		Fetched:    fetched,
+		revoked:    make(map[string]time.Time, len(rl.RevokedCertificateEntries)),
+	}
+	for i := range rl.RevokedCertificateEntries {
+		entry := &rl.RevokedCertificateEntries[i]
+		out.revoked[entry.SerialNumber.Text(16)] = entry.RevocationTime
+	}
+	return out
+}
+
+// Revoked возвращает время отзыва сертификата с серийным номером serial и признак его наличия в CRL.
+func (r *crlRecord) Revoked(serial *big.Int) (time.Time, bool) {
+	revocationTime, ok := r.revoked[serial.Text(16)]
+	return revocationTime, ok
+}
+
+// fresh возвращает true, если CRL актуален на момент now: nextUpdate не наступило и CRL загружен
+// не ранее crlCacheMaxAge назад.
+func (r *crlRecord) fresh(now time.Time) bool {
+	return r.NextUpdate.After(now) && now.Sub(r.Fetched) < crlCacheMaxAge
+}
+
+// crlCache хранит последние загруженные полные CRL по URL. Методы безопасны для вызова из разных
+// goroutine-н и для nil объекта (кеш не используется).
+type crlCache struct {
+	mu      sync.Mutex
+	entries map[string]*crlCacheEntry
+}
+
+// crlCacheEntry содержит последний CRL одного URL и ошибку последней загрузки. Блокировка записи
+// удерживается на время загрузки CRL, чтобы не загружать один и тот же CRL одновременно.
+type crlCacheEntry struct {
+	mu     sync.Mutex
+	record *crlRecord
+
+	// ошибка последней загрузки CRL и время загрузки (nil, если последняя загрузка успешна)
+	err    error
+	failed time.Time
+}
+
+// newCRLCache создает пустой кеш CRL.
+func newCRLCache() *crlCache {
+	return &crlCache{entries: make(map[string]*crlCacheEntry)}
+}
+
+// entry возвращает запись кеша для URL u (создает при отсутствии).
+func (c *crlCache) entry(u string) *crlCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[u]
+	if !ok {
+		e = &crlCacheEntry{}
+		c.entries[u] = e
+	}
+	return e
+}
+
+// Put сохраняет в кеше CRL rl, загруженный и проверенный монитором CRL по URL u.
+func (c *crlCache) Put(u string, rl *x509.RevocationList, fetched time.Time) {
+	if c == nil {
+		return
+	}
+	e := c.entry(u)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.record == nil || !rl.ThisUpdate.Before(e.record.ThisUpdate) {
+		e.record = newCRLRecord(u, rl, fetched)
+	}
+	e.err = nil
+}
+
+// Get возвращает актуальный полный CRL, загруженный по URL u. Если CRL в кеше нет или он устарел, то CRL
+// загружается (не более maxSize байт, с таймаутом timeout, загрузка прерывается при отмене ctx), проверяется
+// его подпись сертификатом издателя issuer (issuerDiscovered - загружен по AIA) или одним из доверенных
+// сертификатов trust (см. crlVerifySignature) и сохраняется в кеше.
+// Загруженный CRL без nextUpdate или с наступившим nextUpdate отвергается как устаревший.
+//
+// Ошибка загрузки или проверки CRL запоминается и в течение crlCacheRetryInterval возвращается без
+// повторной загрузки (кроме прерывания загрузки отменой ctx).
+func (c *crlCache) Get(ctx context.Context, u string, issuer *x509.Certificate, issuerDiscovered bool, trust []*x509.Certificate, timeout time.Duration, maxSize int64) (*crlRecord, error) {
+	if c == nil {
+		return nil, errors.New("CRL cache is not available")
+	}
+	e := c.entry(u)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.record != nil && e.record.fresh(now) {
+		return e.record, nil
+	}
+	if e.err != nil && now.Sub(e.failed) < crlCacheRetryInterval {
+		return nil, fmt.Errorf("CRL download is postponed until [%s]: [%w]", e.failed.Add(crlCacheRetryInterval).UTC().Format(time.RFC3339), e.err)
+	}
+
+	record, err := crlLoad(ctx, u, issuer, issuerDiscovered, trust, timeout, maxSize, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.err, e.failed = err, now
+		}
+		return nil, err
+	}
+	e.record, e.err = record, nil
+	return e.record, nil
+}
+
+// crlLoad загружает и проверяет полный CRL для кеша (см. crlCache.Get) на момент now.
+func crlLoad(ctx context.Context, u string, issuer *x509.Certificate, issuerDiscovered bool, trust []*x509.Certificate, timeout time.Duration, maxSize int64, now time.Time) (*crlRecord, error) {
+	rl, err := crlFetch(ctx, u, timeout, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = crlVerifySignature(rl, issuer, issuerDiscovered, trust, now); err != nil {
+		return nil, fmt.Errorf("CRL [%s]: [%w]", u, err)
+	}
+	if _, isDelta, _ := crlDeltaIndicator(rl); isDelta {
+		return nil, fmt.Errorf("CRL [%s]: delta CRL instead of full CRL", u)
+	}
+	if rl.NextUpdate.IsZero() {
+		return nil, fmt.Errorf("CRL [%s]: no nextUpdate", u)
+	}
+	if !rl.NextUpdate.After(now) {
+		return nil, fmt.Errorf("CRL [%s]: stale CRL: nextUpdate [%s]", u, rl.NextUpdate.UTC().Format(time.RFC3339))
+	}
+	return newCRLRecord(u, rl, now), nil
+}
+
+// crlFetch загружает и разбирает CRL по URL u. Загрузка прерывается при отмене ctx.
+func crlFetch(ctx context.Context, u string, timeout time.Duration, maxSize int64) (*x509.RevocationList, error) {
+	client := &http.Client{
+		Transport: &http.Transport{},
+		Timeout:   timeout,
+	}
+	defer client.CloseIdleConnections()
+
+	nr, err := sendRequest(ctx, client, http.MethodGet, u, "", maxSize, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download CRL [%s]: [%w]", u, err)
+	}
+	if nr.StatusCode < http.StatusOK || nr.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("failed to download CRL [%s]: invalid HTTP status code: [%d]: [%s]", u, nr.StatusCode, http.StatusText(nr.StatusCode))
+	}
+	rl, err := crlParse(nr.Body)
+	if err != nil {
+		return nil, fmt.Errorf("CRL [%s]: [%w]", u, err)
+	}
+	return rl, nil
+}
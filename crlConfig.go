@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// значения по умолчанию для "опасных" флагов
+const (
+	defaultCRLMaxResponseSize int64 = 64 << 20 // байт (64 Мб)
+	defaultCRLRetryInterval         = "15m"
+)
+
+// crlConfig определяет структуру с настройками загрузки и проверки CRL.
+type crlConfig struct {
+	// Name содержит имя цели мониторинга. Используется в протоколе и в метках метрик (target).
+	// Должно быть уникальным среди целей CRL. Может быть не указано, если цель одна.
+	// Для проверки delta CRL используется имя цели с суффиксом "_delta".
+	Name string `json:"name" yaml:"name"`
+
+	// Disabled флаг позволяет отключить загрузку CRL при установке в значение true.
+	Disabled bool `json:"disabled" yaml:"disabled"`
+
+	// URL CRL. Если не указан, то берется из расширения cRLDistributionPoints сертификата Cert/CertFile.
+	URL string `json:"url" yaml:"url"`
+
+	// Признак того, что URL получен из расширения сертификата.
+	URLDiscovered bool `json:"-" yaml:"-"`
+
+	// Delta флаг включает загрузку и проверку delta CRL (отдельным монитором).
+	Delta bool `json:"delta" yaml:"delta"`
+
+	// DeltaURL содержит URL delta CRL. Если не указан, то берется из расширения freshestCRL
+	// сертификата Cert/CertFile. Используется только при Delta равном true.
+	DeltaURL string `json:"deltaurl" yaml:"deltaurl"`
+
+	// Cert содержит сертификат (ASN.1 DER в base64), из расширений которого берутся URL CRL и delta CRL
+	// (если не указаны) и URL сертификата издателя CRL (caIssuers расширения AIA).
+	// Если установлено это поле, то значение в поле CertFile игнорируется.
+	Cert string `json:"cert" yaml:"cert"`
+
+	// CertFile содержит путь к файлу с сертификатом (ASN.1 DER или PEM), см. Cert.
+	// Файл читаем только если поле Cert пустое.
+	CertFile string `json:"certfile" yaml:"certfile"`
+
+	// Разобранный сертификат. nil, если сертификат не указан.
+	Certificate *x509.Certificate `json:"-" yaml:"-"`
+
+	// IssuerCert содержит сертификат издателя CRL (ASN.1 DER в base64), которым проверяется подпись CRL.
+	// Если не указан (вместе с IssuerCertFile), то сертификат издателя загружается по AIA сертификата
+	// Cert/CertFile, а при отсутствии сертификата ищется среди доверенных сертификатов (секция trust).
+	// Если установлено это поле, то значение в поле IssuerCertFile игнорируется.
+	IssuerCert string `json:"issuercert" yaml:"issuercert"`
+
+	// IssuerCertFile содержит путь к файлу с сертификатом издателя CRL (ASN.1 DER или PEM).
+	// Файл читаем только если поле IssuerCert пустое.
+	IssuerCertFile string `json:"issuercertfile" yaml:"issuercertfile"`
+
+	// Разобранный сертификат издателя CRL. nil, если издатель не указан и не загружался по AIA.
+	IssuerCertificate *x509.Certificate `json:"-" yaml:"-"`
+
+	// URL, по которому загружен сертификат издателя (caIssuers расширения AIA сертификата Cert/CertFile).
+	// Пустая строка, если сертификат издателя не загружался или еще не загружен.
+	IssuerURL string `json:"-" yaml:"-"`
+
+	// Загрузка сертификата издателя по AIA при проверках (nil, если сертификат издателя не загружается).
+	// До загрузки IssuerCertificate не установлен, см. resolveIssuer.
+	issuerDiscovery *aiaIssuerDiscovery
+
+	// Доверенные сертификаты общего хранилища (секция trust), среди которых ищется издатель CRL,
+	// если сертификат издателя не указан.
+	TrustCertificates []*x509.Certificate `json:"-" yaml:"-"`
+
+	// Timeout сетевого взаимодействия. Должно быть значение допустимое для time.ParseDuration().
+	// Пустая строка - без таймаута.
+	Timeout      string        `json:"timeout" yaml:"timeout"`
+	TimeoutValue time.Duration `json:"-" yaml:"-"`
+
+	// MaxThisUpdateAge содержит максимально допустимый возраст CRL (thisUpdate).
+	// Должно быть значение допустимое для time.ParseDuration(). Пустая строка - без проверки.
+	// Вне зависимости от значения поля проверяется, что nextUpdate указано и еще не наступило.
+	MaxThisUpdateAge      string        `json:"maxthisupdateage" yaml:"maxthisupdateage"`
+	MaxThisUpdateAgeValue time.Duration `json:"-" yaml:"-"`
+
+	// RetryCount содержит количество повторов загрузки CRL.
+	// 0 - бесконечно.
+	RetryCount int `json:"retrycount" yaml:"retrycount"`
+
+	// RetryInterval содержит временной интервал между двумя попытками загрузки CRL.
+	// Должно быть значение допустимое для time.ParseDuration().
+	// По умолчанию устанавливается в 15m.
+	// Пустая строка - без интервала. Использовать в этом режиме крайне НЕ рекомендуется.
+	// Режим работы без интервала можно установить только параметром командной строки.
+	RetryInterval      string        `json:"retryinterval" yaml:"retryinterval"`
+	RetryIntervalValue time.Duration `json:"-" yaml:"-"`
+
+	// MaxResponseSize определяет максимально допустимый размер CRL в байтах.
+	// Если установлен в 0, то размер не ограничен. По умолчанию 64 Мб.
+	MaxResponseSize *int64 `json:"maxresponsesize" yaml:"maxresponsesize"`
+}
+
+// TargetName возвращает имя цели мониторинга.
+func (cfg *crlConfig) TargetName() string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Name
+}
+
+// SetTargetName устанавливает имя цели мониторинга.
+func (cfg *crlConfig) SetTargetName(name string) {
+	if cfg == nil {
+		return
+	}
+	cfg.Name = name
+}
+
+// SetDefaults позволяет инициализировать не заданные/критичные поля значениями по умолчанию.
+func (cfg *crlConfig) SetDefaults() {
+	if cfg == nil {
+		return
+	}
+	if cfg.RetryInterval == "" {
+		cfg.RetryInterval = defaultCRLRetryInterval
+	}
+	if cfg.MaxResponseSize == nil {
+		cfg.MaxResponseSize = new(int64)
+	}
+	if *cfg.MaxResponseSize == 0 {
+		*cfg.MaxResponseSize = defaultCRLMaxResponseSize
+	}
+}
+
+// UpdateCommandLine позволяет проверить и установить значения объекта конфигурации из
+// параметров командной строки.
+func (cfg *crlConfig) UpdateCommandLine(givenFlags []*flag.Flag) {
+	if cfg == nil {
+		return
+	}
+	for _, f := range givenFlags {
+		switch f.Name {
+		case "crl.disabled":
+			cfg.Disabled = *clpCRLDisabled
+		case "crl.url":
+			cfg.URL = *clpCRLURL
+		case "crl.delta":
+			cfg.Delta = *clpCRLDelta
+		case "crl.deltaurl":
+			cfg.DeltaURL = *clpCRLDeltaURL
+		case "crl.cert":
+			cfg.Cert = *clpCRLCert
+		case "crl.certfile":
+			cfg.CertFile = *clpCRLCertFile
+		case "crl.issuercert":
+			cfg.IssuerCert = *clpCRLIssuerCert
+		case "crl.issuercertfile":
+			cfg.IssuerCertFile = *clpCRLIssuerCertFile
+		case "crl.timeout":
+			cfg.Timeout = *clpCRLTimeout
+		case "crl.maxthisupdateage":
+			cfg.MaxThisUpdateAge = *clpCRLMaxThisUpdateAge
+		case "crl.retrycount":
+			cfg.RetryCount = *clpCRLRetryCount
+		case "crl.retryinterval":
+			cfg.RetryInterval = *clpCRLRetryInterval
+		case "crl.maxresponsesize":
+			*cfg.MaxResponseSize = *clpCRLMaxResponseSize
+		}
+	}
+}
+
+// Validate проверяет формат и наличие необходимых параметров, декодирует нужные значения и т.д.
+func (cfg *crlConfig) Validate() error {
+	var err error
+	if cfg == nil {
+		return errors.New("nil CRL config object")
+	}
+
+	if cfg.Disabled {
+		return nil
+	}
+
+	if cfg.Timeout != "" {
+		cfg.TimeoutValue, err = time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid CRL config: failed to parse timeout: [%w]", err)
+		}
+	}
+
+	if cfg.Cert != "" || cfg.CertFile != "" {
+		cfg.Certificate, err = loadCertificate(cfg.Cert, cfg.CertFile)
+		if err != nil {
+			return fmt.Errorf("invalid CRL config: failed to load certificate: [%w]", err)
+		}
+	}
+
+	if cfg.URL == "" {
+		if cfg.Certificate != nil {
+			cfg.URL = aiaHTTPURL(cfg.Certificate.CRLDistributionPoints)
+		}
+		if cfg.URL == "" {
+			return errors.New("invalid CRL config: empty URL and no CRL distribution point URL in certificate")
+		}
+		cfg.URLDiscovered = true
+	}
+
+	if cfg.Delta && cfg.DeltaURL == "" {
+		if cfg.Certificate != nil {
+			cfg.DeltaURL, err = crlFreshestURL(cfg.Certificate)
+			if err != nil {
+				return fmt.Errorf("invalid CRL config: [%w]", err)
+			}
+		}
+		if cfg.DeltaURL == "" {
+			return errors.New("invalid CRL config: empty deltaurl and no freshest CRL URL in certificate")
+		}
+	}
+
+	switch {
+	case cfg.IssuerCert != "" || cfg.IssuerCertFile != "":
+		cfg.IssuerCertificate, err = loadCertificate(cfg.IssuerCert, cfg.IssuerCertFile)
+		if err != nil {
+			return fmt.Errorf("invalid CRL config: failed to load issuer certificate: [%w]", err)
+		}
+
+	case cfg.Certificate != nil && len(cfg.Certificate.IssuingCertificateURL) > 0:
+		// сертификат издателя загружается при проверках (см. resolveIssuer)
+		cfg.issuerDiscovery = newAIAIssuerDiscovery(cfg.Certificate, cfg.TimeoutValue)
+	}
+
+	if cfg.MaxThisUpdateAge != "" {
+		cfg.MaxThisUpdateAgeValue, err = time.ParseDuration(cfg.MaxThisUpdateAge)
+		if err != nil {
+			return fmt.Errorf("invalid CRL config: failed to parse maxthisupdateage: [%w]", err)
+		}
+	}
+
+	if cfg.RetryCount < 0 {
+		return errors.New("invalid CRL config: retrycount")
+	}
+
+	if cfg.RetryInterval != "" {
+		cfg.RetryIntervalValue, err = time.ParseDuration(cfg.RetryInterval)
+		if err != nil {
+			return fmt.Errorf("invalid CRL config: failed to parse retryinterval: [%w]", err)
+		}
+	}
+
+	if cfg.MaxResponseSize == nil {
+		return errors.New("invalid CRL config: nil maxresponsesize")
+	}
+	if *cfg.MaxResponseSize < 0 {
+		return errors.New("invalid CRL config: maxresponsesize")
+	}
+
+	return nil
+}
+
+// crlFreshestURL возвращает первый URL с протоколом http(s) из расширения freshestCRL сертификата cert
+// (пустая строка, если расширения или таких URL нет).
+func crlFreshestURL(cert *x509.Certificate) (string, error) {
+	for i := range cert.Extensions {
+		if !cert.Extensions[i].Id.Equal(oidExtensionFreshestCRL) {
+			continue
+		}
+		urls, err := crlDistributionPointURLs(cert.Extensions[i].Value)
+		if err != nil {
+			return "", fmt.Errorf("freshest CRL extension: [%w]", err)
+		}
+		return aiaHTTPURL(urls), nil
+	}
+	return "", nil
+}
+
+// resolveIssuer загружает по AIA сертификат издателя CRL (загрузка прерывается при отмене ctx), если он
+// загружается при проверках и еще не установлен. Ошибка загрузки возвращается как *aiaDiscoveryError.
+// Безопасен для вызова из разных goroutine-н (мониторы полного и delta CRL используют общую конфигурацию).
+func (cfg *crlConfig) resolveIssuer(ctx context.Context) error {
+	d := cfg.issuerDiscovery
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cfg.IssuerCertificate != nil {
+		return nil
+	}
+
+	if err := d.fetch(ctx); err != nil {
+		return err
+	}
+	cfg.IssuerCertificate, cfg.IssuerURL = d.issuer, d.url
+	return nil
+}
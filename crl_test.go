@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testDeltaCRL создает delta CRL с номером number и номером базового CRL baseNumber, выпущенный
+// в thisUpdate и подписанный ключом key от имени issuer.
+func testDeltaCRL(t *testing.T, issuer *x509.Certificate, key *ecdsa.PrivateKey, number, baseNumber int64, thisUpdate, nextUpdate time.Time) []byte {
+	t.Helper()
+	indicator, err := asn1.Marshal(big.NewInt(baseNumber))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:          big.NewInt(number),
+		ThisUpdate:      thisUpdate,
+		NextUpdate:      nextUpdate,
+		ExtraExtensions: []pkix.Extension{{Id: oidExtensionDeltaCRLIndicator, Critical: true, Value: indicator}},
+	}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCRLProberValidate(t *testing.T) {
+	issuer, issuerKey := testCA(t, "test CA")
+	// сертификат издателя с тем же именем и ключом, не допускающий подпись CRL
+	noCRLSignTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               issuer.Subject,
+		NotBefore:             issuer.NotBefore,
+		NotAfter:              issuer.NotAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	noCRLSignDER, err := x509.CreateCertificate(rand.Reader, noCRLSignTemplate, noCRLSignTemplate, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noCRLSign, err := x509.ParseCertificate(noCRLSignDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	t1, t2 := now.Add(-2*time.Hour), now.Add(-time.Hour)
+	next := now.Add(time.Hour)
+
+	// crlStep описывает очередной проверяемый CRL цели мониторинга
+	type crlStep struct {
+		delta      bool  // проверка монитором delta CRL
+		deltaCRL   bool  // CRL содержит deltaCRLIndicator
+		number     int64 // номер CRL
+		baseNumber int64 // номер базового CRL (для delta CRL)
+		thisUpdate time.Time
+		nextUpdate time.Time
+		noCRLSign  bool   // сертификат издателя не допускает подпись CRL
+		wantReason string // пустая строка - ошибки нет
+	}
+	full := func(number int64, thisUpdate time.Time, wantReason string) crlStep {
+		return crlStep{number: number, thisUpdate: thisUpdate, nextUpdate: next, wantReason: wantReason}
+	}
+	delta := func(number, baseNumber int64, thisUpdate time.Time, wantReason string) crlStep {
+		return crlStep{delta: true, deltaCRL: true, number: number, baseNumber: baseNumber, thisUpdate: thisUpdate, nextUpdate: next, wantReason: wantReason}
+	}
+
+	tests := []struct {
+		name  string
+		steps []crlStep
+	}{
+		{"number increased", []crlStep{full(1, t1, ""), full(2, t2, "")}},
+		{"same CRL", []crlStep{full(2, t2, ""), full(2, t2, "")}},
+		{"reissued with same number", []crlStep{full(2, t1, ""), full(2, t2, crlReasonNumber)}},
+		{"number decreased", []crlStep{full(2, t2, ""), full(1, t2, crlReasonNumber)}},
+		{"delta base is last full", []crlStep{full(5, t1, ""), delta(6, 5, t2, "")}},
+		{"delta base is older full", []crlStep{full(5, t1, ""), delta(6, 4, t2, "")}},
+		{"delta base is newer than last full", []crlStep{full(5, t1, ""), delta(7, 6, t2, crlReasonDelta)}},
+		{"delta before full", []crlStep{delta(6, 5, t2, ""), full(5, t1, "")}},
+		{"delta number decreased", []crlStep{delta(7, 5, t2, ""), delta(6, 5, t2, crlReasonNumber)}},
+		{"full CRL instead of delta", []crlStep{{delta: true, number: 6, thisUpdate: t2, nextUpdate: next, wantReason: crlReasonDelta}}},
+		{"delta CRL instead of full", []crlStep{{deltaCRL: true, number: 6, baseNumber: 5, thisUpdate: t2, nextUpdate: next, wantReason: crlReasonDelta}}},
+		{"issuer without cRLSign", []crlStep{{number: 1, thisUpdate: t2, nextUpdate: next, noCRLSign: true, wantReason: crlReasonIssuerKeyUsage}}},
+		{"thisUpdate in the future", []crlStep{full(1, now.Add(time.Minute), crlReasonThisUpdate)}},
+		{"nextUpdate passed", []crlStep{{number: 1, thisUpdate: t1, nextUpdate: t2, wantReason: crlReasonNextUpdate}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &crlState{}
+			for i, step := range tt.steps {
+				cfg := &crlConfig{Name: "test", IssuerCertificate: issuer}
+				if step.noCRLSign {
+					cfg.IssuerCertificate = noCRLSign
+				}
+				der := testCRL(t, issuer, issuerKey, step.number, step.thisUpdate, step.nextUpdate)
+				if step.deltaCRL {
+					der = testDeltaCRL(t, issuer, issuerKey, step.number, step.baseNumber, step.thisUpdate, step.nextUpdate)
+				}
+				rl, err := crlParse(der)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				p := &crlProber{cfg, step.delta, state}
+				err = p.validate(rl, now, false, nil)
+				if (err != nil) != (step.wantReason != "") {
+					t.Fatalf("step %d: validate() = %v, want reason %q", i, err, step.wantReason)
+				}
+				if reason := validationErrorReason(err); reason != step.wantReason {
+					t.Errorf("step %d: reason = %q, want %q (error: %v)", i, reason, step.wantReason, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+/*
+  Реализация функции хеширования ГОСТ 34.311-95 (ГОСТ Р 34.11-94) с использованием блочного
+  шифра ГОСТ 28147-89 (только зашифрование).
+  Описание алгоритма в RFC5831 - https://www.rfc-editor.org/rfc/rfc5831.html
+
+  Блоки данных представлены в порядке little-endian (как в большинстве реализаций).
+*/
+
+// Размеры блока и хеша ГОСТ 34.311-95 в байтах.
+const (
+	gost34311BlockSize = 32
+	gost34311Size      = 32
+)
+
+// gost28147SBox определяет таблицу замен ГОСТ 28147-89: строка i применяется к i-му (начиная
+// с младшего) 4-х битному блоку.
+type gost28147SBox [8][16]byte
+
+// gost34311CryptoProSBox таблица замен id-GostR3411-94-CryptoProParamSet (RFC4357, раздел 11.2).
+// Используется для ГОСТ 34.311-95 НУЦ РК и ГОСТ Р 34.11-94.
+var gost34311CryptoProSBox = gost28147SBox{
+	{10, 4, 5, 6, 8, 1, 3, 7, 13, 12, 14, 0, 9, 2, 11, 15},
+	{5, 15, 4, 0, 2, 13, 11, 9, 1, 7, 6, 3, 12, 14, 10, 8},
+	{7, 15, 12, 14, 9, 4, 1, 0, 3, 11, 5, 2, 6, 10, 8, 13},
+	{4, 10, 7, 12, 0, 15, 2, 8, 14, 1, 6, 5, 13, 11, 9, 3},
+	{7, 6, 4, 11, 9, 12, 2, 10, 1, 8, 0, 14, 15, 13, 3, 5},
+	{7, 6, 2, 4, 13, 9, 15, 0, 10, 1, 5, 11, 8, 14, 12, 3},
+	{13, 14, 4, 1, 7, 0, 5, 10, 3, 12, 8, 15, 6, 2, 9, 11},
+	{1, 3, 10, 9, 5, 11, 4, 15, 8, 6, 7, 14, 13, 0, 2, 12},
+}
+
+// gost34311C3 константа C3 процедуры генерации ключей (little-endian).
+var gost34311C3 = [gost34311BlockSize]byte{
+	0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00,
+	0x00, 0xff, 0xff, 0x00, 0xff, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0xff,
+}
+
+// gost28147Encrypt зашифровывает один 64-битный блок src ключом key в режиме простой замены.
+func gost28147Encrypt(sbox *gost28147SBox, key *[gost34311BlockSize]byte, dst, src []byte) {
+	var k [8]uint32
+	for i := range k {
+		k[i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+
+	f := func(x uint32) uint32 {
+		var out uint32
+		for i := 0; i < 8; i++ {
+			out |= uint32(sbox[i][(x>>(4*i))&0x0f]) << (4 * i)
+		}
+		return bits.RotateLeft32(out, 11)
+	}
+
+	n1, n2 := binary.LittleEndian.Uint32(src), binary.LittleEndian.Uint32(src[4:])
+	for i := 0; i < 32; i++ {
+		// ключи используются в порядке k0..k7 три раза, затем k7..k0
+		ki := i % 8
+		if i >= 24 {
+			ki = 7 - ki
+		}
+		n1, n2 = n2^f(n1+k[ki]), n1
+	}
+	binary.LittleEndian.PutUint32(dst, n2)
+	binary.LittleEndian.PutUint32(dst[4:], n1)
+}
+
+// gost34311Digest реализует hash.Hash для ГОСТ 34.311-95.
+type gost34311Digest struct {
+	sbox   *gost28147SBox
+	h      [gost34311BlockSize]byte // текущее значение хеша
+	sum    [gost34311BlockSize]byte // контрольная сумма обработанных блоков
+	length uint64                   // количество обработанных бит
+	buf    [gost34311BlockSize]byte
+	nbuf   int
+}
+
+// newGost34311 создает объект вычисления хеша ГОСТ 34.311-95 с таблицей замен CryptoPro.
+func newGost34311() hash.Hash {
+	return &gost34311Digest{sbox: &gost34311CryptoProSBox}
+}
+
+func (d *gost34311Digest) Size() int { return gost34311Size }
+
+func (d *gost34311Digest) BlockSize() int { return gost34311BlockSize }
+
+func (d *gost34311Digest) Reset() {
+	*d = gost34311Digest{sbox: d.sbox}
+}
+
+func (d *gost34311Digest) Write(p []byte) (int, error) {
+	written := len(p)
+	if d.nbuf > 0 {
+		n := copy(d.buf[d.nbuf:], p)
+		d.nbuf += n
+		p = p[n:]
+		if d.nbuf < gost34311BlockSize {
+			return written, nil
+		}
+		d.block(d.buf[:], gost34311BlockSize*8)
+		d.nbuf = 0
+	}
+	for len(p) >= gost34311BlockSize {
+		d.block(p[:gost34311BlockSize], gost34311BlockSize*8)
+		p = p[gost34311BlockSize:]
+	}
+	d.nbuf = copy(d.buf[:], p)
+	return written, nil
+}
+
+func (d *gost34311Digest) Sum(in []byte) []byte {
+	// вычисления выполняем над копией, чтобы можно было продолжить запись данных
+	c := *d
+
+	// последний неполный блок дополняется нулями
+	if c.nbuf > 0 {
+		var last [gost34311BlockSize]byte
+		copy(last[:], c.buf[:c.nbuf])
+		c.block(last[:], uint64(c.nbuf)*8)
+	}
+
+	var length [gost34311BlockSize]byte
+	binary.LittleEndian.PutUint64(length[:], c.length)
+	c.compress(&length)
+	c.compress(&c.sum)
+
+	return append(in, c.h[:]...)
+}
+
+// block обрабатывает один блок данных, содержащий bitsCount бит сообщения.
+func (d *gost34311Digest) block(p []byte, bitsCount uint64) {
+	var m [gost34311BlockSize]byte
+	copy(m[:], p)
+	d.compress(&m)
+	d.length += bitsCount
+
+	// сложение контрольной суммы по модулю 2^256
+	var carry uint16
+	for i := range d.sum {
+		carry += uint16(d.sum[i]) + uint16(m[i])
+		d.sum[i] = byte(carry)
+		carry >>= 8
+	}
+}
+
+// compress реализует шаговую функцию хеширования h = f(h, m).
+func (d *gost34311Digest) compress(m *[gost34311BlockSize]byte) {
+	// преобразование A: (y4, y3, y2, y1) -> (y1 xor y2, y4, y3, y2)
+	a := func(y [gost34311BlockSize]byte) (out [gost34311BlockSize]byte) {
+		copy(out[:24], y[8:])
+		for i := 0; i < 8; i++ {
+			out[24+i] = y[i] ^ y[8+i]
+		}
+		return out
+	}
+	// перестановка байтов P
+	p := func(y [gost34311BlockSize]byte) (out [gost34311BlockSize]byte) {
+		for i := 0; i < 4; i++ {
+			for k := 0; k < 8; k++ {
+				out[i+4*k] = y[8*i+k]
+			}
+		}
+		return out
+	}
+	// перемешивающее преобразование psi
+	psi := func(y *[gost34311BlockSize]byte) {
+		var w [2]byte
+		for _, i := range []int{0, 1, 2, 3, 12, 15} {
+			w[0] ^= y[2*i]
+			w[1] ^= y[2*i+1]
+		}
+		copy(y[:], y[2:])
+		y[30], y[31] = w[0], w[1]
+	}
+
+	// генерация ключей
+	var keys [4][gost34311BlockSize]byte
+	u, v := d.h, *m
+	for j := 0; j < 4; j++ {
+		if j > 0 {
+			u = a(u)
+			if j == 2 {
+				for i := range u {
+					u[i] ^= gost34311C3[i]
+				}
+			}
+			v = a(a(v))
+		}
+		var w [gost34311BlockSize]byte
+		for i := range w {
+			w[i] = u[i] ^ v[i]
+		}
+		keys[j] = p(w)
+	}
+
+	// шифрующее преобразование
+	var s [gost34311BlockSize]byte
+	for j := 0; j < 4; j++ {
+		gost28147Encrypt(d.sbox, &keys[j], s[j*8:], d.h[j*8:])
+	}
+
+	// перемешивающее преобразование: h = psi^61(h xor psi(m xor psi^12(s)))
+	for i := 0; i < 12; i++ {
+		psi(&s)
+	}
+	for i := range s {
+		s[i] ^= m[i]
+	}
+	psi(&s)
+	for i := range s {
+		s[i] ^= d.h[i]
+	}
+	for i := 0; i < 61; i++ {
+		psi(&s)
+	}
+	d.h = s
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/hex"
+	"hash"
+	"strings"
+	"testing"
+)
+
+// gost34311TestSBox таблица замен id-GostR3411-94-TestParamSet (используется в примерах RFC5831).
+var gost34311TestSBox = gost28147SBox{
+	{4, 10, 9, 2, 13, 8, 0, 14, 6, 11, 1, 12, 7, 15, 5, 3},
+	{14, 11, 4, 12, 6, 13, 15, 10, 2, 3, 8, 1, 0, 7, 5, 9},
+	{5, 8, 1, 13, 10, 3, 4, 2, 14, 15, 12, 7, 6, 0, 9, 11},
+	{7, 13, 10, 1, 0, 8, 9, 15, 14, 4, 6, 12, 11, 2, 5, 3},
+	{6, 12, 7, 1, 5, 15, 13, 8, 4, 10, 9, 14, 0, 3, 11, 2},
+	{4, 11, 10, 0, 7, 2, 1, 13, 3, 6, 8, 5, 9, 12, 15, 14},
+	{13, 11, 4, 1, 3, 15, 5, 9, 0, 10, 14, 7, 6, 8, 2, 12},
+	{1, 15, 13, 0, 5, 7, 10, 4, 9, 2, 3, 14, 6, 11, 8, 12},
+}
+
+func TestGost34311(t *testing.T) {
+	newTestParams := func() hash.Hash { return &gost34311Digest{sbox: &gost34311TestSBox} }
+
+	tests := []struct {
+		name    string
+		newHash func() hash.Hash
+		message string
+		digest  string
+	}{
+		// примеры RFC5831 (id-GostR3411-94-TestParamSet)
+		{"test empty", newTestParams, "", "ce85b99cc46752fffee35cab9a7b0278abb4c2d2055cff685af4912c49490f8d"},
+		{"test abc", newTestParams, "abc", "f3134348c44fb1b2a277729e2285ebb5cb5e0f29c975bc753b70497c06a4d51d"},
+		{"test fox", newTestParams, "The quick brown fox jumps over the lazy dog", "77b7fa410c9ac58a25f49bca7d0468c9296529315eaca76bd1a10f376d1f4294"},
+		// те же сообщения с таблицей замен id-GostR3411-94-CryptoProParamSet
+		{"cryptopro empty", newGost34311, "", "981e5f3ca30c841487830f84fb433e13ac1101569b9c13584ac483234cd656c0"},
+		{"cryptopro abc", newGost34311, "abc", "b285056dbf18d7392d7677369524dd14747459ed8143997e163b2986f92fd42c"},
+		{"cryptopro fox", newGost34311, "The quick brown fox jumps over the lazy dog", "9004294a361a508c586fe53d1f1b02746765e71b765472786e4770d565830a76"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.newHash()
+			h.Write([]byte(tt.message))
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.digest {
+				t.Errorf("digest = %s, want %s", got, tt.digest)
+			}
+		})
+	}
+}
+
+// TestGost34311Write проверяет, что результат не зависит от разбиения данных на части и от вызова Sum.
+func TestGost34311Write(t *testing.T) {
+	message := []byte(strings.Repeat("0123456789", 10))
+
+	whole := newGost34311()
+	whole.Write(message)
+	want := whole.Sum(nil)
+
+	parts := newGost34311()
+	for i := 0; i < len(message); i += 7 {
+		parts.Write(message[i:min(i+7, len(message))])
+		parts.Sum(nil)
+	}
+	if got := parts.Sum(nil); hex.EncodeToString(got) != hex.EncodeToString(want) {
+		t.Errorf("digest = %x, want %x", got, want)
+	}
+}
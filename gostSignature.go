@@ -0,0 +1,404 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+)
+
+/*
+  Проверка подписи ГОСТ 34.310-2004 (ГОСТ Р 34.10-2001) и ГОСТ 34.10-2015 (ГОСТ Р 34.10-2012)
+  с ключами 256 и 512 бит.
+  Определение в RFC7091 - https://www.rfc-editor.org/rfc/rfc7091.html,
+  форматы ключей и подписей в RFC4491 - https://www.rfc-editor.org/rfc/rfc4491.html
+
+  Используются соглашения RFC4491 (совместимые с CryptoPro):
+    - открытый ключ - OCTET STRING с координатами X || Y в little-endian;
+    - подпись - s || r в big-endian;
+    - значение хеша интерпретируется как число в little-endian.
+*/
+
+// Определение OID-ов алгоритмов хеширования ГОСТ
+var (
+	oidDigestGost34311           = asn1.ObjectIdentifier{1, 2, 398, 3, 10, 1, 3, 1}       // ГОСТ 34.311-95 (НУЦ РК)
+	oidDigestGost34311Gamma      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 6801, 1, 1, 1} // ГОСТ 34.311-95 (Гамма Технологии)
+	oidDigestGost34112015        = asn1.ObjectIdentifier{1, 2, 398, 3, 10, 1, 3, 3}       // ГОСТ 34.11-2015 512 бит (НУЦ РК)
+	oidDigestGostR341194         = asn1.ObjectIdentifier{1, 2, 643, 2, 2, 9}              // ГОСТ Р 34.11-94
+	oidDigestGostR34112012256    = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 2, 2}        // ГОСТ Р 34.11-2012 256 бит
+	oidDigestGostR34112012512    = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 2, 3}        // ГОСТ Р 34.11-2012 512 бит
+	oidSignatureGost34310        = asn1.ObjectIdentifier{1, 2, 398, 3, 10, 1, 1, 1, 2}    // ГОСТ 34.310-2004 с ГОСТ 34.311-95 (НУЦ РК)
+	oidSignatureGost34310Gamma   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 6801, 1, 2, 2} // ГОСТ 34.310-2004 с ГОСТ 34.311-95 (Гамма Технологии)
+	oidSignatureGost34102015     = asn1.ObjectIdentifier{1, 2, 398, 3, 10, 1, 1, 2, 3, 2} // ГОСТ 34.10-2015 512 бит (НУЦ РК)
+	oidSignatureGostR341001      = asn1.ObjectIdentifier{1, 2, 643, 2, 2, 3}              // ГОСТ Р 34.10-2001 с ГОСТ Р 34.11-94
+	oidSignatureGostR34102012256 = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 3, 2}        // ГОСТ Р 34.10-2012 256 бит
+	oidSignatureGostR34102012512 = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 3, 3}        // ГОСТ Р 34.10-2012 512 бит
+)
+
+// gostDigestAlgorithms определяет поддерживаемые алгоритмы хеширования ГОСТ.
+var gostDigestAlgorithms = map[string]func() hash.Hash{
+	oidDigestGost34311.String():        newGost34311,
+	oidDigestGost34311Gamma.String():   newGost34311,
+	oidDigestGostR341194.String():      newGost34311,
+	oidDigestGost34112015.String():     newStreebog512,
+	oidDigestGostR34112012256.String(): newStreebog256,
+	oidDigestGostR34112012512.String(): newStreebog512,
+}
+
+// gostSignatureAlgorithm описывает поддерживаемый алгоритм подписи ГОСТ.
+type gostSignatureAlgorithm struct {
+	oid     asn1.ObjectIdentifier
+	digest  asn1.ObjectIdentifier
+	newHash func() hash.Hash
+	// размер ключа (и половины подписи) в байтах
+	size int
+}
+
+// поддерживаемые алгоритмы подписи ГОСТ
+var gostSignatureAlgorithms = []gostSignatureAlgorithm{
+	{oidSignatureGost34310, oidDigestGost34311, newGost34311, 32},
+	{oidSignatureGost34310Gamma, oidDigestGost34311Gamma, newGost34311, 32},
+	{oidSignatureGost34102015, oidDigestGost34112015, newStreebog512, 64},
+	{oidSignatureGostR341001, oidDigestGostR341194, newGost34311, 32},
+	{oidSignatureGostR34102012256, oidDigestGostR34112012256, newStreebog256, 32},
+	{oidSignatureGostR34102012512, oidDigestGostR34112012512, newStreebog512, 64},
+}
+
+// gostSignatureAlgorithmByOID возвращает описание алгоритма подписи ГОСТ или nil, если
+// алгоритм не является алгоритмом подписи ГОСТ.
+func gostSignatureAlgorithmByOID(oid asn1.ObjectIdentifier) *gostSignatureAlgorithm {
+	for i := range gostSignatureAlgorithms {
+		if gostSignatureAlgorithms[i].oid.Equal(oid) {
+			return &gostSignatureAlgorithms[i]
+		}
+	}
+	return nil
+}
+
+// gostSignatureAlgorithmByDigest возвращает описание алгоритма подписи ГОСТ по алгоритму
+// хеширования (используется в CMS, где в SignatureAlgorithm может быть указан алгоритм ключа).
+func gostSignatureAlgorithmByDigest(oid asn1.ObjectIdentifier) *gostSignatureAlgorithm {
+	for i := range gostSignatureAlgorithms {
+		if gostSignatureAlgorithms[i].digest.Equal(oid) {
+			return &gostSignatureAlgorithms[i]
+		}
+	}
+	return nil
+}
+
+// gostCurve определяет параметры эллиптической кривой в форме Вейерштрасса
+// y^2 = x^3 + a*x + b (mod p) с базовой точкой (x, y) порядка q.
+type gostCurve struct {
+	name       string
+	p, a, b, q *big.Int
+	x, y       *big.Int
+	// размер координат в байтах
+	size int
+}
+
+// gostBigFromHex преобразует шестнадцатеричную строку в число (только для констант).
+func gostBigFromHex(s string) *big.Int {
+	out, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic(fmt.Errorf("invalid hex constant: [%s]", s))
+	}
+	return out
+}
+
+// Наборы параметров эллиптических кривых (RFC4357, RFC7836).
+var (
+	gostCurveCryptoProA = &gostCurve{
+		name: "id-GostR3410-2001-CryptoPro-A-ParamSet",
+		p:    gostBigFromHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFD97"),
+		a:    gostBigFromHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFD94"),
+		b:    gostBigFromHex("A6"),
+		q:    gostBigFromHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF6C611070995AD10045841B09B761B893"),
+		x:    gostBigFromHex("1"),
+		y:    gostBigFromHex("8D91E471E0989CDA27DF505A453F2B7635294F2DDF23E3B122ACC99C9E9F1E14"),
+		size: 32,
+	}
+	gostCurveCryptoProB = &gostCurve{
+		name: "id-GostR3410-2001-CryptoPro-B-ParamSet",
+		p:    gostBigFromHex("8000000000000000000000000000000000000000000000000000000000000C99"),
+		a:    gostBigFromHex("8000000000000000000000000000000000000000000000000000000000000C96"),
+		b:    gostBigFromHex("3E1AF419A269A5F866A7D3C25C3DF80AE979259373FF2B182F49D4CE7E1BBC8B"),
+		q:    gostBigFromHex("800000000000000000000000000000015F700CFFF1A624E5E497161BCC8A198F"),
+		x:    gostBigFromHex("1"),
+		y:    gostBigFromHex("3FA8124359F96680B83D1C3EB2C070E5C545C9858D03ECFB744BF8D717717EFC"),
+		size: 32,
+	}
+	gostCurveCryptoProC = &gostCurve{
+		name: "id-GostR3410-2001-CryptoPro-C-ParamSet",
+		p:    gostBigFromHex("9B9F605F5A858107AB1EC85E6B41C8AACF846E86789051D37998F7B9022D759B"),
+		a:    gostBigFromHex("9B9F605F5A858107AB1EC85E6B41C8AACF846E86789051D37998F7B9022D7598"),
+		b:    gostBigFromHex("805A"),
+		q:    gostBigFromHex("9B9F605F5A858107AB1EC85E6B41C8AA582CA3511EDDFB74F02F3A6598980BB9"),
+		x:    gostBigFromHex("0"),
+		y:    gostBigFromHex("41ECE55743711A8C3CBF3783CD08C0EE4D4DC440D4641A8F366E550DFDB3BB67"),
+		size: 32,
+	}
+	gostCurveTC26256A = &gostCurve{
+		name: "id-tc26-gost-3410-2012-256-paramSetA",
+		p:    gostBigFromHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFD97"),
+		a:    gostBigFromHex("C2173F1513981673AF4892C23035A27CE25E2013BF95AA33B22C656F277E7335"),
+		b:    gostBigFromHex("295F9BAE7428ED9CCC20E7C359A9D41A22FCCD9108E17BF7BA9337A6F8AE9513"),
+		q:    gostBigFromHex("400000000000000000000000000000000FD8CDDFC87B6635C115AF556C360C67"),
+		x:    gostBigFromHex("91E38443A5E82C0D880923425712B2BB658B9196932E02C78B2582FE742DAA28"),
+		y:    gostBigFromHex("32879423AB1A0375895786C4BB46E9565FDE0B5344766740AF268ADB32322E5C"),
+		size: 32,
+	}
+	gostCurveTC26512A = &gostCurve{
+		name: "id-tc26-gost-3410-12-512-paramSetA",
+		p: gostBigFromHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" +
+			"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFDC7"),
+		a: gostBigFromHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" +
+			"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFDC4"),
+		b: gostBigFromHex("E8C2505DEDFC86DDC1BD0B2B6667F1DA34B82574761CB0E879BD081CFD0B6265" +
+			"EE3CB090F30D27614CB4574010DA90DD862EF9D4EBEE4761503190785A71C760"),
+		q: gostBigFromHex("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" +
+			"27E69532F48D89116FF22B8D4E0560609B4B38ABFAD2B85DCACDB1411F10B275"),
+		x: gostBigFromHex("3"),
+		y: gostBigFromHex("7503CFE87A836AE3A61B8816E25450E6CE5E1C93ACF1ABC1778064FDCBEFA921" +
+			"DF1626BE4FD036E93D75E6A50E3A41E98028FE5FC235F5B889A589CB5215F2A4"),
+		size: 64,
+	}
+	gostCurveTC26512B = &gostCurve{
+		name: "id-tc26-gost-3410-12-512-paramSetB",
+		p: gostBigFromHex("8000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000000000000000000000000000000000000000000000000000000006F"),
+		a: gostBigFromHex("8000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000000000000000000000000000000000000000000000000000000006C"),
+		b: gostBigFromHex("687D1B459DC841457E3E06CF6F5E2517B97C7D614AF138BCBF85DC806C4B289F" +
+			"3E965D2DB1416D217F8B276FAD1AB69C50F78BEE1FA3106EFB8CCBC7C5140116"),
+		q: gostBigFromHex("8000000000000000000000000000000000000000000000000000000000000001" +
+			"49A1EC142565A545ACFDB77BD9D40CFA8B996712101BEA0EC6346C54374F25BD"),
+		x: gostBigFromHex("2"),
+		y: gostBigFromHex("1A8F7EDA389B094C2C071E3647A8940F3C123B697578C213BE6DD9E6C8EC7335" +
+			"DCB228FD1EDF4A39152CBCAAF8C0398828041055F94CEEEC7E21340780FE41BD"),
+		size: 64,
+	}
+)
+
+// gostCurves определяет соответствие OID-ов наборов параметров ключа и кривых.
+var gostCurves = map[string]*gostCurve{
+	"1.2.643.2.2.35.1":    gostCurveCryptoProA,
+	"1.2.643.2.2.36.0":    gostCurveCryptoProA, // id-GostR3410-2001-CryptoPro-XchA-ParamSet
+	"1.2.643.7.1.2.1.1.2": gostCurveCryptoProA, // id-tc26-gost-3410-2012-256-paramSetB
+	"1.2.643.2.2.35.2":    gostCurveCryptoProB,
+	"1.2.643.7.1.2.1.1.3": gostCurveCryptoProB, // id-tc26-gost-3410-2012-256-paramSetC
+	"1.2.643.2.2.35.3":    gostCurveCryptoProC,
+	"1.2.643.2.2.36.1":    gostCurveCryptoProC, // id-GostR3410-2001-CryptoPro-XchB-ParamSet
+	"1.2.643.7.1.2.1.1.4": gostCurveCryptoProC, // id-tc26-gost-3410-2012-256-paramSetD
+	"1.2.643.7.1.2.1.1.1": gostCurveTC26256A,
+	"1.2.643.7.1.2.1.2.1": gostCurveTC26512A,
+	"1.2.643.7.1.2.1.2.2": gostCurveTC26512B,
+}
+
+// gostDefaultCurve возвращает кривую, используемую если набор параметров ключа не указан:
+// CryptoPro-A для 256 бит, tc26-512-A для 512 бит. Неизвестный набор параметров кривой по умолчанию
+// не заменяется (см. gostParsePublicKey).
+func gostDefaultCurve(size int) *gostCurve {
+	if size == gostCurveTC26512A.size {
+		return gostCurveTC26512A
+	}
+	return gostCurveCryptoProA
+}
+
+// gostPublicKeyParameters определяет параметры открытого ключа ГОСТ (RFC4491, RFC9215).
+//
+//	GostR3410-2001-PublicKeyParameters ::= SEQUENCE {
+//	  publicKeyParamSet   OBJECT IDENTIFIER,
+//	  digestParamSet      OBJECT IDENTIFIER OPTIONAL,
+//	  encryptionParamSet  OBJECT IDENTIFIER OPTIONAL }
+type gostPublicKeyParameters struct {
+	PublicKeyParamSet  asn1.ObjectIdentifier
+	DigestParamSet     asn1.ObjectIdentifier `asn1:"optional"`
+	EncryptionParamSet asn1.ObjectIdentifier `asn1:"optional"`
+}
+
+// gostSubjectPublicKeyInfo определяет структуру SubjectPublicKeyInfo сертификата.
+type gostSubjectPublicKeyInfo struct {
+	Algorithm struct {
+		Algorithm  asn1.ObjectIdentifier
+		Parameters asn1.RawValue `asn1:"optional"`
+	}
+	PublicKey asn1.BitString
+}
+
+// gostPoint точка эллиптической кривой в аффинных координатах (nil - бесконечно удаленная точка).
+type gostPoint struct {
+	x, y *big.Int
+}
+
+// gostParsePublicKey разбирает открытый ключ ГОСТ размером size байт из сертификата.
+// Кривая определяется набором параметров ключа (gostCurves), если он не указан - размером ключа
+// (gostDefaultCurve). Для неизвестного набора параметров возвращается ошибка.
+// Возвращает кривую и точку открытого ключа.
+func gostParsePublicKey(cert *x509.Certificate, size int) (*gostCurve, *gostPoint, error) {
+	var spki gostSubjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode GOST SubjectPublicKeyInfo: [%w]", err)
+	}
+
+	// определяем кривую по набору параметров
+	var paramSet asn1.ObjectIdentifier
+	params := spki.Algorithm.Parameters
+	switch {
+	case params.Class == asn1.ClassUniversal && params.Tag == asn1.TagSequence:
+		var pkParams gostPublicKeyParameters
+		if _, err := asn1.Unmarshal(params.FullBytes, &pkParams); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode GOST public key parameters: [%w]", err)
+		}
+		paramSet = pkParams.PublicKeyParamSet
+	case params.Class == asn1.ClassUniversal && params.Tag == asn1.TagOID:
+		if _, err := asn1.Unmarshal(params.FullBytes, &paramSet); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode GOST public key parameters: [%w]", err)
+		}
+	}
+	curve := gostDefaultCurve(size)
+	if len(paramSet) > 0 {
+		var found bool
+		if curve, found = gostCurves[paramSet.String()]; !found {
+			return nil, nil, fmt.Errorf("unsupported GOST public key parameter set: [%s]", paramSet.String())
+		}
+	}
+	if curve.size != size {
+		return nil, nil, fmt.Errorf("GOST public key size mismatch: [%s], [%d], [%d]", curve.name, curve.size, size)
+	}
+
+	// значение ключа упаковано в OCTET STRING
+	var raw []byte
+	if _, err := asn1.Unmarshal(spki.PublicKey.RightAlign(), &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode GOST public key: [%w]", err)
+	}
+	if len(raw) != 2*size {
+		return nil, nil, fmt.Errorf("invalid GOST public key size: [%d]", len(raw))
+	}
+	pub := &gostPoint{
+		x: new(big.Int).SetBytes(gostReverse(raw[:size])),
+		y: new(big.Int).SetBytes(gostReverse(raw[size:])),
+	}
+	if !curve.isOnCurve(pub) {
+		return nil, nil, errors.New("GOST public key is not on curve")
+	}
+	return curve, pub, nil
+}
+
+// gostVerify проверяет подпись ГОСТ signature над данными signed открытым ключом сертификата cert.
+func gostVerify(cert *x509.Certificate, alg *gostSignatureAlgorithm, signed, signature []byte) error {
+	if len(signature) != 2*alg.size {
+		return fmt.Errorf("invalid GOST signature size: [%d]", len(signature))
+	}
+	curve, pub, err := gostParsePublicKey(cert, alg.size)
+	if err != nil {
+		return err
+	}
+
+	// подпись: s || r
+	s := new(big.Int).SetBytes(signature[:alg.size])
+	r := new(big.Int).SetBytes(signature[alg.size:])
+
+	// значение хеша интерпретируется как число в little-endian
+	h := alg.newHash()
+	h.Write(signed)
+	return curve.verify(pub, new(big.Int).SetBytes(gostReverse(h.Sum(nil))), r, s)
+}
+
+// verify проверяет подпись (r, s) значения хеша alpha открытым ключом pub.
+func (c *gostCurve) verify(pub *gostPoint, alpha, r, s *big.Int) error {
+	if r.Sign() <= 0 || r.Cmp(c.q) >= 0 || s.Sign() <= 0 || s.Cmp(c.q) >= 0 {
+		return errors.New("invalid GOST signature: r or s out of range")
+	}
+
+	// e = alpha mod q, e = 1 если 0
+	e := new(big.Int).Mod(alpha, c.q)
+	if e.Sign() == 0 {
+		e.SetInt64(1)
+	}
+
+	// v = e^-1, z1 = s*v, z2 = -r*v (mod q)
+	v := new(big.Int).ModInverse(e, c.q)
+	z1 := new(big.Int).Mul(s, v)
+	z1.Mod(z1, c.q)
+	z2 := new(big.Int).Mul(r, v)
+	z2.Neg(z2).Mod(z2, c.q)
+
+	// C = z1*G + z2*Q, R = xC mod q
+	point := c.add(c.mul(&gostPoint{c.x, c.y}, z1), c.mul(pub, z2))
+	if point == nil {
+		return errors.New("invalid GOST signature")
+	}
+	if new(big.Int).Mod(point.x, c.q).Cmp(r) != 0 {
+		return errors.New("invalid GOST signature")
+	}
+	return nil
+}
+
+// gostReverse возвращает копию среза с обратным порядком байтов.
+func gostReverse(in []byte) []byte {
+	out := slices.Clone(in)
+	slices.Reverse(out)
+	return out
+}
+
+// isOnCurve проверяет принадлежность точки кривой.
+func (c *gostCurve) isOnCurve(pt *gostPoint) bool {
+	if pt.x.Sign() < 0 || pt.x.Cmp(c.p) >= 0 || pt.y.Sign() < 0 || pt.y.Cmp(c.p) >= 0 {
+		return false
+	}
+	// y^2 - x^3 - a*x - b = 0 (mod p)
+	left := new(big.Int).Mul(pt.y, pt.y)
+	right := new(big.Int).Mul(pt.x, pt.x)
+	right.Add(right, c.a).Mul(right, pt.x).Add(right, c.b)
+	return left.Sub(left, right).Mod(left, c.p).Sign() == 0
+}
+
+// add выполняет сложение точек кривой.
+func (c *gostCurve) add(p1, p2 *gostPoint) *gostPoint {
+	if p1 == nil {
+		return p2
+	}
+	if p2 == nil {
+		return p1
+	}
+
+	var lambda *big.Int
+	if p1.x.Cmp(p2.x) == 0 {
+		sum := new(big.Int).Add(p1.y, p2.y)
+		if sum.Mod(sum, c.p).Sign() == 0 {
+			return nil
+		}
+		// удвоение: lambda = (3*x^2 + a) / (2*y)
+		num := new(big.Int).Mul(p1.x, p1.x)
+		num.Mul(num, big.NewInt(3)).Add(num, c.a)
+		den := new(big.Int).Lsh(p1.y, 1)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, c.p), c.p))
+	} else {
+		// lambda = (y2 - y1) / (x2 - x1)
+		num := new(big.Int).Sub(p2.y, p1.y)
+		den := new(big.Int).Sub(p2.x, p1.x)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, c.p), c.p))
+	}
+	lambda.Mod(lambda, c.p)
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, p1.x).Sub(x, p2.x).Mod(x, c.p)
+	y := new(big.Int).Sub(p1.x, x)
+	y.Mul(y, lambda).Sub(y, p1.y).Mod(y, c.p)
+	return &gostPoint{x, y}
+}
+
+// mul выполняет умножение точки кривой на скаляр k.
+func (c *gostCurve) mul(pt *gostPoint, k *big.Int) *gostPoint {
+	var out *gostPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		out = c.add(out, out)
+		if k.Bit(i) == 1 {
+			out = c.add(out, pt)
+		}
+	}
+	return out
+}
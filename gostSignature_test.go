@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"hash"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestGostCurveVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		curve  *gostCurve
+		xq, yq string // открытый ключ
+		alpha  string // значение хеша как число
+		r, s   string
+	}{
+		{
+			// ГОСТ Р 34.10-2001, RFC7091 раздел 7.1 (тестовая кривая, 256 бит)
+			name:  "256",
+			curve: testGostCurve256,
+			xq:    "7F2B49E270DB6D90D8595BEC458B50C58585BA1D4E9B788F6689DBD8E56FD80B",
+			yq:    "26F1B489D6701DD185C8413A977B3CBBAF64D1C593D26627DFFB101A87FF77DA",
+			alpha: "2DFBC1B372D89A1188C09C52E0EEC61FCE52032AB1022E8E67ECE6672B043EE5",
+			r:     "41AA28D2F1AB148280CD9ED56FEDA41974053554A42767B83AD043FD39DC0493",
+			s:     "01456C64BA4642A1653C235A98A60249BCD6D3F746B631DF928014F6C5BF9C40",
+		},
+		{
+			// ГОСТ Р 34.10-2012, RFC7091 раздел 7.2 (тестовая кривая, 512 бит)
+			name: "512",
+			curve: &gostCurve{
+				name: "test-512",
+				p: gostBigFromHex("4531ACD1FE0023C7550D267B6B2FEE80922B14B2FFB90F04D4EB7C09B5D2D15D" +
+					"F1D852741AF4704A0458047E80E4546D35B8336FAC224DD81664BBF528BE6373"),
+				a: gostBigFromHex("7"),
+				b: gostBigFromHex("1CFF0806A31116DA29D8CFA54E57EB748BC5F377E49400FDD788B649ECA1AC43" +
+					"61834013B2AD7322480A89CA58E0CF74BC9E540C2ADD6897FAD0A3084F302ADC"),
+				q: gostBigFromHex("4531ACD1FE0023C7550D267B6B2FEE80922B14B2FFB90F04D4EB7C09B5D2D15D" +
+					"A82F2D7ECB1DBAC719905C5EECC423F1D86E25EDBE23C595D644AAF187E6E6DF"),
+				x: gostBigFromHex("24D19CC64572EE30F396BF6EBBFD7A6C5213B3B3D7057CC825F91093A68CD762" +
+					"FD60611262CD838DC6B60AA7EEE804E28BC849977FAC33B4B530F1B120248A9A"),
+				y: gostBigFromHex("2BB312A43BD2CE6E0D020613C857ACDDCFBF061E91E5F2C3F32447C259F39B2C" +
+					"83AB156D77F1496BF7EB3351E1EE4E43DC1A18B91B24640B6DBB92CB1ADD371E"),
+				size: 64,
+			},
+			xq: "115DC5BC96760C7B48598D8AB9E740D4C4A85A65BE33C1815B5C320C854621DD" +
+				"5A515856D13314AF69BC5B924C8B4DDFF75C45415C1D9DD9DD33612CD530EFE1",
+			yq: "37C7C90CD40B0F5621DC3AC1B751CFA0E2634FA0503B3D52639F5D7FB72AFD61" +
+				"EA199441D943FFE7F0C70A2759A3CDB84C114E1F9339FDF27F35ECA93677BEEC",
+			alpha: "3754F3CFACC9E0615C4F4A7C4D8DAB531B09B6F9C170C533A71D147035B0C591" +
+				"7184EE536593F4414339976C647C5D5A407ADEDB1D560C4FC6777D2972075B8C",
+			r: "2F86FA60A081091A23DD795E1E3C689EE512A3C82EE0DCC2643C78EEA8FCACD3" +
+				"5492558486B20F1C9EC197C90699850260C93BCBCD9C5C3317E19344E173AE36",
+			s: "1081B394696FFE8E6585E7A9362D26B6325F56778AADBC081C0BFBE933D52FF5" +
+				"823CE288E8C4F362526080DF7F70CE406A6EEB1F56919CB92A9853BDE73E5B4A",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &gostPoint{gostBigFromHex(tt.xq), gostBigFromHex(tt.yq)}
+			if !tt.curve.isOnCurve(pub) {
+				t.Fatal("public key is not on curve")
+			}
+			alpha, r, s := gostBigFromHex(tt.alpha), gostBigFromHex(tt.r), gostBigFromHex(tt.s)
+			if err := tt.curve.verify(pub, alpha, r, s); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+
+			// измененные хеш и подпись не должны проходить проверку
+			if err := tt.curve.verify(pub, new(big.Int).Add(alpha, big.NewInt(1)), r, s); err == nil {
+				t.Error("verify with modified digest succeeded")
+			}
+			if err := tt.curve.verify(pub, alpha, r, new(big.Int).Add(s, big.NewInt(1))); err == nil {
+				t.Error("verify with modified signature succeeded")
+			}
+			if err := tt.curve.verify(pub, alpha, r, tt.curve.q); err == nil {
+				t.Error("verify with s out of range succeeded")
+			}
+		})
+	}
+}
+
+// TestGostCurves проверяет параметры поддерживаемых кривых: базовая точка лежит на кривой и имеет порядок q.
+func TestGostCurves(t *testing.T) {
+	for oid, curve := range gostCurves {
+		g := &gostPoint{curve.x, curve.y}
+		if !curve.isOnCurve(g) {
+			t.Errorf("%s (%s): base point is not on curve", oid, curve.name)
+			continue
+		}
+		if curve.mul(g, curve.q) != nil {
+			t.Errorf("%s (%s): base point order is not q", oid, curve.name)
+		}
+	}
+}
+
+// OID набора параметров тестовой кривой RFC7091 раздел 7.1 (id-GostR3410-2001-TestParamSet, RFC4357)
+var oidGostTestParamSet = asn1.ObjectIdentifier{1, 2, 643, 2, 2, 35, 0}
+
+// testGostCurve256 тестовая кривая RFC7091 раздел 7.1.
+var testGostCurve256 = &gostCurve{
+	name: "id-GostR3410-2001-TestParamSet",
+	p:    gostBigFromHex("8000000000000000000000000000000000000000000000000000000000000431"),
+	a:    gostBigFromHex("7"),
+	b:    gostBigFromHex("5FBFF498AA938CE739B8E022FBAFEF40563F6E6A3472FC2A514C0CE9DAE23B7E"),
+	q:    gostBigFromHex("8000000000000000000000000000000150FE8A1892976154C59CFC193ACCF5B3"),
+	x:    gostBigFromHex("2"),
+	y:    gostBigFromHex("08E2A8A0E65147D4BD6316030E16D19C85C97F0A9CA267122B96ABBCEA7E8FC8"),
+	size: 32,
+}
+
+// testGostBytes возвращает значение v в big-endian размером size байт.
+func testGostBytes(v *big.Int, size int) []byte {
+	return v.FillBytes(make([]byte, size))
+}
+
+// testGostCertificate создает сертификат с открытым ключом ГОСТ Р 34.10-2012 256 бит с набором параметров
+// paramSet (не указывается, если nil) и значением ключа rawKey (содержимое OCTET STRING).
+// Подпись сертификата не проверяется и не вычисляется.
+func testGostCertificate(t *testing.T, paramSet asn1.ObjectIdentifier, rawKey []byte) *x509.Certificate {
+	t.Helper()
+	marshal := func(value any) []byte {
+		der, err := asn1.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyGostR34102012256}
+	if paramSet != nil {
+		algorithm.Parameters = asn1.RawValue{FullBytes: marshal(gostPublicKeyParameters{PublicKeyParamSet: paramSet})}
+	}
+	publicKey := marshal(rawKey)
+	spki := marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{algorithm, asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)}})
+
+	name := marshal(pkix.Name{CommonName: "test GOST"}.ToRDNSequence())
+	signatureAlgorithm := pkix.AlgorithmIdentifier{Algorithm: oidSignatureGostR34102012256}
+	tbs := marshal(struct {
+		Version            int `asn1:"explicit,tag:0"`
+		SerialNumber       *big.Int
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Issuer             asn1.RawValue
+		Validity           struct{ NotBefore, NotAfter time.Time }
+		Subject            asn1.RawValue
+		PublicKey          asn1.RawValue
+	}{
+		Version:            2,
+		SerialNumber:       big.NewInt(1),
+		SignatureAlgorithm: signatureAlgorithm,
+		Issuer:             asn1.RawValue{FullBytes: name},
+		Validity:           struct{ NotBefore, NotAfter time.Time }{time.Now().Add(-time.Hour).UTC(), time.Now().Add(time.Hour).UTC()},
+		Subject:            asn1.RawValue{FullBytes: name},
+		PublicKey:          asn1.RawValue{FullBytes: spki},
+	})
+	der := marshal(struct {
+		TBSCertificate     asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}{asn1.RawValue{FullBytes: tbs}, signatureAlgorithm, asn1.BitString{Bytes: make([]byte, 64), BitLength: 512}})
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testGostFixedHash - хеш, значение которого не зависит от данных (для проверки по значению хеша из RFC7091).
+type testGostFixedHash struct {
+	sum []byte
+}
+
+func (h *testGostFixedHash) Write(p []byte) (int, error) { return len(p), nil }
+func (h *testGostFixedHash) Sum(b []byte) []byte         { return append(b, h.sum...) }
+func (h *testGostFixedHash) Reset()                      {}
+func (h *testGostFixedHash) Size() int                   { return len(h.sum) }
+func (h *testGostFixedHash) BlockSize() int              { return 32 }
+
+// testGostSign вычисляет подпись (r, s) значения хеша alpha закрытым ключом d со случайным числом k
+// (ГОСТ Р 34.10-2012, раздел 6.1).
+func testGostSign(c *gostCurve, d, k, alpha *big.Int) (r, s *big.Int) {
+	e := new(big.Int).Mod(alpha, c.q)
+	if e.Sign() == 0 {
+		e.SetInt64(1)
+	}
+	r = new(big.Int).Mod(c.mul(&gostPoint{c.x, c.y}, k).x, c.q)
+	s = new(big.Int).Mul(r, d)
+	s.Add(s, new(big.Int).Mul(k, e)).Mod(s, c.q)
+	return r, s
+}
+
+// TestGostVerify проверяет подпись ГОСТ сертификатом (gostVerify и verifySignature) на примере RFC7091
+// раздел 7.1: ключ в сертификате - X || Y в little-endian, подпись - s || r, значение хеша - число
+// в little-endian.
+func TestGostVerify(t *testing.T) {
+	gostCurves[oidGostTestParamSet.String()] = testGostCurve256
+	defer delete(gostCurves, oidGostTestParamSet.String())
+
+	c := testGostCurve256
+	d := gostBigFromHex("7A929ADE789BB9BE10ED359DD39A72C11B60961F49397EEE1D19CE9891EC3B28")
+	k := gostBigFromHex("77105C9B20BCD3122823C8CF6FCC7B956DE33814E95B7FE64FED924594DCEAB3")
+	pub := &gostPoint{
+		gostBigFromHex("7F2B49E270DB6D90D8595BEC458B50C58585BA1D4E9B788F6689DBD8E56FD80B"),
+		gostBigFromHex("26F1B489D6701DD185C8413A977B3CBBAF64D1C593D26627DFFB101A87FF77DA"),
+	}
+	alpha := gostBigFromHex("2DFBC1B372D89A1188C09C52E0EEC61FCE52032AB1022E8E67ECE6672B043EE5")
+	r := gostBigFromHex("41AA28D2F1AB148280CD9ED56FEDA41974053554A42767B83AD043FD39DC0493")
+	s := gostBigFromHex("01456C64BA4642A1653C235A98A60249BCD6D3F746B631DF928014F6C5BF9C40")
+
+	// подпись тестовой функцией совпадает с примером RFC7091
+	if q := c.mul(&gostPoint{c.x, c.y}, d); q.x.Cmp(pub.x) != 0 || q.y.Cmp(pub.y) != 0 {
+		t.Fatal("public key does not match private key")
+	}
+	if gotR, gotS := testGostSign(c, d, k, alpha); gotR.Cmp(r) != 0 || gotS.Cmp(s) != 0 {
+		t.Fatalf("testGostSign = (%X, %X), want (%X, %X)", gotR, gotS, r, s)
+	}
+
+	keyLE := append(gostReverse(testGostBytes(pub.x, 32)), gostReverse(testGostBytes(pub.y, 32))...)
+	keyBE := append(testGostBytes(pub.x, 32), testGostBytes(pub.y, 32)...)
+	sr := append(testGostBytes(s, 32), testGostBytes(r, 32)...)
+	rs := append(testGostBytes(r, 32), testGostBytes(s, 32)...)
+	cert := testGostCertificate(t, oidGostTestParamSet, keyLE)
+
+	// алгоритм с хешем, равным значению alpha примера (хеш - число в little-endian)
+	alg := *gostSignatureAlgorithmByOID(oidSignatureGostR34102012256)
+	fixedHash := func(sum []byte) func() hash.Hash {
+		return func() hash.Hash { return &testGostFixedHash{sum} }
+	}
+	alg.newHash = fixedHash(gostReverse(testGostBytes(alpha, 32)))
+	bigEndianHashAlg := alg
+	bigEndianHashAlg.newHash = fixedHash(testGostBytes(alpha, 32))
+
+	tests := []struct {
+		name      string
+		cert      *x509.Certificate
+		alg       *gostSignatureAlgorithm
+		signature []byte
+		wantErr   bool
+	}{
+		{name: "RFC7091", cert: cert, alg: &alg, signature: sr},
+		{name: "r || s", cert: cert, alg: &alg, signature: rs, wantErr: true},
+		{name: "big-endian key", cert: testGostCertificate(t, oidGostTestParamSet, keyBE), alg: &alg, signature: sr, wantErr: true},
+		{name: "big-endian hash", cert: cert, alg: &bigEndianHashAlg, signature: sr, wantErr: true},
+		{name: "unknown parameter set", cert: testGostCertificate(t, asn1.ObjectIdentifier{1, 2, 3, 4}, keyLE), alg: &alg, signature: sr, wantErr: true},
+		// без набора параметров используется кривая CryptoPro-A, которой ключ не принадлежит
+		{name: "default curve", cert: testGostCertificate(t, nil, keyLE), alg: &alg, signature: sr, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := gostVerify(tt.cert, tt.alg, []byte("data"), tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("gostVerify() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+
+	// подпись данных с хешем ГОСТ Р 34.11-2012 (256 бит) проверяется verifySignature по OID алгоритма
+	t.Run("verifySignature", func(t *testing.T) {
+		signed := []byte("GOST R 34.10-2012 signed data")
+		h := newStreebog256()
+		h.Write(signed)
+		r, s := testGostSign(c, d, k, new(big.Int).SetBytes(gostReverse(h.Sum(nil))))
+		signature := append(testGostBytes(s, 32), testGostBytes(r, 32)...)
+
+		sigAlg := pkix.AlgorithmIdentifier{Algorithm: oidSignatureGostR34102012256}
+		if err := verifySignature(cert, sigAlg, signed, signature); err != nil {
+			t.Fatalf("verifySignature: %v", err)
+		}
+		if err := verifySignature(cert, sigAlg, bytes.ToUpper(signed), signature); err == nil {
+			t.Error("verifySignature with modified data succeeded")
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/hex"
+	"hash"
+	"strings"
+	"testing"
+)
+
+func TestStreebog(t *testing.T) {
+	// сообщение M2 из примера 2 RFC6986 в порядке байтов сообщения
+	m2, _ := hex.DecodeString("d1e520e2e5f2f0e82c20d1f2f0e8e1eee6e820e2edf3f6e82c20e2e5fef2fa20f120eceef0ff20f1f2f0e5ebe0ece820ede020f5f0e0e1f0fbff20efebfaeafb20c8e3eef0e5e2fb")
+
+	tests := []struct {
+		name    string
+		newHash func() hash.Hash
+		message []byte
+		digest  string
+	}{
+		// пустое сообщение
+		{"256 empty", newStreebog256, nil, "3f539a213e97c802cc229d474c6aa32a825a360b2a933a949fd925208d9ce1bb"},
+		{"512 empty", newStreebog512, nil, "8e945da209aa869f0455928529bcae4679e9873ab707b55315f56ceb98bef0a7362f715528356ee83cda5f2aac4c6ad2ba3a715c1bcd81cb8e9f90bf4c1c1a8a"},
+		// пример 1 RFC6986 (M1, 63 байта)
+		{"256 M1", newStreebog256, []byte("012345678901234567890123456789012345678901234567890123456789012"), "9d151eefd8590b89daa6ba6cb74af9275dd051026bb149a452fd84e5e57b5500"},
+		{"512 M1", newStreebog512, []byte("012345678901234567890123456789012345678901234567890123456789012"), "1b54d01a4af5b9d5cc3d86d68d285462b19abc2475222f35c085122be4ba1ffa00ad30f8767b3a82384c6574f024c311e2a481332b08ef7f41797891c1646f48"},
+		// пример 2 RFC6986 (M2, 72 байта)
+		{"256 M2", newStreebog256, m2, "9dd2fe4e90409e5da87f53976d7405b0c0cac628fc669a741d50063c557e8f50"},
+		{"512 M2", newStreebog512, m2, "1e88e62226bfca6f9994f1f2d51569e0daf8475a3b0fe61a5300eee46d961376035fe83549ada2b8620fcd7c496ce5b33f0cb9dddc2b6460143b03dabac9fb28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.newHash()
+			h.Write(tt.message)
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.digest {
+				t.Errorf("digest = %s, want %s", got, tt.digest)
+			}
+		})
+	}
+}
+
+// TestStreebogWrite проверяет, что результат не зависит от разбиения данных на части и от вызова Sum.
+func TestStreebogWrite(t *testing.T) {
+	message := []byte(strings.Repeat("0123456789", 20))
+
+	for _, newHash := range []func() hash.Hash{newStreebog256, newStreebog512} {
+		whole := newHash()
+		whole.Write(message)
+		want := whole.Sum(nil)
+
+		parts := newHash()
+		for i := 0; i < len(message); i += 13 {
+			parts.Write(message[i:min(i+13, len(message))])
+			parts.Sum(nil)
+		}
+		if got := parts.Sum(nil); hex.EncodeToString(got) != hex.EncodeToString(want) {
+			t.Errorf("digest = %x, want %x", got, want)
+		}
+	}
+}
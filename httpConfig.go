@@ -15,6 +15,10 @@ const (
 
 // httpConfig определяет структуру с настройками взаимодействия с HTTP сервером.
 type httpConfig struct {
+	// Name содержит имя цели мониторинга. Используется в протоколе и в метках метрик (target).
+	// Должно быть уникальным среди целей HTTP. Может быть не указано, если цель одна.
+	Name string `json:"name" yaml:"name"`
+
 	// Disabled флаг позволяет отключить опрос HTTP сервера при установке в значение true.
 	Disabled bool `json:"disabled" yaml:"disabled"`
 
@@ -43,6 +47,22 @@ type httpConfig struct {
 	MaxResponseSize *int64 `json:"maxresponsesize" yaml:"maxresponsesize"`
 }
 
+// TargetName возвращает имя цели мониторинга.
+func (cfg *httpConfig) TargetName() string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Name
+}
+
+// SetTargetName устанавливает имя цели мониторинга.
+func (cfg *httpConfig) SetTargetName(name string) {
+	if cfg == nil {
+		return
+	}
+	cfg.Name = name
+}
+
 // SetDefaults позволяет инициализировать не заданные/критичные поля значениями по умолчанию.
 func (cfg *httpConfig) SetDefaults() {
 	if cfg == nil {
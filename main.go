@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -52,6 +53,24 @@ type appContext struct {
 	Logger *zerolog.Logger
 	// Метрики.
 	Metrics *metrics
+	// Учет пройденных порогов предупреждений об истечении срока действия сертификатов.
+	CertExpiry *certExpiryTracker
+	// Кеш последних загруженных CRL (для сверки статусов сертификатов OCSP с CRL).
+	CRLCache *crlCache
+}
+
+// monitorHandle описывает запущенный монитор одной цели.
+type monitorHandle struct {
+	protocol protocolType
+	target   string
+	// канал, возвращенный функцией запуска монитора
+	channel <-chan error
+}
+
+// monitorStopResult содержит результат завершения монитора.
+type monitorStopResult struct {
+	monitorHandle
+	err error
 }
 
 func main() {
@@ -107,33 +126,85 @@ func main() {
 		appCtxSingleInstance.Metrics = newMetrics(prometheus.NewRegistry())
 	}
 
+	// кеш CRL общий для мониторов CRL и OCSP
+	appCtxSingleInstance.CRLCache = newCRLCache()
+	appCtxSingleInstance.CertExpiry = newCertExpiryTracker()
+
+	// доверенные сертификаты общего хранилища: сроки действия в метрики, истекшие - в протокол
+	if trust := getAppContext().Config.Trust.Certificates; len(trust) > 0 {
+		getAppContext().Logger.Log().Int("count", len(trust)).Msg("trust store loaded")
+		for _, cert := range trust {
+			if time.Now().After(cert.NotAfter) {
+				getAppContext().Logger.Log().Str("subject", cert.Subject.String()).
+					Time("notAfter", cert.NotAfter).Msg("trusted certificate expired")
+			}
+		}
+		getAppContext().Metrics.TrustCertificates(trust)
+	}
+
 	// создаем контекст, при отмене которого завершатся goroutine-ы мониторов
 	exitCtx, exitCtxCancel := context.WithCancel(context.Background())
 	defer exitCtxCancel()
 
-	// запускаем горутины мониторов и сервер
-	var ocspChannel, tspChannel, httpChannel, srvMetricsChannel <-chan error
+	// запускаем горутины мониторов (по одной на каждую цель) и сервер
+	var monitors []monitorHandle
+	var srvMetricsChannel <-chan error
+
+	for _, cfg := range getAppContext().Config.OCSP {
+		if cfg.Disabled {
+			getAppContext().Logger.Log().Str("target", cfg.Name).Msg("OCSP disabled")
+			continue
+		}
+		// сертификат издателя загружается по AIA при проверках, см. ocspCertConfig.resolveIssuer
+		if cfg.URLDiscovered {
+			getAppContext().Logger.Log().Str("target", cfg.Name).Str("url", cfg.URL).Msg("OCSP discovered from AIA")
+			getAppContext().Metrics.OCSPDiscovery(cfg.Name, cfg.URL, "")
+		}
+		// по монитору на каждый способ отправки запросов
+		for _, method := range cfg.MethodValues {
+			monitors = append(monitors, monitorHandle{protoOCSP, cfg.Name, probeMonitorStart(exitCtx, &ocspProber{cfg, method})})
+		}
+	}
 
-	if !getAppContext().Config.OCSP.Disabled {
-		ocspChannel = ocspMonitorStart(exitCtx)
-	} else {
-		getAppContext().Logger.Log().Msg("OCSP disabled")
+	for _, cfg := range getAppContext().Config.TSP {
+		if cfg.Disabled {
+			getAppContext().Logger.Log().Str("target", cfg.Name).Msg("TSP disabled")
+			continue
+		}
+		monitors = append(monitors, monitorHandle{protoTSP, cfg.Name, probeMonitorStart(exitCtx, &tspProber{cfg})})
 	}
 
-	if !getAppContext().Config.TSP.Disabled {
-		tspChannel = tspMonitorStart(exitCtx)
-	} else {
-		getAppContext().Logger.Log().Msg("TSP disabled")
+	for _, cfg := range getAppContext().Config.HTTP {
+		if cfg.Disabled {
+			getAppContext().Logger.Log().Str("target", cfg.Name).Msg("HTTP disabled")
+			continue
+		}
+		monitors = append(monitors, monitorHandle{protoHTTP, cfg.Name, probeMonitorStart(exitCtx, &httpProber{cfg})})
 	}
 
-	if !getAppContext().Config.HTTP.Disabled {
-		httpChannel = httpMonitorStart(exitCtx)
-	} else {
-		getAppContext().Logger.Log().Msg("HTTP disabled")
+	for _, cfg := range getAppContext().Config.CRL {
+		if cfg.Disabled {
+			getAppContext().Logger.Log().Str("target", cfg.Name).Msg("CRL disabled")
+			continue
+		}
+		if cfg.URLDiscovered {
+			getAppContext().Logger.Log().Str("target", cfg.Name).
+				Str("url", cfg.URL).Str("deltaUrl", cfg.DeltaURL).
+				Msg("CRL discovered from certificate")
+		}
+		// полный и delta CRL проверяются отдельными мониторами с общими сведениями о номерах CRL
+		state := &crlState{}
+		monitors = append(monitors, monitorHandle{protoCRL, cfg.Name, probeMonitorStart(exitCtx, &crlProber{cfg, false, state})})
+		if cfg.Delta {
+			monitors = append(monitors, monitorHandle{protoCRL, cfg.Name + crlDeltaTargetSuffix, probeMonitorStart(exitCtx, &crlProber{cfg, true, state})})
+		}
 	}
 
-	// хотя бы один канал должен быть запущен
-	if ocspChannel == nil && tspChannel == nil && httpChannel == nil {
+	// проверки по запросу (/probe) выполняются только при включенном сервере метрик
+	probesEnabled := getAppContext().Config.Metrics.Enabled && len(getAppContext().Config.Modules) > 0
+
+	// хотя бы один монитор должен быть запущен (или должны быть доступны проверки по запросу)
+	if len(monitors) == 0 && !probesEnabled {
 		getAppContext().Logger.Log().Msg("nothing to do (all monitors disabled)")
 		exitCode = 5
 		return
@@ -146,6 +217,15 @@ func main() {
 		defer srvMetricStopFunc(shutdownDelay)
 	}
 
+	// собираем результаты завершения всех мониторов в один канал
+	monitorsChannel := make(chan monitorStopResult, len(monitors))
+	for _, m := range monitors {
+		go func(m monitorHandle) {
+			monitorsChannel <- monitorStopResult{m, <-m.channel}
+		}(m)
+	}
+	runningMonitors := len(monitors)
+
 	// останов утилиты может быть выполнен по Ctrl+c - для этого обработаем системный сигнал
 	osChannel := make(chan os.Signal, 1)
 	signal.Notify(osChannel, os.Interrupt, syscall.SIGTERM)
@@ -155,25 +235,16 @@ func main() {
 
 	for {
 		select {
-		case stopError = <-ocspChannel:
-			ocspChannel = nil
-			if stopError != nil {
-				stopError = fmt.Errorf("OCSP failed: [%w]", stopError)
-				exitCode = 7
-			}
-
-		case stopError = <-tspChannel:
-			tspChannel = nil
-			if stopError != nil {
-				stopError = fmt.Errorf("TSP failed: [%w]", stopError)
-				exitCode = 8
-			}
-
-		case stopError = <-httpChannel:
-			httpChannel = nil
-			if stopError != nil {
-				stopError = fmt.Errorf("HTTP failed: [%w]", stopError)
-				exitCode = 8
+		case result := <-monitorsChannel:
+			runningMonitors--
+			if result.err != nil {
+				stopError = fmt.Errorf("%s [%s] failed: [%w]", strings.ToUpper(string(result.protocol)), result.target, result.err)
+				switch result.protocol {
+				case protoOCSP:
+					exitCode = 7
+				default:
+					exitCode = 8
+				}
 			}
 
 		case stopError = <-srvMetricsChannel:
@@ -184,7 +255,7 @@ func main() {
 			exitCtxCancel()
 			exitCode = 0
 		}
-		if (ocspChannel == nil && tspChannel == nil && httpChannel == nil) || (stopError != nil || exitCtx.Err() != nil) {
+		if (runningMonitors == 0 && !probesEnabled) || (stopError != nil || exitCtx.Err() != nil) {
 			break
 		}
 	}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// TestMain создает контекст приложения для тестов (без конфигурации, протокол не пишется).
+func TestMain(m *testing.M) {
+	logger := zerolog.Nop()
+	appCtxSingleInstance = &appContext{
+		Logger:   &logger,
+		CRLCache: newCRLCache(),
+	}
+	os.Exit(m.Run())
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
 	"errors"
+	"math/big"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,6 +22,12 @@ import (
   Функции и определения, относящиеся к мониторингу через prometheus
 */
 
+// значения метки result метрики probes_total
+const (
+	probeResultSuccess = "success"
+	probeResultFailure = "failure"
+)
+
 // startMetricsServer создает, иницилизирует и запускает HTTP сервер
 // предоставления статистики. Для корректной остановки сервера следует
 // вызывать возвращаемую функцию останова, с указанием таймаута останова.
@@ -30,10 +42,13 @@ func startMetricsServer() (stopFunc func(time.Duration), failureChannel <-chan e
 		Str("address", getAppContext().Config.Metrics.Address).
 		Str("path", "/metrics").Logger()
 
-	// создаем новый mux, которй будет обслуживать только один маршрут
-	// с зарезервированным путем
+	// создаем новый mux, которй будет обслуживать маршрут с метриками и,
+	// если настроены модули проверок, маршрут выполнения проверок по запросу
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", getAppContext().Metrics.Handler())
+	if len(getAppContext().Config.Modules) > 0 {
+		mux.HandleFunc("/probe", probeHandler)
+	}
 
 	// создаем экземпляр сервера
 	srv := &http.Server{
@@ -82,12 +97,84 @@ type metrics struct {
 	registry *prometheus.Registry
 
 	// Вектор гистограмм времени обработки запросов (здесь от отправки запроса до получения ответа),
-	// разделенный по протоколу.
+	// разделенный по протоколу и цели мониторинга.
 	requestProcessingTimes *prometheus.HistogramVec
 
-	// Вектор счетчиков ошибок, разделенный по протоколу и типу
+	// Вектор гистограмм длительностей этапов обработки запросов (DNS, соединение, TLS, первый байт ответа,
+	// чтение тела ответа), разделенный по протоколу, цели мониторинга, HTTP методу и этапу.
+	requestPhaseTimes *prometheus.HistogramVec
+
+	// Вектор счетчиков ошибок, разделенный по протоколу, цели мониторинга, HTTP методу и типу
 	responseErrors *prometheus.CounterVec
 
+	// Вектор счетчиков ошибок проверки ответа с уточненной причиной (например, ошибки цепочки сертификатов),
+	// разделенный по протоколу, цели мониторинга, HTTP методу, типу ошибки и причине
+	responseErrorReasons *prometheus.CounterVec
+
+	// Вектор счетчиков сетевых ошибок (тип net), разделенный по протоколу, цели мониторинга, HTTP методу и классу ошибки
+	networkErrors *prometheus.CounterVec
+
+	// Вектор счетчиков выполненных проверок (запросов), разделенный по протоколу, цели мониторинга, HTTP методу и результату
+	probesTotal *prometheus.CounterVec
+
+	// Вектор времени последней успешной проверки, разделенный по протоколу, цели мониторинга и HTTP методу
+	lastSuccessTimestamp *prometheus.GaugeVec
+
+	// Вектор результатов последней проверки (1 - успешно, 0 - ошибка), разделенный по протоколу, цели мониторинга и HTTP методу
+	probeUp *prometheus.GaugeVec
+
+	// Вектор статусов сертификатов в ответах OCSP сервера, разделенный по цели мониторинга, HTTP методу, сертификату и статусу.
+	// Для текущего статуса значение 1, для остальных - 0.
+	ocspCertStatus *prometheus.GaugeVec
+
+	// Вектор результатов проверки статусов сертификатов в последнем OCSP ответе (1 - статус найден,
+	// совпадает с ожидаемым и актуален, 0 - иначе), разделенный по цели мониторинга, HTTP методу и сертификату.
+	ocspCertUp *prometheus.GaugeVec
+
+	// Вектор возраста последнего OCSP ответа (producedAt, thisUpdate), разделенный по цели мониторинга, HTTP методу и полю ответа.
+	ocspResponseAge *prometheus.GaugeVec
+
+	// Вектор оставшегося времени актуальности последнего OCSP ответа (до nextUpdate), разделенный по цели мониторинга и HTTP методу.
+	ocspResponseValidity *prometheus.GaugeVec
+
+	// Вектор расхождения времени TSA с локальным временем, разделенный по цели мониторинга.
+	tspClockSkew *prometheus.GaugeVec
+
+	// Вектор счетчиков статусов OCSP ответов (OCSPResponseStatus), разделенный по цели мониторинга, HTTP методу и статусу.
+	ocspStatusTotal *prometheus.CounterVec
+
+	// Вектор счетчиков статусов TSP ответов (PKIStatus), разделенный по цели мониторинга, статусу и битам failInfo.
+	tspStatusTotal *prometheus.CounterVec
+
+	// Вектор для индикации способа авторизации OCSP сервера последнего ответа и наличия в его сертификате
+	// расширения id-pkix-ocsp-nocheck, разделенный по цели мониторинга и HTTP методу.
+	ocspResponderInfo *prometheus.GaugeVec
+
+	// Вектор окончания срока действия сертификатов (Unix time NotAfter), разделенный по цели мониторинга,
+	// роли сертификата, субъекту и серийному номеру.
+	certNotAfter *prometheus.GaugeVec
+
+	// Вектор окончания срока действия доверенных сертификатов (секция trust), разделенный по субъекту,
+	// серийному номеру и признаку корневого (самоподписанного) сертификата
+	trustCertNotAfter *prometheus.GaugeVec
+
+	// Вектор для индикации URL-ов, полученных из расширения AIA сертификата OCSP цели мониторинга.
+	ocspDiscoveryInfo *prometheus.GaugeVec
+
+	// Вектор результата сверки статуса сертификата из OCSP ответа с CRL, разделенный по цели мониторинга,
+	// HTTP методу и сертификату
+	ocspRevocationMismatch *prometheus.GaugeVec
+
+	// Векторы размера, количества записей, номера и времени до nextUpdate последнего загруженного CRL,
+	// разделенные по цели мониторинга
+	crlSize       *prometheus.GaugeVec
+	crlEntries    *prometheus.GaugeVec
+	crlNumber     *prometheus.GaugeVec
+	crlNextUpdate *prometheus.GaugeVec
+
+	// Общий результат проверки, выполняемой по запросу к /probe (только для метрик, созданных newProbeMetrics)
+	probeSuccess prometheus.Gauge
+
 	// Вектор для индикации информации о сборке
 	buildInfo *prometheus.GaugeVec
 
@@ -110,25 +197,16 @@ func newMetrics(registry *prometheus.Registry) *metrics {
 	}
 	factory := promauto.With(registerer)
 
-	// регистрируем
-	out.requestProcessingTimes = factory.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: "ncatos",
-			Name:      "requests_processing_time",
-			Help:      "Amount of time spent processing HTTP requests (seconds), partitioned by protocol (ocsp|tsp).",
-			// Здесь можно определить другой набор Bucket-ов: Buckets []float64
-			// По умолчанию используется prometheus.DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
-		},
-		[]string{"protocol"},
-	)
+	// регистрируем метрики проверок и метрики приложения
+	out.registerProbeMetrics(factory)
 
-	out.responseErrors = factory.NewCounterVec(
-		prometheus.CounterOpts{
+	out.trustCertNotAfter = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
 			Namespace: "ncatos",
-			Name:      "responses_errors",
-			Help:      "How many requests failed, partitioned by protocol (ocsp|tsp) and type (net|http|asn1|contents).",
+			Name:      "trust_cert_not_after_seconds",
+			Help:      "Unix time of trusted certificate expiration (NotAfter), partitioned by subject, serial number (hex) and root flag (true for self-signed certificates).",
 		},
-		[]string{"protocol", "errorType"},
+		[]string{"subject", "serial", "root"},
 	)
 
 	out.buildInfo = factory.NewGaugeVec(
@@ -149,23 +227,6 @@ func newMetrics(registry *prometheus.Registry) *metrics {
 		[]string{"hash"},
 	)
 
-	// обратимся к зарегистрированным элемента векторов - таким образом зададим их нулевое значение
-	out.requestProcessingTimes.WithLabelValues(string(protoOCSP))
-	out.responseErrors.WithLabelValues(string(protoOCSP), string(responseErrorNet))
-	out.responseErrors.WithLabelValues(string(protoOCSP), string(responseErrorHTTP))
-	out.responseErrors.WithLabelValues(string(protoOCSP), string(responseErrorAsn))
-	out.responseErrors.WithLabelValues(string(protoOCSP), string(responseErrorContents))
-
-	out.requestProcessingTimes.WithLabelValues(string(protoTSP))
-	out.responseErrors.WithLabelValues(string(protoTSP), string(responseErrorNet))
-	out.responseErrors.WithLabelValues(string(protoTSP), string(responseErrorHTTP))
-	out.responseErrors.WithLabelValues(string(protoTSP), string(responseErrorAsn))
-	out.responseErrors.WithLabelValues(string(protoTSP), string(responseErrorContents))
-
-	out.requestProcessingTimes.WithLabelValues(string(protoHTTP))
-	out.responseErrors.WithLabelValues(string(protoHTTP), string(responseErrorNet))
-	out.responseErrors.WithLabelValues(string(protoHTTP), string(responseErrorHTTP))
-
 	out.buildInfo.WithLabelValues(AppVersion, BuildTimeStamp).Add(1)
 
 	out.configInfo.WithLabelValues(ConfigHash).Add(1)
@@ -173,33 +234,533 @@ func newMetrics(registry *prometheus.Registry) *metrics {
 	return out
 }
 
+// newProbeMetrics создает объект с метриками проверки, выполняемой по запросу к /probe, и регистрирует их
+// в реестре registry: регистрируются только метрики проверок (без метрик приложения, например build_info)
+// и общий результат проверки probe_success.
+func newProbeMetrics(registry *prometheus.Registry) *metrics {
+	out := &metrics{
+		registry: registry,
+	}
+	factory := promauto.With(registry)
+	out.registerProbeMetrics(factory)
+
+	out.probeSuccess = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "probe_success",
+			Help:      "Result of the probe requested via /probe. 1 - all probes of the module succeeded, 0 - otherwise (including failure to create a request).",
+		},
+	)
+	return out
+}
+
+// registerProbeMetrics регистрирует с помощью factory метрики проверок.
+func (ms *metrics) registerProbeMetrics(factory promauto.Factory) {
+	ms.requestProcessingTimes = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ncatos",
+			Name:      "requests_processing_time",
+			Help:      "Amount of time spent processing HTTP requests (seconds), partitioned by protocol (ocsp|tsp|http|crl), target name and HTTP method.",
+			// Здесь можно определить другой набор Bucket-ов: Buckets []float64
+			// По умолчанию используется prometheus.DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+		},
+		[]string{"protocol", "target", "method"},
+	)
+
+	ms.requestPhaseTimes = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ncatos",
+			Name:      "request_phase_duration_seconds",
+			Help:      "Duration of HTTP request phases (seconds), partitioned by protocol (ocsp|tsp|http|crl), target name, HTTP method and phase (dns|connect|tls|first_byte|body_read). Connection phases are absent for reused connections.",
+		},
+		[]string{"protocol", "target", "method", "phase"},
+	)
+
+	ms.responseErrors = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ncatos",
+			Name:      "responses_errors",
+			Help:      "How many requests failed, partitioned by protocol (ocsp|tsp|http|crl), target name, HTTP method and type (net|http|asn1|contents|signature).",
+		},
+		[]string{"protocol", "target", "method", "errorType"},
+	)
+
+	ms.responseErrorReasons = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ncatos",
+			Name:      "responses_error_reasons",
+			Help:      "How many requests failed with a specific validation error reason, partitioned by protocol (ocsp|tsp|http|crl), target name, HTTP method, type (asn1|contents|signature) and reason (tsa_eku|ess_missing|ess_mismatch|chain_issuer_not_found|chain_signature|chain_not_ca|chain_expired|chain_too_long|chain_untrusted|crl_issuer_not_found|crl_issuer_key_usage|crl_this_update|crl_next_update|crl_number|crl_delta|revocation_mismatch).",
+		},
+		[]string{"protocol", "target", "method", "errorType", "reason"},
+	)
+
+	ms.networkErrors = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ncatos",
+			Name:      "network_errors",
+			Help:      "How many requests failed with network error (errorType net), partitioned by protocol (ocsp|tsp|http|crl), target name, HTTP method and class (dns|connect_refused|timeout|tls|reset|body_too_large|other).",
+		},
+		[]string{"protocol", "target", "method", "class"},
+	)
+
+	ms.probesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ncatos",
+			Name:      "probes_total",
+			Help:      "How many probes (requests) were completed, partitioned by protocol (ocsp|tsp|http|crl), target name, HTTP method and result (success|failure).",
+		},
+		[]string{"protocol", "target", "method", "result"},
+	)
+
+	ms.lastSuccessTimestamp = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful probe, partitioned by protocol (ocsp|tsp|http|crl), target name and HTTP method. 0 - no successful probes yet.",
+		},
+		[]string{"protocol", "target", "method"},
+	)
+
+	ms.probeUp = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "probe_up",
+			Help:      "Result of the last probe, partitioned by protocol (ocsp|tsp|http|crl), target name and HTTP method. 1 - success, 0 - failure or no probes yet.",
+		},
+		[]string{"protocol", "target", "method"},
+	)
+
+	ms.ocspCertStatus = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_cert_status",
+			Help:      "Certificate status from the last decoded OCSP response, partitioned by target name, HTTP method, certificate name and status (good|revoked|unknown). 1 - current status, 0 - otherwise.",
+		},
+		[]string{"target", "method", "cert", "status"},
+	)
+
+	ms.ocspCertUp = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_cert_up",
+			Help:      "Result of certificate status check in the last decoded OCSP response, partitioned by target name, HTTP method and certificate name. 1 - status found, expected and fresh, 0 - otherwise.",
+		},
+		[]string{"target", "method", "cert"},
+	)
+
+	ms.ocspResponseAge = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_response_age_seconds",
+			Help:      "Age of the last decoded OCSP response (seconds), partitioned by target name, HTTP method and response field (producedAt|thisUpdate).",
+		},
+		[]string{"target", "method", "field"},
+	)
+
+	ms.ocspResponseValidity = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_response_validity_seconds",
+			Help:      "Remaining validity of the last decoded OCSP response until nextUpdate (seconds), partitioned by target name and HTTP method. Absent if response has no nextUpdate.",
+		},
+		[]string{"target", "method"},
+	)
+
+	ms.tspClockSkew = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "tsp_clock_skew_seconds",
+			Help:      "Difference between TSTInfo.genTime of the last decoded TSP response and local send/receive midpoint (seconds), partitioned by target name. Positive - TSA clock is ahead.",
+		},
+		[]string{"target"},
+	)
+
+	ms.ocspStatusTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_status_total",
+			Help:      "How many decoded OCSP responses had given OCSPResponseStatus, partitioned by target name, HTTP method and status (successful|malformedRequest|internalError|tryLater|sigRequired|unauthorized).",
+		},
+		[]string{"target", "method", "status"},
+	)
+
+	ms.tspStatusTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ncatos",
+			Name:      "tsp_status_total",
+			Help:      "How many decoded TSP responses had given PKIStatus, partitioned by target name, status (granted|grantedWithMods|rejection|waiting|...) and comma separated PKIFailureInfo bit names (empty if not set).",
+		},
+		[]string{"target", "status", "failinfo"},
+	)
+
+	ms.ocspResponderInfo = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_responder_info",
+			Help:      "Indicate authorization of the last decoded OCSP response signer, partitioned by target name, HTTP method, authorization (ca|delegated|pinned) and presence of id-pkix-ocsp-nocheck extension in responder certificate (true|false).",
+		},
+		[]string{"target", "method", "authorization", "nocheck"},
+	)
+
+	ms.certNotAfter = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "cert_not_after_seconds",
+			Help:      "Unix time of certificate expiration (NotAfter), partitioned by target name, certificate role (ocsp_cert|ocsp_responder|tsa), subject and serial number (hex).",
+		},
+		[]string{"target", "role", "subject", "serial"},
+	)
+
+	ms.ocspDiscoveryInfo = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_discovery_info",
+			Help:      "Indicate URLs discovered from certificate AIA extension, partitioned by target name, OCSP server URL and caIssuers URL (empty if not discovered or issuer certificate is not downloaded yet).",
+		},
+		[]string{"target", "url", "issuer_url"},
+	)
+
+	ms.ocspRevocationMismatch = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "ocsp_revocation_mismatch",
+			Help:      "Result of the last cross-check of OCSP certificate status against CRL (1 - status mismatch, 0 - consistent), partitioned by target name, HTTP method and certificate name. Absent if the check was not performed.",
+		},
+		[]string{"target", "method", "cert"},
+	)
+
+	ms.crlSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "crl_size_bytes",
+			Help:      "Size of the last downloaded CRL (bytes), partitioned by target name (delta CRL targets have _delta suffix).",
+		},
+		[]string{"target"},
+	)
+
+	ms.crlEntries = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "crl_entries",
+			Help:      "Number of revoked certificate entries in the last downloaded CRL, partitioned by target name.",
+		},
+		[]string{"target"},
+	)
+
+	ms.crlNumber = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "crl_number",
+			Help:      "CRL number of the last downloaded CRL, partitioned by target name. Numbers above 2^53 (not exactly representable as float64) are clamped to 2^53.",
+		},
+		[]string{"target"},
+	)
+
+	ms.crlNextUpdate = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ncatos",
+			Name:      "crl_next_update_seconds",
+			Help:      "Time left until nextUpdate of the last downloaded CRL (seconds, negative if passed), partitioned by target name.",
+		},
+		[]string{"target"},
+	)
+}
+
+// InitTarget задает нулевые значения метрик для указанного протокола, цели мониторинга и HTTP метода.
+// Следует вызывать при запуске монитора, чтобы метрики были доступны до первой ошибки.
+func (ms *metrics) InitTarget(p protocolType, target, method string) {
+	if ms == nil || ms.requestProcessingTimes == nil || ms.responseErrors == nil {
+		return
+	}
+
+	// обратимся к зарегистрированным элемента векторов - таким образом зададим их нулевое значение
+	ms.requestProcessingTimes.WithLabelValues(string(p), target, method)
+	ms.responseErrors.WithLabelValues(string(p), target, method, string(responseErrorNet))
+	ms.responseErrors.WithLabelValues(string(p), target, method, string(responseErrorHTTP))
+	if p != protoHTTP {
+		ms.responseErrors.WithLabelValues(string(p), target, method, string(responseErrorAsn))
+		ms.responseErrors.WithLabelValues(string(p), target, method, string(responseErrorContents))
+		ms.responseErrors.WithLabelValues(string(p), target, method, string(responseErrorSignature))
+	}
+	if ms.networkErrors != nil {
+		for _, class := range networkErrorClasses {
+			ms.networkErrors.WithLabelValues(string(p), target, method, class)
+		}
+	}
+	if ms.probesTotal != nil && ms.lastSuccessTimestamp != nil && ms.probeUp != nil {
+		ms.probesTotal.WithLabelValues(string(p), target, method, probeResultSuccess)
+		ms.probesTotal.WithLabelValues(string(p), target, method, probeResultFailure)
+		ms.lastSuccessTimestamp.WithLabelValues(string(p), target, method)
+		ms.probeUp.WithLabelValues(string(p), target, method)
+	}
+}
+
 // RequestProcessingTimeStart начинает отсчет времени обработки запроса по указанному
-// протоколу.
+// протоколу, цели мониторинга и HTTP методу.
 // Для останова необходимо вызвать возвращаемую функцию.
-func (ms *metrics) RequestProcessingTimeStart(p protocolType) func() {
+func (ms *metrics) RequestProcessingTimeStart(p protocolType, target, method string) func() {
 	if ms == nil || ms.requestProcessingTimes == nil {
 		return func() {}
 	}
 	processingTimeStart := time.Now()
 	return func() {
-		ms.requestProcessingTimes.WithLabelValues(string(p)).Observe(time.Since(processingTimeStart).Seconds())
+		ms.requestProcessingTimes.WithLabelValues(string(p), target, method).Observe(time.Since(processingTimeStart).Seconds())
 	}
 }
 
-// RequestProcessingTimeObserve позволяет непосредственно обновить метрику для выбранного протокола.
-func (ms *metrics) RequestProcessingTimeObserve(p protocolType, d time.Duration) {
+// RequestProcessingTimeObserve позволяет непосредственно обновить метрику для выбранного протокола, цели мониторинга и HTTP метода.
+func (ms *metrics) RequestProcessingTimeObserve(p protocolType, target, method string, d time.Duration) {
 	if ms == nil || ms.requestProcessingTimes == nil {
 		return
 	}
-	ms.requestProcessingTimes.WithLabelValues(string(p)).Observe(d.Seconds())
+	ms.requestProcessingTimes.WithLabelValues(string(p), target, method).Observe(d.Seconds())
 }
 
-// ResponseError позволяет увеличить счетчик ошибок для указанного протокола и типа ошибки.
-func (ms *metrics) ResponseError(p protocolType, et responseErrorType) {
+// RequestPhasesObserve позволяет учесть длительности этапов обработки запроса для выбранного протокола,
+// цели мониторинга и HTTP метода. Не выполнявшиеся этапы (с нулевой длительностью) не учитываются.
+func (ms *metrics) RequestPhasesObserve(p protocolType, target, method string, phases *networkPhases) {
+	if ms == nil || ms.requestPhaseTimes == nil || phases == nil {
+		return
+	}
+	for _, ph := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"dns", phases.DNS},
+		{"connect", phases.Connect},
+		{"tls", phases.TLSHandshake},
+		{"first_byte", phases.FirstByte},
+		{"body_read", phases.BodyRead},
+	} {
+		if ph.d > 0 {
+			ms.requestPhaseTimes.WithLabelValues(string(p), target, method, ph.name).Observe(ph.d.Seconds())
+		}
+	}
+}
+
+// NetworkError позволяет увеличить счетчик сетевых ошибок указанного класса для протокола, цели мониторинга
+// и HTTP метода. Общий счетчик ошибок и результат проверки обновляются ResponseError.
+func (ms *metrics) NetworkError(p protocolType, target, method, class string) {
+	if ms == nil || ms.networkErrors == nil {
+		return
+	}
+	ms.networkErrors.WithLabelValues(string(p), target, method, class).Inc()
+}
+
+// ResponseErrorReason позволяет увеличить счетчик ошибок проверки ответа с уточненной причиной reason
+// для протокола, цели мониторинга, HTTP метода и типа ошибки. Общий счетчик ошибок и результат проверки
+// обновляются ResponseError.
+func (ms *metrics) ResponseErrorReason(p protocolType, target, method string, et responseErrorType, reason string) {
+	if ms == nil || ms.responseErrorReasons == nil {
+		return
+	}
+	ms.responseErrorReasons.WithLabelValues(string(p), target, method, string(et), reason).Inc()
+}
+
+// ResponseError позволяет увеличить счетчик ошибок для указанного протокола, цели мониторинга, HTTP метода и типа ошибки.
+// Также учитывает неуспешную проверку (см. ProbeSuccess).
+func (ms *metrics) ResponseError(p protocolType, target, method string, et responseErrorType) {
 	if ms == nil || ms.responseErrors == nil {
 		return
 	}
-	ms.responseErrors.WithLabelValues(string(p), string(et)).Inc()
+	ms.responseErrors.WithLabelValues(string(p), target, method, string(et)).Inc()
+
+	if ms.probesTotal != nil && ms.probeUp != nil {
+		ms.probesTotal.WithLabelValues(string(p), target, method, probeResultFailure).Inc()
+		ms.probeUp.WithLabelValues(string(p), target, method).Set(0)
+	}
+}
+
+// ProbeSuccess позволяет учесть успешную проверку для указанного протокола, цели мониторинга и HTTP метода.
+func (ms *metrics) ProbeSuccess(p protocolType, target, method string) {
+	if ms == nil || ms.probesTotal == nil || ms.lastSuccessTimestamp == nil || ms.probeUp == nil {
+		return
+	}
+	ms.probesTotal.WithLabelValues(string(p), target, method, probeResultSuccess).Inc()
+	ms.lastSuccessTimestamp.WithLabelValues(string(p), target, method).SetToCurrentTime()
+	ms.probeUp.WithLabelValues(string(p), target, method).Set(1)
+}
+
+// ProbeResult позволяет установить общий результат проверки, выполняемой по запросу к /probe.
+func (ms *metrics) ProbeResult(success bool) {
+	if ms == nil || ms.probeSuccess == nil {
+		return
+	}
+	value := 0.0
+	if success {
+		value = 1
+	}
+	ms.probeSuccess.Set(value)
+}
+
+// OCSPInitCert задает нулевые значения метрик статуса сертификата cert цели мониторинга OCSP для HTTP метода method.
+func (ms *metrics) OCSPInitCert(target, method, cert string) {
+	if ms == nil || ms.ocspCertStatus == nil || ms.ocspCertUp == nil {
+		return
+	}
+	for _, s := range ocspCertStatuses {
+		ms.ocspCertStatus.WithLabelValues(target, method, cert, s.String())
+	}
+	ms.ocspCertUp.WithLabelValues(target, method, cert)
+}
+
+// OCSPCertStatus позволяет установить текущий статус и результат проверки сертификата для указанной
+// цели мониторинга OCSP и HTTP метода. Если статус сертификата не найден в ответе, то все статусы сбрасываются в 0.
+func (ms *metrics) OCSPCertStatus(target, method string, certInfo *ocspCertResponseInfo) {
+	if ms == nil || ms.ocspCertStatus == nil || ms.ocspCertUp == nil || certInfo == nil {
+		return
+	}
+	for _, s := range ocspCertStatuses {
+		value := 0.0
+		if certInfo.Found && s == certInfo.Status {
+			value = 1
+		}
+		ms.ocspCertStatus.WithLabelValues(target, method, certInfo.Name, s.String()).Set(value)
+	}
+	up := 0.0
+	if certInfo.Found && certInfo.Err == nil {
+		up = 1
+	}
+	ms.ocspCertUp.WithLabelValues(target, method, certInfo.Name).Set(up)
+}
+
+// OCSPResponseFreshness позволяет установить возраст и оставшееся время актуальности последнего
+// OCSP ответа для указанной цели мониторинга и HTTP метода. Значения thisUpdate и nextUpdate берутся
+// из статуса основного (первого) сертификата цели мониторинга.
+func (ms *metrics) OCSPResponseFreshness(target, method string, respInfo *ocspResponseInfo) {
+	if ms == nil || ms.ocspResponseAge == nil || ms.ocspResponseValidity == nil || respInfo == nil {
+		return
+	}
+	ms.ocspResponseAge.WithLabelValues(target, method, "producedAt").Set(respInfo.CheckTime.Sub(respInfo.ProducedAt).Seconds())
+	if len(respInfo.Certs) == 0 || !respInfo.Certs[0].Found {
+		ms.ocspResponseAge.DeleteLabelValues(target, method, "thisUpdate")
+		ms.ocspResponseValidity.DeleteLabelValues(target, method)
+		return
+	}
+	certInfo := &respInfo.Certs[0]
+	ms.ocspResponseAge.WithLabelValues(target, method, "thisUpdate").Set(respInfo.CheckTime.Sub(certInfo.ThisUpdate).Seconds())
+	if certInfo.NextUpdate.IsZero() {
+		ms.ocspResponseValidity.DeleteLabelValues(target, method)
+	} else {
+		ms.ocspResponseValidity.WithLabelValues(target, method).Set(certInfo.NextUpdate.Sub(respInfo.CheckTime).Seconds())
+	}
+}
+
+// TSPClockSkew позволяет установить расхождение времени TSA с локальным временем для указанной цели мониторинга.
+func (ms *metrics) TSPClockSkew(target string, skew time.Duration) {
+	if ms == nil || ms.tspClockSkew == nil {
+		return
+	}
+	ms.tspClockSkew.WithLabelValues(target).Set(skew.Seconds())
+}
+
+// OCSPResponseStatus позволяет учесть статус декодированного OCSP ответа для указанной цели мониторинга и HTTP метода.
+func (ms *metrics) OCSPResponseStatus(target, method string, status asn1.Enumerated) {
+	if ms == nil || ms.ocspStatusTotal == nil {
+		return
+	}
+	ms.ocspStatusTotal.WithLabelValues(target, method, ocspResponseStatusName(status)).Inc()
+}
+
+// TSPStatus позволяет учесть статус декодированного TSP ответа для указанной цели мониторинга.
+func (ms *metrics) TSPStatus(target string, si *tspPKIStatusInfo) {
+	if ms == nil || ms.tspStatusTotal == nil || si == nil {
+		return
+	}
+	ms.tspStatusTotal.WithLabelValues(target, tspResponseStatusName(si.Status), strings.Join(si.FailInfoNames(), ",")).Inc()
+}
+
+// OCSPResponder позволяет указать способ авторизации OCSP сервера и наличие в его сертификате расширения
+// id-pkix-ocsp-nocheck для указанной цели мониторинга и HTTP метода (ранее указанные значения удаляются).
+func (ms *metrics) OCSPResponder(target, method string, respInfo *ocspResponseInfo) {
+	if ms == nil || ms.ocspResponderInfo == nil || respInfo == nil {
+		return
+	}
+	ms.ocspResponderInfo.DeletePartialMatch(prometheus.Labels{"target": target, "method": method})
+	ms.ocspResponderInfo.WithLabelValues(target, method, respInfo.ResponderAuth, strconv.FormatBool(respInfo.ResponderNoCheck)).Set(1)
+}
+
+// CertNotAfter позволяет установить окончание срока действия сертификатов certs с ролью role для указанной
+// цели мониторинга. Ранее установленные значения для цели и роли удаляются (например, при смене сертификата
+// подписи сервера).
+func (ms *metrics) CertNotAfter(target, role string, certs ...*x509.Certificate) {
+	if ms == nil || ms.certNotAfter == nil {
+		return
+	}
+	ms.certNotAfter.DeletePartialMatch(prometheus.Labels{"target": target, "role": role})
+	for _, cert := range certs {
+		if cert == nil {
+			continue
+		}
+		ms.certNotAfter.WithLabelValues(target, role, cert.Subject.String(), cert.SerialNumber.Text(16)).Set(float64(cert.NotAfter.Unix()))
+	}
+}
+
+// TrustCertificates позволяет установить окончание срока действия доверенных сертификатов certs
+// (ранее установленные значения удаляются).
+func (ms *metrics) TrustCertificates(certs []*x509.Certificate) {
+	if ms == nil || ms.trustCertNotAfter == nil {
+		return
+	}
+	ms.trustCertNotAfter.Reset()
+	for _, cert := range certs {
+		root := bytes.Equal(cert.RawIssuer, cert.RawSubject)
+		ms.trustCertNotAfter.WithLabelValues(cert.Subject.String(), cert.SerialNumber.Text(16), strconv.FormatBool(root)).Set(float64(cert.NotAfter.Unix()))
+	}
+}
+
+// OCSPDiscovery позволяет указать URL OCSP сервера и URL сертификата издателя, полученные из расширения
+// AIA сертификата для указанной цели мониторинга OCSP. Пустая строка - URL не получался из AIA
+// (или сертификат издателя еще не загружен). Предыдущие значения цели мониторинга удаляются.
+func (ms *metrics) OCSPDiscovery(target, url, issuerURL string) {
+	if ms == nil || ms.ocspDiscoveryInfo == nil {
+		return
+	}
+	ms.ocspDiscoveryInfo.DeletePartialMatch(prometheus.Labels{"target": target})
+	ms.ocspDiscoveryInfo.WithLabelValues(target, url, issuerURL).Set(1)
+}
+
+// OCSPRevocationMismatch позволяет установить результат сверки статуса сертификата cert с CRL для указанной
+// цели мониторинга OCSP и HTTP метода. Если сверка не выполнена (checked равен false), то значение удаляется.
+func (ms *metrics) OCSPRevocationMismatch(target, method, cert string, checked, mismatch bool) {
+	if ms == nil || ms.ocspRevocationMismatch == nil {
+		return
+	}
+	if !checked {
+		ms.ocspRevocationMismatch.DeleteLabelValues(target, method, cert)
+		return
+	}
+	value := 0.0
+	if mismatch {
+		value = 1
+	}
+	ms.ocspRevocationMismatch.WithLabelValues(target, method, cert).Set(value)
+}
+
+// максимальный номер CRL, устанавливаемый в метрике crl_number (2^53, наибольшее целое,
+// до которого все целые точно представимы в float64)
+const crlNumberMaxExact int64 = 1 << 53
+
+// CRL позволяет установить размер size, количество записей, номер и время до nextUpdate (относительно
+// checkTime) загруженного CRL rl для указанной цели мониторинга. Номер и время до nextUpdate не
+// устанавливаются, если не указаны в CRL. Номера больше crlNumberMaxExact ограничиваются этим значением.
+func (ms *metrics) CRL(target string, size int, rl *x509.RevocationList, checkTime time.Time) {
+	if ms == nil || ms.crlSize == nil || ms.crlEntries == nil || ms.crlNumber == nil || ms.crlNextUpdate == nil {
+		return
+	}
+	ms.crlSize.WithLabelValues(target).Set(float64(size))
+	ms.crlEntries.WithLabelValues(target).Set(float64(len(rl.RevokedCertificateEntries)))
+	if rl.Number != nil {
+		// номер CRL (до 20 байт) точно представим в float64 только до 2^53, большие значения ограничиваем
+		number := float64(crlNumberMaxExact)
+		if rl.Number.Cmp(big.NewInt(crlNumberMaxExact)) < 0 {
+			number = float64(rl.Number.Int64())
+		}
+		ms.crlNumber.WithLabelValues(target).Set(number)
+	}
+	if !rl.NextUpdate.IsZero() {
+		ms.crlNextUpdate.WithLabelValues(target).Set(rl.NextUpdate.Sub(checkTime).Seconds())
+	}
 }
 
 // Handler возвращает HTTP обработчик для предоставления зарегистрированных метрик
@@ -3,9 +3,16 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -13,99 +20,203 @@ import (
   Реализация сетевого взаимодействия.
 */
 
+// Классы сетевых ошибок (см. networkErrorClass)
+const (
+	networkErrorDNS            = "dns"
+	networkErrorConnectRefused = "connect_refused"
+	networkErrorTimeout        = "timeout"
+	networkErrorTLS            = "tls"
+	networkErrorReset          = "reset"
+	networkErrorBodyTooLarge   = "body_too_large"
+	networkErrorOther          = "other"
+)
+
+// networkErrorClasses содержит все классы сетевых ошибок.
+var networkErrorClasses = []string{
+	networkErrorDNS, networkErrorConnectRefused, networkErrorTimeout, networkErrorTLS,
+	networkErrorReset, networkErrorBodyTooLarge, networkErrorOther,
+}
+
+// errResponseTooLarge возвращается sendRequest, если размер тела ответа превышает максимально допустимый.
+var errResponseTooLarge = errors.New("maximum response body size exceeded")
+
+// networkPhases содержит длительности этапов обработки HTTP запроса. Этапы установки соединения
+// (DNS, Connect, TLSHandshake) отсутствуют при повторном использовании соединения.
+type networkPhases struct {
+	// DNS время разрешения имени сервера (0 - этапа не было)
+	DNS time.Duration
+	// Connect время установки TCP соединения (0 - этапа не было)
+	Connect time.Duration
+	// TLSHandshake время установки TLS сессии (0 - этапа не было)
+	TLSHandshake time.Duration
+	// FirstByte время от отправки запроса до получения первого байта ответа (0 - ответ не получен)
+	FirstByte time.Duration
+	// BodyRead время чтения тела ответа (от получения заголовков ответа)
+	BodyRead time.Duration
+}
+
+// networkTrace собирает длительности этапов обработки HTTP запроса через httptrace.ClientTrace.
+// Обработчики трассировки могут вызываться из разных goroutine-н, поэтому доступ синхронизирован.
+type networkTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	phases       networkPhases
+}
+
+// clientTrace возвращает обработчики трассировки HTTP запроса. Перед отправкой запроса
+// должно быть установлено время отправки start.
+func (t *networkTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.phases.DNS = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			// при нескольких адресах сервера попытки соединения могут выполняться параллельно - учитываем первую
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			if err == nil && t.phases.Connect == 0 {
+				t.phases.Connect = time.Since(t.connectStart)
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.phases.TLSHandshake = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.phases.FirstByte = time.Since(t.start)
+			t.mu.Unlock()
+		},
+	}
+}
+
+// setBodyRead устанавливает время чтения тела ответа.
+func (t *networkTrace) setBodyRead(d time.Duration) {
+	t.mu.Lock()
+	t.phases.BodyRead = d
+	t.mu.Unlock()
+}
+
+// result возвращает собранные длительности этапов.
+func (t *networkTrace) result() networkPhases {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.phases
+}
+
+// networkErrorClass определяет класс сетевой ошибки err, возвращенной sendRequest:
+// dns, connect_refused, timeout, tls, reset, body_too_large или other.
+func networkErrorClass(err error) string {
+	var dnsError *net.DNSError
+	var netError net.Error
+	var recordHeaderError tls.RecordHeaderError
+	var alertError tls.AlertError
+	var certVerificationError *tls.CertificateVerificationError
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var certInvalidError x509.CertificateInvalidError
+
+	switch {
+	case errors.Is(err, errResponseTooLarge):
+		return networkErrorBodyTooLarge
+	case errors.As(err, &dnsError):
+		return networkErrorDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netError) && netError.Timeout():
+		return networkErrorTimeout
+	case errors.As(err, &recordHeaderError), errors.As(err, &alertError), errors.As(err, &certVerificationError),
+		errors.As(err, &unknownAuthorityError), errors.As(err, &hostnameError), errors.As(err, &certInvalidError):
+		return networkErrorTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return networkErrorConnectRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return networkErrorReset
+	}
+	return networkErrorOther
+}
+
 // netResult содержит результаты обработки сетевого запроса
 type networkResult struct {
 	// HTTP статус код
 	StatusCode int
 
+	// Время отправки запроса
+	SendTime time.Time
+
 	// Время обработки (от оправки запроса до чтения заголовков ответа)
 	SendReceiveTime time.Duration
 
+	// Длительности этапов обработки запроса
+	Phases networkPhases
+
 	// Тип содержимого
 	ContentType string
 
+	// Заголовки ответа
+	Header http.Header
+
 	// Тело ответа
 	Body []byte
 }
 
-// postRequest создает HTTP запрос с указанными данными, отправляет его серверу,
+// sendRequest создает HTTP запрос с указанными методом и данными, отправляет его серверу,
 // дожидается ответа и считывает тело ответа.
 //
-// Максимально считывается maxResponseSize байт ответа.
-func postRequest(ctx context.Context, client *http.Client, protocol protocolType, url string, maxSize int64, body []byte) (networkResult, error) {
-	// создаем объект под результат обработки
-	result := networkResult{}
+// Если contentType не пустая строка, то устанавливается соответствующий заголовок запроса.
+// Максимально считывается maxResponseSize байт ответа (при превышении возвращается errResponseTooLarge).
+// Длительности этапов обработки запроса сохраняются в результате даже при ошибке.
+func sendRequest(ctx context.Context, client *http.Client, method, url, contentType string, maxSize int64, body []byte) (result networkResult, err error) {
+	// трассировка этапов обработки запроса
+	var trace networkTrace
+	defer func() {
+		result.Phases = trace.result()
+	}()
 
 	// создаем HTTP запрос
-	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	var bodyReader io.Reader = http.NoBody
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpRequest, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace.clientTrace()), method, url, bodyReader)
 	if err != nil {
 		return result, fmt.Errorf("failed to create HTTP request: [%s], [%w]", url, err)
 	}
 
 	// устанавливаем заголовок
-	switch protocol {
-	case protoOCSP:
-		httpRequest.Header.Set("Content-Type", "application/ocsp-request")
-	case protoTSP:
-		httpRequest.Header.Set("Content-Type", "application/timestamp-query")
-	}
-
-	// отправляем ответ серверу и дожидаемся ответа (таймаут определен в клиенте)
-	// здесь же считаем статистику времени обработки запроса.
-	startTime := time.Now()
-	httpResponse, err := client.Do(httpRequest)
-	result.SendReceiveTime = time.Since(startTime)
-	if err != nil {
-		return result, fmt.Errorf("failed to post request: [%s], [%w]", url, err)
-	}
-
-	// в любом случае закрываем тело ответа
-	defer func() {
-		_ = httpResponse.Body.Close() //nolint:errcheck // ошибка закрытия тела ответа неважна в данном случае
-	}()
-
-	// запоминаем статус код и тип содержимого
-	result.StatusCode = httpResponse.StatusCode
-	result.ContentType = httpResponse.Header.Get("Content-Type")
-
-	// считываем тело с учетом максимального размера
-	if maxSize > 0 {
-		limitedReader := &io.LimitedReader{
-			R: httpResponse.Body,
-			N: maxSize,
-		}
-		result.Body, err = io.ReadAll(limitedReader)
-		if err == nil && limitedReader.N == 0 {
-			err = fmt.Errorf("maximum response body size exceeded: [%d]", maxSize)
-		}
-	} else {
-		result.Body, err = io.ReadAll(httpResponse.Body)
-	}
-
-	return result, err
-}
-
-// getRequest создает HTTP запрос с указанными данными, отправляет его серверу,
-// дожидается ответа и считывает тело ответа.
-//
-// Максимально считывается maxResponseSize байт ответа.
-func getRequest(ctx context.Context, client *http.Client, url string, maxSize int64) (networkResult, error) {
-	// создаем объект под результат обработки
-	result := networkResult{}
-
-	// создаем HTTP запрос
-	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
-	if err != nil {
-		return result, fmt.Errorf("failed to create HTTP request: [%s], [%w]", url, err)
+	if contentType != "" {
+		httpRequest.Header.Set("Content-Type", contentType)
 	}
 
 	// отправляем ответ серверу и дожидаемся ответа (таймаут определен в клиенте)
 	// здесь же считаем статистику времени обработки запроса.
-	startTime := time.Now()
+	result.SendTime = time.Now()
+	trace.start = result.SendTime
 	httpResponse, err := client.Do(httpRequest)
-	result.SendReceiveTime = time.Since(startTime)
+	result.SendReceiveTime = time.Since(result.SendTime)
 	if err != nil {
-		return result, fmt.Errorf("failed to get request: [%s], [%w]", url, err)
+		return result, fmt.Errorf("failed to send request: [%s], [%w]", url, err)
 	}
 
 	// в любом случае закрываем тело ответа
@@ -116,8 +227,10 @@ func getRequest(ctx context.Context, client *http.Client, url string, maxSize in
 	// запоминаем статус код и тип содержимого
 	result.StatusCode = httpResponse.StatusCode
 	result.ContentType = httpResponse.Header.Get("Content-Type")
+	result.Header = httpResponse.Header
 
 	// считываем тело с учетом максимального размера
+	bodyReadStart := time.Now()
 	if maxSize > 0 {
 		limitedReader := &io.LimitedReader{
 			R: httpResponse.Body,
@@ -125,11 +238,12 @@ func getRequest(ctx context.Context, client *http.Client, url string, maxSize in
 		}
 		result.Body, err = io.ReadAll(limitedReader)
 		if err == nil && limitedReader.N == 0 {
-			err = fmt.Errorf("maximum response body size exceeded: [%d]", maxSize)
+			err = fmt.Errorf("%w: [%d]", errResponseTooLarge, maxSize)
 		}
 	} else {
 		result.Body, err = io.ReadAll(httpResponse.Body)
 	}
+	trace.setBodyRead(time.Since(bodyReadStart))
 
 	return result, err
 }
@@ -3,204 +3,295 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
-// ocspMonitor представляет собой тело goroutine-ы, выполняющей мониторинг настроенного
-// в appContext.Config.OCSP сервера.
-// ctx - контекст по закрытии которого необходимо завершить работу goroutine-ы.
-// startupChannel - канал, который должен быть закрыт после корректной инциализации
-//
-//	goroutine-ы. При этом если при инициализации произошла ошибка, то она передается
-//	в канал. В противном случае в канале nil (или ничего).
-//
-// resultChannel - канал, с помощью которого отслеживается завершение goroutine-ы. Чтение из
-//
-//	данного канала разрешено только после закрытия startupChannel. В общем случае канал
-//	закрывается при отмене ctx. Единственная ошибка, приводящая к другому варианту завершения
-//	goroutine-ы - ошибка создания запроса (при генерации nonce, например).
-func ocspMonitorStart(ctx context.Context) <-chan error {
-	cfg := getAppContext().Config.OCSP
-	resultChannel := make(chan error, 1)
-
-	// создаем логгер для OCSP
-	ml := getAppContext().Logger.With().
-		Str("module", "monitor").Str("protocol", string(protoOCSP)).
-		Str("url", cfg.URL).Logger()
-
-	// создаем шаблон запроса
-	req := &ocspRequest{
-		TBSRequest: ocspTBSRequest{
-			RequestList: []ocspSingleRequest{
-				{
-					ReqCert: ocspCertID{
-						HashAlgorithm: pkix.AlgorithmIdentifier{
-							Algorithm:  cfg.DigestOIDValue,
-							Parameters: asn1.NullRawValue,
-						},
-						NameHash:      cfg.NameDigestValue,
-						IssuerKeyHash: cfg.KeyDigestValue,
-						SerialNumber:  cfg.Certificate.SerialNumber,
-					},
-				},
-			},
-		},
+// ocspProber реализует Probe для проверки OCSP сервера: запрашивает статус сертификата,
+// проверяет подпись и содержимое ответа.
+type ocspProber struct {
+	cfg *ocspConfig
+	// HTTP метод запросов (GET или POST)
+	method string
+}
+
+// Protocol возвращает тип проверки.
+func (p *ocspProber) Protocol() protocolType {
+	return protoOCSP
+}
+
+// Settings возвращает общие настройки проверки.
+func (p *ocspProber) Settings() probeSettings {
+	return probeSettings{
+		Name:            p.cfg.Name,
+		URL:             p.cfg.URL,
+		Method:          p.method,
+		Timeout:         p.cfg.TimeoutValue,
+		MaxResponseSize: *p.cfg.MaxResponseSize,
+		RetryCount:      p.cfg.RetryCount,
+		RetryInterval:   p.cfg.RetryIntervalValue,
 	}
+}
 
-	// создаем клиента для работы с HTTP с поддержкой сетевого таймута
-	mc := &http.Client{
-		Transport: &http.Transport{},
-		Timeout:   cfg.TimeoutValue,
+// InitMetrics задает нулевые значения метрик статусов запрашиваемых сертификатов и проверяет срок действия
+// запрашиваемых сертификатов (до первой проверки, вне зависимости от ее результата).
+func (p *ocspProber) InitMetrics(mt *metrics) {
+	p.certExpiryCheck(mt)
+
+	switch p.cfg.Kind {
+	case ocspKindStatus:
+		for _, cc := range p.cfg.certConfigs() {
+			mt.OCSPInitCert(p.cfg.Name, p.method, cc.CertName)
+		}
+	case ocspKindUnknownSerial:
+		mt.OCSPInitCert(p.cfg.Name, p.method, ocspUnknownSerialCertName)
 	}
+}
 
-	// объект метрик
-	mt := getAppContext().Metrics
+// NewRequest формирует OCSP запрос из настроек (со случайным nonce) в соответствии с видом проверки cfg.Kind.
+// Для метода GET запрос передается в URL, в протокол также записываются заголовки кеширования ответа.
+func (p *ocspProber) NewRequest(ctx context.Context, verbose bool, le *zerolog.Event) (*probeRequest, error) {
+	cfg := p.cfg
 
-	// флаг вывода расширенного лога
-	verbose := getAppContext().Config.Log.Verbose
+	// срок действия запрашиваемых сертификатов контролируем при каждой проверке (в том числе при
+	// сетевых ошибках), предупреждения пишем в протокол. Метрика устанавливается в InitMetrics.
+	if certWarnings := p.certExpiryCheck(nil); len(certWarnings) > 0 {
+		le.Strs("certWarnings", certWarnings)
+	}
 
-	// запускаем собственно goroutine-y мониторинка
-	sch := make(chan struct{})
-	go func() {
-		close(sch)
+	// сертификаты издателей, загружаемые по AIA, загружаем до формирования запроса (до первой успешной
+	// загрузки - при каждой проверке)
+	for _, cc := range cfg.certConfigs() {
+		if err := cc.resolveIssuer(ctx, cfg.DigestOIDValue); err != nil {
+			return nil, err
+		}
+	}
 
-		var lastError error
+	// определяем сертификаты, статус которых запрашиваем
+	certs := cfg.certConfigs()
+	if cfg.Kind == ocspKindUnknownSerial {
+		cc, err := ocspUnknownSerialCert(cfg)
+		if err != nil {
+			return nil, err
+		}
+		certs = []*ocspCertConfig{cc}
+		le.Str("serial", cc.Certificate.SerialNumber.Text(16))
+	}
 
-		// при выходе пишем ошибку и закрываем канал
-		defer func() {
-			// выводим ошибку в канал и в протокол
-			le := ml.Log()
-			if lastError != nil {
-				select {
-				case resultChannel <- lastError:
-				default:
-				}
-				le.Err(lastError)
-			}
-			le.Msg("stop")
-			// всегда закрываем канал
-			close(resultChannel)
-		}()
-
-		// основной цикл обработки
-		for i := 0; cfg.RetryCount == 0 || i < cfg.RetryCount; i++ {
-			// выходим из goroutine-ы при отмене контекста
-			if ctx.Err() != nil {
-				break
-			}
+	// кодируем запрос
+	req := ocspNewRequest(cfg.DigestOIDValue, certs)
+	reqEnc, nonce, encodeError := ocspEncodeRequest(req, cfg.NonceSize, cfg.RequestorCertificate, cfg.RequestorKey)
+	if encodeError != nil {
+		return nil, encodeError
+	}
+	if verbose {
+		le.Str("nonce", base64.StdEncoding.EncodeToString(nonce))
+	}
 
-			// кодируем запрос
-			reqEnc, nonce, encodeError := ocspEncodeRequest(req, cfg.NonceSize)
-			if encodeError != nil {
-				// при ошибках кодирования запроса - завершаем goroutine-у
-				lastError = encodeError
-				break
-			}
+	// некорректный запрос получаем усечением корректного (нарушается DER кодировка)
+	if cfg.Kind == ocspKindMalformed {
+		reqEnc = reqEnc[:len(reqEnc)/2]
+	}
 
-			// создаем событие протокола
-			le := ml.Log().Int("num", i+1)
-			if verbose {
-				le.Str("request", base64.StdEncoding.EncodeToString(reqEnc)).
-					Str("nonce", base64.StdEncoding.EncodeToString(nonce))
-			}
+	probeReq := &probeRequest{
+		ContentType: "application/ocsp-request",
+		Body:        reqEnc,
+	}
+	if p.method == http.MethodGet {
+		probeReq = &probeRequest{URL: ocspGetURL(cfg.URL, reqEnc)}
+		// тело запроса пустое - выведем закодированный запрос сами
+		if verbose {
+			le.Str("request", base64.StdEncoding.EncodeToString(reqEnc))
+		}
+	}
 
-			// отправляем запрос на сервер
-			nr, err := postRequest(ctx, mc, protoOCSP, cfg.URL, *cfg.MaxResponseSize, reqEnc)
-			if nr.StatusCode == 0 && nr.SendReceiveTime == 0 {
-				// произошла ошибка при формировании запроса - завершаем goroutine-у
-				lastError = errors.New("failed to create OCSP HTTP request")
-				break
-			}
+	probeReq.Validate = func(nr *networkResult, mt *metrics, verbose bool, le *zerolog.Event) error {
+		// URL загруженного по AIA сертификата издателя становится известен после первой успешной загрузки
+		if cfg.IssuerURL != "" {
+			mt.OCSPDiscovery(cfg.Name, cfg.discoveredURL(), cfg.IssuerURL)
+		}
 
-			// обновляем статистику времени обработки запроса
-			mt.RequestProcessingTimeObserve(protoOCSP, nr.SendReceiveTime)
+		// заголовки кеширования актуальны только для GET запросов
+		if p.method == http.MethodGet {
+			ocspLogCacheHeaders(nr.Header, le)
+		}
 
-			// выведем тело запроса в протокол (даже при ошибке)
-			if verbose {
-				le.Str("response", base64.StdEncoding.EncodeToString(nr.Body)).
-					Dur("processingTime", nr.SendReceiveTime)
-			}
+		// декодируем ответ
+		var resp ocspResponse
+		if _, decodeError := asn1.Unmarshal(nr.Body, &resp); decodeError != nil {
+			return newValidationError(responseErrorAsn, fmt.Errorf("decode OCSP response: [%w]", decodeError))
+		}
 
-			// наконец обработаем ошибку postRequest
-			if err != nil {
-				if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
-					// отменен основной контекст - просто выходим из goroutine-ы
-					break
-				}
+		// статус ответа учитываем для всех видов проверки
+		le.Str("responseStatus", ocspResponseStatusName(resp.ResponseStatus))
+		mt.OCSPResponseStatus(cfg.Name, p.method, resp.ResponseStatus)
 
-				// обновляем статистику и протоколируем ошибку
-				mt.ResponseError(protoOCSP, responseErrorNet)
-				le.Str("errorType", string(responseErrorNet)).Err(fmt.Errorf("receive OCSP response: [%w]", err)).Msg("request failed")
-				if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-					waitForTimeout(ctx, cfg.RetryIntervalValue)
-				}
-				continue
+		// на некорректный запрос ожидаем только статус ответа
+		if cfg.Kind == ocspKindMalformed {
+			if resp.ResponseStatus != ocspResponseStatusMalformedRequest {
+				return fmt.Errorf("validate OCSP response: OCSP ResponseStatus mismatch: [%s], expected [%s]",
+					ocspResponseStatusName(resp.ResponseStatus), ocspResponseStatusName(ocspResponseStatusMalformedRequest))
 			}
+			return nil
+		}
 
-			// проверим HTTP статус код ответа - успешные коды в диапазоне (200,300)
-			if nr.StatusCode < http.StatusOK || nr.StatusCode >= http.StatusMultipleChoices {
-				mt.ResponseError(protoOCSP, responseErrorHTTP)
-				err = fmt.Errorf("receive OCSP response: invalid HTTP status code: [%d]: [%s]", nr.StatusCode, http.StatusText(nr.StatusCode))
-				le.Str("errorType", string(responseErrorHTTP)).Err(err).Msg("request failed")
-				if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-					waitForTimeout(ctx, cfg.RetryIntervalValue)
-				}
-				continue
+		// проверяем содержимое ответа
+		respInfo, validateError := ocspResponseValidate(&resp, req, nonce, certs, cfg, verbose, le)
+		if respInfo != nil {
+			if certWarnings := certExpiryCheck(mt, cfg.Name, certRoleOCSPResponder, []*x509.Certificate{respInfo.Responder}, cfg.CertExpiryWarningValues, nil); len(certWarnings) > 0 {
+				le.Strs("responderCertWarnings", certWarnings)
 			}
-
-			// пишем доп. данные об ответе
-			if verbose {
-				le.Int("statusCode", nr.StatusCode).Str("contentType", nr.ContentType)
+			mt.OCSPResponder(cfg.Name, p.method, respInfo)
+			for i := range respInfo.Certs {
+				mt.OCSPCertStatus(cfg.Name, p.method, &respInfo.Certs[i])
 			}
+			mt.OCSPResponseFreshness(cfg.Name, p.method, respInfo)
 
-			// декодируем ответ
-			var resp ocspResponse
-			if _, decodeError := asn1.Unmarshal(nr.Body, &resp); decodeError != nil {
-				mt.ResponseError(protoOCSP, responseErrorAsn)
-				le.Str("errorType", string(responseErrorAsn)).Err(fmt.Errorf("decode OCSP response: [%w]", decodeError)).Msg("request failed")
-				if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-					waitForTimeout(ctx, cfg.RetryIntervalValue)
-				}
-				continue
+			// сверяем статусы сертификатов с CRL
+			if cfg.CRLCheck && cfg.Kind == ocspKindStatus {
+				crlError := ocspCRLCheck(ctx, respInfo, certs, cfg, p.method, getAppContext().CRLCache, mt, verbose, le)
+				validateError = errors.Join(validateError, crlError)
 			}
+		}
+		if validateError != nil {
+			return fmt.Errorf("validate OCSP response: [%w]", validateError)
+		}
+		return nil
+	}
+	return probeReq, nil
+}
 
-			// проверяем содержимое ответа
-			if validateError := ocspResponseValidate(&resp, req, nonce, verbose, le); validateError != nil {
-				mt.ResponseError(protoOCSP, responseErrorContents)
-				le.Str("errorType", string(responseErrorContents)).Err(fmt.Errorf("validate OCSP response: [%w]", validateError)).Msg("request failed")
-			} else {
-				le.Msg("request succeed")
-			}
+// certExpiryCheck учитывает в метриках mt (если не nil) срок действия запрашиваемых сертификатов цели
+// мониторинга и возвращает предупреждения об истекающих сертификатах (см. certExpiryCheck).
+func (p *ocspProber) certExpiryCheck(mt *metrics) []string {
+	var monitoredCerts []*x509.Certificate
+	for _, cc := range p.cfg.certConfigs() {
+		monitoredCerts = append(monitoredCerts, cc.Certificate)
+	}
+	return certExpiryCheck(mt, p.cfg.Name, certRoleOCSPCert, monitoredCerts, p.cfg.CertExpiryWarningValues, nil)
+}
 
-			// ждем указанный таймаут
-			if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-				waitForTimeout(ctx, cfg.RetryIntervalValue)
-			}
+// ocspGetURL формирует URL OCSP запроса методом GET (RFC6960, Appendix A.1):
+// к URL сервера добавляется URL-кодированное base64 представление DER кодировки запроса.
+func ocspGetURL(serverURL string, encodedRequest []byte) string {
+	return strings.TrimSuffix(serverURL, "/") + "/" + url.QueryEscape(base64.StdEncoding.EncodeToString(encodedRequest))
+}
+
+// ocspLogCacheHeaders записывает в le заголовки ответа, определяющие его кеширование (Cache-Control, Expires, ETag).
+func ocspLogCacheHeaders(header http.Header, le *zerolog.Event) {
+	for _, h := range []struct{ name, key string }{
+		{"Cache-Control", "cacheControl"},
+		{"Expires", "expires"},
+		{"ETag", "etag"},
+	} {
+		if v := header.Get(h.name); v != "" {
+			le.Str(h.key, v)
 		}
-	}()
-	<-sch
+	}
+}
+
+// ocspNewRequest создает OCSP запрос статуса сертификатов certs (по одному CertID на сертификат
+// в порядке certs). digestOID - алгоритм хеширования, которым вычислены хеши издателя.
+func ocspNewRequest(digestOID asn1.ObjectIdentifier, certs []*ocspCertConfig) *ocspRequest {
+	requestList := make([]ocspSingleRequest, 0, len(certs))
+	for _, cc := range certs {
+		requestList = append(requestList, ocspSingleRequest{
+			ReqCert: ocspCertID{
+				HashAlgorithm: pkix.AlgorithmIdentifier{
+					Algorithm:  digestOID,
+					Parameters: asn1.NullRawValue,
+				},
+				NameHash:      cc.NameDigestValue,
+				IssuerKeyHash: cc.KeyDigestValue,
+				SerialNumber:  cc.Certificate.SerialNumber,
+			},
+		})
+	}
+	return &ocspRequest{
+		TBSRequest: ocspTBSRequest{
+			RequestList: requestList,
+		},
+	}
+}
+
+// имя сертификата со случайным серийным номером в протоколе и в метках метрик
+const ocspUnknownSerialCertName = "unknownserial"
+
+// размер случайного серийного номера (байт)
+const ocspUnknownSerialSize = 16
+
+// ocspUnknownSerialCert создает описание сертификата со случайным серийным номером, выпущенного
+// издателем основного сертификата цели мониторинга (используются хеши издателя основного сертификата).
+// Ожидаемый статус такого сертификата - unknown или revoked (RFC6960 2.2, "extended revoked").
+func ocspUnknownSerialCert(cfg *ocspConfig) (*ocspCertConfig, error) {
+	serial, err := random(ocspUnknownSerialSize)
+	if err != nil {
+		return nil, err
+	}
+	// серийный номер должен быть положительным и не короче ocspUnknownSerialSize
+	serial[0] = serial[0]&0x7f | 0x40
+
+	return &ocspCertConfig{
+		CertName:            ocspUnknownSerialCertName,
+		NameDigestValue:     cfg.NameDigestValue,
+		KeyDigestValue:      cfg.KeyDigestValue,
+		IssuerCertificate:   cfg.IssuerCertificate,
+		Certificate:         &x509.Certificate{SerialNumber: new(big.Int).SetBytes(serial)},
+		ExpectedStatusValue: ocspCertStatusUnknown,
+		acceptRevoked:       true,
+	}, nil
+}
+
+// ocspIssuerDigests вычисляет значения хешей имени (issuerNameHash) и открытого ключа (issuerKeyHash)
+// издателя для OCSP CertID с использованием алгоритма хеширования digestOID.
+//
+// Хеш имени вычисляется от DER кодировки имени субъекта издателя, хеш ключа - от значения
+// BIT STRING subjectPublicKey (без тега, длины и количества неиспользуемых бит).
+func ocspIssuerDigests(digestOID asn1.ObjectIdentifier, issuer *x509.Certificate) (nameDigest, keyDigest []byte, outError error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode issuer SubjectPublicKeyInfo: [%w]", err)
+	}
 
-	ml.Log().
-		Int("retryCount", cfg.RetryCount).Dur("retryInterval", cfg.RetryIntervalValue).
-		Msg("start")
-	return resultChannel
+	h, err := newDigest(digestOID)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Write(issuer.RawSubject)
+	nameDigest = h.Sum(nil)
+
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyDigest = h.Sum(nil)
+
+	return nameDigest, keyDigest, nil
 }
 
 // ocspEncodeRequest позволяет закодировать OCSP запрос в ASN.1.
 // Если передан не нулевой размер nonceSize, то функция генерирует случайный nonce указанного размера
 // и добавляет его в запрос перед кодированием.
 //
+// Если передан ключ requestorKey, то запрос подписывается (см. ocspSignRequest).
+//
 // Возвращает закодированный запрос, nonce (для проверки) и ошибку.
 // Следует учитывать, что возвращаемый nonce закодирован как ASN.1 OCTET STRING (т.е. в соответствующем
 // расширении Value дважды упакован в ASN.1 OCTET STRING).
-func ocspEncodeRequest(request *ocspRequest, nonceSize int) (encoded, nonce []byte, outError error) {
+func ocspEncodeRequest(request *ocspRequest, nonceSize int, requestorCert *x509.Certificate, requestorKey crypto.Signer) (encoded, nonce []byte, outError error) {
 	if nonceSize > 0 {
 		// генерируем случайный nonce
 		nonce, outError = random(nonceSize)
@@ -223,10 +314,20 @@ func ocspEncodeRequest(request *ocspRequest, nonceSize int) (encoded, nonce []by
 	}
 
 	// кодируем CertID
-	if len(request.TBSRequest.RequestList[0].ReqCert.Raw) == 0 {
-		request.TBSRequest.RequestList[0].ReqCert.Raw, outError = asn1.Marshal(request.TBSRequest.RequestList[0].ReqCert)
-		if outError != nil {
-			return nil, nil, fmt.Errorf("failed to encode OCSP request CertID: [%w]", outError)
+	for i := range request.TBSRequest.RequestList {
+		reqCert := &request.TBSRequest.RequestList[i].ReqCert
+		if len(reqCert.Raw) == 0 {
+			reqCert.Raw, outError = asn1.Marshal(*reqCert)
+			if outError != nil {
+				return nil, nil, fmt.Errorf("failed to encode OCSP request CertID: [%d], [%w]", i, outError)
+			}
+		}
+	}
+
+	// подписываем запрос
+	if requestorKey != nil {
+		if outError = ocspSignRequest(request, requestorCert, requestorKey); outError != nil {
+			return nil, nil, outError
 		}
 	}
 
@@ -238,27 +339,136 @@ func ocspEncodeRequest(request *ocspRequest, nonceSize int) (encoded, nonce []by
 	return encoded, nonce, outError
 }
 
+// ocspSignRequest подписывает OCSP запрос ключом key: в поле requestorName запроса записывается имя
+// субъекта сертификата cert (directoryName), в поле optionalSignature - подпись TBSRequest и сертификат cert.
+func ocspSignRequest(request *ocspRequest, cert *x509.Certificate, key crypto.Signer) error {
+	// requestorName [1] EXPLICIT GeneralName, GeneralName ::= CHOICE { directoryName [4] Name, ... }
+	// (Name является CHOICE, поэтому тег directoryName явный)
+	requestorName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: cert.RawSubject})
+	if err != nil {
+		return fmt.Errorf("failed to encode OCSP requestorName: [%w]", err)
+	}
+	request.TBSRequest.RequestorName = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: requestorName}
+
+	tbsRequest, err := asn1.Marshal(request.TBSRequest)
+	if err != nil {
+		return fmt.Errorf("failed to encode OCSP TBSRequest: [%w]", err)
+	}
+
+	sigAlg, signature, err := signData(key, tbsRequest)
+	if err != nil {
+		return fmt.Errorf("failed to sign OCSP request: [%w]", err)
+	}
+
+	encodedSignature, err := asn1.Marshal(ocspSignature{
+		SignatureAlgorithm: sigAlg,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+		Certs:              []asn1.RawValue{{FullBytes: cert.Raw}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode OCSP request signature: [%w]", err)
+	}
+	// RawValue кодируется как есть (без учета параметров поля), поэтому явный тег [0] добавляем сами
+	request.Signature = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encodedSignature}
+	return nil
+}
+
+// ocspResponseInfo содержит сведения о времени формирования OCSP ответа и статусы запрошенных сертификатов.
+type ocspResponseInfo struct {
+	// CheckTime время проверки ответа, относительно которого вычисляется его возраст
+	CheckTime time.Time
+
+	// ProducedAt время формирования ответа (ResponseData.producedAt)
+	ProducedAt time.Time
+
+	// Certs статусы сертификатов в порядке их следования в запросе (первый - основной сертификат цели мониторинга)
+	Certs []ocspCertResponseInfo
+
+	// Responder сертификат, которым подтверждена подпись ответа
+	Responder *x509.Certificate
+
+	// ResponderAuth способ авторизации OCSP сервера: ocspResponderCA, ocspResponderDelegated или ocspResponderPinned
+	ResponderAuth string
+
+	// ResponderNoCheck признак наличия в сертификате OCSP сервера расширения id-pkix-ocsp-nocheck
+	ResponderNoCheck bool
+}
+
+// ocspCertResponseInfo содержит статус одного сертификата из OCSP ответа и результат его проверки.
+type ocspCertResponseInfo struct {
+	// Name имя сертификата (ocspCertConfig.CertName)
+	Name string
+
+	// Found устанавливается, если статус сертификата найден в ответе и успешно декодирован.
+	// Остальные поля (кроме Err) заполняются только в этом случае.
+	Found bool
+
+	// Status статус сертификата
+	Status ocspCertStatus
+
+	// RevokedInfo сведения об отзыве сертификата. Заполняется только для статуса ocspCertStatusRevoked.
+	RevokedInfo *ocspRevokedInfo
+
+	// ThisUpdate время, на которое статус сертификата был актуален (SingleResponse.thisUpdate)
+	ThisUpdate time.Time
+
+	// NextUpdate время, до которого статус сертификата считается актуальным (SingleResponse.nextUpdate).
+	// Нулевое значение, если поле в ответе отсутствует.
+	NextUpdate time.Time
+
+	// Err ошибка проверки статуса сертификата (nil - статус соответствует ожидаемому и актуален)
+	Err error
+}
+
+// log записывает статус сертификата в событие протокола e.
+func (ci *ocspCertResponseInfo) log(e *zerolog.Event, verbose bool) {
+	if !ci.Found {
+		return
+	}
+	e.Str("certStatus", ci.Status.String())
+	if ci.RevokedInfo != nil {
+		e.Time("revocationTime", ci.RevokedInfo.RevocationTime)
+		if ci.RevokedInfo.RevocationReason >= 0 {
+			e.Str("revocationReason", crlReasonName(ci.RevokedInfo.RevocationReason))
+		}
+	}
+	if verbose {
+		e.Time("thisUpdate", ci.ThisUpdate)
+		if !ci.NextUpdate.IsZero() {
+			e.Time("nextUpdate", ci.NextUpdate)
+		}
+	}
+}
+
 // ocspResponseValidate проверяет корректность декодированного OCSP ответа и сравнивает
-// его содержимое с отправленным запросом.
+// его содержимое с отправленным запросом и настройками цели мониторинга cfg.
+// Подпись ответа проверяется сертификатом cfg.ResponderCertificate, если он не nil, иначе - сертификатом
+// из ответа. Ошибки проверки подписи, полномочий OCSP сервера и цепочки его сертификата до доверенных
+// сертификатов cfg.TrustCertificates (если они есть) возвращаются с типом responseErrorSignature.
 // Если указан флаг verbose, то в le должна записываться доп. информация о содержимом ответа.
-func ocspResponseValidate(response *ocspResponse, request *ocspRequest, nonce []byte, verbose bool, le *zerolog.Event) error {
+//
+// Статус каждого запрошенного сертификата проверяется отдельно (см. ocspCertResponseValidate), ошибки
+// проверки сертификатов объединяются. Если ответ удалось декодировать и проверить его подпись и nonce,
+// то статусы сертификатов возвращаются даже в случае ошибки проверки (в том числе при несовпадении
+// статуса с ожидаемым и при устаревшем ответе).
+func ocspResponseValidate(response *ocspResponse, request *ocspRequest, nonce []byte, certs []*ocspCertConfig, cfg *ocspConfig, verbose bool, le *zerolog.Event) (*ocspResponseInfo, error) {
 	// проверяем статус ответа
-	if response.ResponseStatus != asn1.Enumerated(0) {
-		return fmt.Errorf("invalid OCSP ResponseStatus: %d", int(response.ResponseStatus))
+	if response.ResponseStatus != ocspResponseStatusSuccessful {
+		return nil, fmt.Errorf("invalid OCSP ResponseStatus: [%s]", ocspResponseStatusName(response.ResponseStatus))
 	}
 
 	// проверяем тип и содержимое - должен быть непустой ocspBasicResponse
 	if !response.ResponseBytes.ResponseType.Equal(oidOCSPBasicResponse) {
-		return fmt.Errorf("invalid OCSP ResponseType: [%s]", response.ResponseBytes.ResponseType.String())
+		return nil, fmt.Errorf("invalid OCSP ResponseType: [%s]", response.ResponseBytes.ResponseType.String())
 	}
 	if len(response.ResponseBytes.Response) == 0 {
-		return errors.New("empty OCSP BasicResponse")
+		return nil, errors.New("empty OCSP BasicResponse")
 	}
 
 	// декодируем BasicResponse
 	var basicResponse ocspBasicResponse
 	if _, decodeError := asn1.Unmarshal(response.ResponseBytes.Response, &basicResponse); decodeError != nil {
-		return fmt.Errorf("failed to decode OCSP BasicRespons: [%w]", decodeError)
+		return nil, fmt.Errorf("failed to decode OCSP BasicRespons: [%w]", decodeError)
 	}
 
 	// выведем алгоритм подписи
@@ -266,35 +476,231 @@ func ocspResponseValidate(response *ocspResponse, request *ocspRequest, nonce []
 		le.Str("respSignAlgorithm", basicResponse.SignatureAlgorithm.Algorithm.String())
 	}
 
-	// ищем информацию со статусом для CertID из сертификата
-	var found bool
-	for i := range basicResponse.TBSResponseData.Responses {
-		if bytes.Equal(basicResponse.TBSResponseData.Responses[i].CertID.Raw, request.TBSRequest.RequestList[0].ReqCert.Raw) {
-			found = true
-			break
+	// проверяем подпись ответа
+	var issuers []*x509.Certificate
+	for _, cc := range certs {
+		if cc.IssuerCertificate != nil {
+			issuers = append(issuers, cc.IssuerCertificate)
 		}
 	}
-	if !found {
-		return errors.New("no status info for certificate in OCSP response")
+	signer, signatureError := ocspResponseVerifySignature(&basicResponse, cfg.ResponderCertificate, issuers)
+	if signatureError != nil {
+		return nil, newValidationError(responseErrorSignature, signatureError)
+	}
+	if verbose {
+		le.Str("respSigner", signer.Subject.String())
+	}
+
+	// промежуточные сертификаты для построения цепочки сертификата OCSP сервера берутся из ответа
+	// и из сертификатов издателей
+	intermediates, certsError := ocspResponseCertificates(&basicResponse)
+	if certsError != nil {
+		return nil, newValidationError(responseErrorSignature, certsError)
+	}
+	intermediates = append(intermediates, issuers...)
+
+	// проверяем полномочия OCSP сервера на выдачу статусов всех запрошенных сертификатов
+	// (закрепленный в настройках сертификат считается авторизованным)
+	responderAuth := ocspResponderPinned
+	if cfg.ResponderCertificate == nil {
+		for _, cc := range certs {
+			auth, authError := ocspResponderAuthorization(signer, cc, cfg.DigestOIDValue, intermediates, cfg.TrustCertificates, time.Now())
+			if authError != nil {
+				return nil, newValidationError(responseErrorSignature,
+					fmt.Errorf("OCSP responder is not authorized for certificate [%s]: [%w]", cc.CertName, authError))
+			}
+			// при разных издателях запрошенных сертификатов учитываем делегирование
+			if responderAuth != ocspResponderDelegated {
+				responderAuth = auth
+			}
+		}
+	}
+
+	// строим цепочку сертификата OCSP сервера до доверенных сертификатов
+	if cfg.ResponderCertificate == nil && len(cfg.TrustCertificates) > 0 {
+		chain, chainError := certChainBuild(signer, intermediates, cfg.TrustCertificates, time.Now())
+		if chainError != nil {
+			return nil, fmt.Errorf("OCSP responder certificate chain: [%w]", chainError)
+		}
+		if verbose {
+			le.Strs("respChain", certChainSubjects(chain))
+		}
+	}
+	responderNoCheck := ocspResponderNoCheck(signer)
+	if verbose {
+		le.Str("responderAuth", responderAuth).Bool("responderNoCheck", responderNoCheck)
 	}
 
 	// проверяем наличие nonce
 	if len(nonce) > 0 {
-		found = false
+		found := false
 		for i := range basicResponse.TBSResponseData.Extensions {
 			ext := basicResponse.TBSResponseData.Extensions[i]
 			if ext.Id.Equal(oidOCSPNonceExtension) {
 				if !bytes.Equal(ext.Value, nonce) {
-					return errors.New("OCSP response nonce mismatch")
+					return nil, errors.New("OCSP response nonce mismatch")
 				}
 				found = true
 				break
 			}
 		}
 		if !found {
-			return errors.New("nonce not found in OCSP response")
+			return nil, errors.New("nonce not found in OCSP response")
 		}
 	}
 
-	return nil
+	respInfo := &ocspResponseInfo{
+		CheckTime:  time.Now(),
+		ProducedAt: basicResponse.TBSResponseData.ProducedAt,
+
+		Responder:        signer,
+		ResponderAuth:    responderAuth,
+		ResponderNoCheck: responderNoCheck,
+	}
+	if verbose {
+		le.Time("producedAt", respInfo.ProducedAt)
+	}
+
+	// проверяем статус каждого запрошенного сертификата
+	var certErrors []error
+	certArr := zerolog.Arr()
+	for i, cc := range certs {
+		certInfo := ocspCertResponseValidate(&basicResponse.TBSResponseData, &request.TBSRequest.RequestList[i].ReqCert, cc, respInfo.CheckTime, cfg)
+		respInfo.Certs = append(respInfo.Certs, certInfo)
+		if certInfo.Err != nil {
+			certErrors = append(certErrors, fmt.Errorf("certificate [%s]: [%w]", certInfo.Name, certInfo.Err))
+		}
+
+		// основной сертификат пишем в событие, дополнительные - в массив certs
+		if i == 0 {
+			certInfo.log(le, verbose)
+		} else {
+			ce := zerolog.Dict().Str("cert", certInfo.Name)
+			certInfo.log(ce, verbose)
+			certArr.Dict(ce)
+		}
+	}
+	if len(respInfo.Certs) > 1 {
+		le.Array("certs", certArr)
+	}
+
+	// проверяем актуальность ответа
+	if producedAtAge := respInfo.CheckTime.Sub(respInfo.ProducedAt); cfg.MaxProducedAtAgeValue > 0 && producedAtAge > cfg.MaxProducedAtAgeValue {
+		certErrors = append(certErrors, fmt.Errorf("OCSP response producedAt is too old: [%s], max age [%s]", producedAtAge.Round(time.Millisecond), cfg.MaxProducedAtAgeValue))
+	}
+
+	return respInfo, errors.Join(certErrors...)
+}
+
+// ocspCertResponseValidate ищет в responseData статус сертификата с CertID certID и проверяет его:
+//   - статус должен совпадать с ожидаемым cc.ExpectedStatusValue;
+//   - возраст thisUpdate относительно checkTime не должен превышать cfg.MaxThisUpdateAgeValue
+//     (проверка не выполняется при нулевом значении);
+//   - nextUpdate, если указано, должно быть в будущем.
+func ocspCertResponseValidate(responseData *ocspResponseData, certID *ocspCertID, cc *ocspCertConfig, checkTime time.Time, cfg *ocspConfig) ocspCertResponseInfo {
+	certInfo := ocspCertResponseInfo{Name: cc.CertName}
+
+	// ищем информацию со статусом для CertID из сертификата
+	var singleResponse *ocspSingleResponse
+	for i := range responseData.Responses {
+		if bytes.Equal(responseData.Responses[i].CertID.Raw, certID.Raw) {
+			singleResponse = &responseData.Responses[i]
+			break
+		}
+	}
+	if singleResponse == nil {
+		certInfo.Err = errors.New("no status info for certificate in OCSP response")
+		return certInfo
+	}
+
+	// декодируем статус сертификата
+	status, revokedInfo, statusError := ocspParseCertStatus(singleResponse.CertStatusRaw)
+	if statusError != nil {
+		certInfo.Err = statusError
+		return certInfo
+	}
+	certInfo.Found = true
+	certInfo.Status = status
+	certInfo.RevokedInfo = revokedInfo
+	certInfo.ThisUpdate = singleResponse.ThisUpdate
+	certInfo.NextUpdate = singleResponse.NextUpdate
+
+	// сравниваем статус с ожидаемым
+	if status != cc.ExpectedStatusValue && !(cc.acceptRevoked && status == ocspCertStatusRevoked) {
+		if cc.acceptRevoked && status == ocspCertStatusGood {
+			certInfo.Err = fmt.Errorf("OCSP responder reports good status for non-existent serial: [%s]", cc.Certificate.SerialNumber.Text(16))
+		} else {
+			certInfo.Err = fmt.Errorf("OCSP certificate status mismatch: [%s], expected [%s]", status.String(), cc.ExpectedStatusValue.String())
+		}
+		return certInfo
+	}
+
+	// проверяем актуальность статуса
+	if thisUpdateAge := checkTime.Sub(certInfo.ThisUpdate); cfg.MaxThisUpdateAgeValue > 0 && thisUpdateAge > cfg.MaxThisUpdateAgeValue {
+		certInfo.Err = fmt.Errorf("OCSP response thisUpdate is too old: [%s], max age [%s]", thisUpdateAge.Round(time.Millisecond), cfg.MaxThisUpdateAgeValue)
+		return certInfo
+	}
+	if !certInfo.NextUpdate.IsZero() && !certInfo.NextUpdate.After(checkTime) {
+		certInfo.Err = fmt.Errorf("OCSP response nextUpdate is in the past: [%s]", certInfo.NextUpdate.UTC().Format(time.RFC3339))
+	}
+	return certInfo
+}
+
+// ocspResponseVerifySignature проверяет подпись BasicResponse над TBSResponseData.
+//
+// Если передан закрепленный сертификат responderCert, то подпись проверяется только им.
+// Иначе подпись проверяется сертификатом, соответствующим ResponderID ответа. Сертификат ищется среди
+// сертификатов из поля Certificates ответа и сертификатов издателей issuers (ответ может быть подписан
+// издателем без включения его сертификата в ответ). Проверяются все подходящие сертификаты (например,
+// сертификаты издателя до и после смены ключа с одинаковым именем), возвращается ошибка последнего из них.
+//
+// Возвращает сертификат, которым подтверждена подпись.
+func ocspResponseVerifySignature(basicResponse *ocspBasicResponse, responderCert *x509.Certificate, issuers []*x509.Certificate) (*x509.Certificate, error) {
+	signature := basicResponse.Signature.RightAlign()
+
+	if responderCert != nil {
+		if err := verifySignature(responderCert, basicResponse.SignatureAlgorithm, basicResponse.TBSResponseData.Raw, signature); err != nil {
+			return nil, fmt.Errorf("OCSP response signature verification failed (pinned responder certificate): [%w]", err)
+		}
+		return responderCert, nil
+	}
+
+	candidates, err := ocspResponseCertificates(basicResponse)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, issuers...)
+
+	var lastError error
+	for _, cert := range candidates {
+		matches, idError := ocspResponderIDMatches(&basicResponse.TBSResponseData.RawResponderID, cert)
+		if idError != nil {
+			return nil, idError
+		}
+		if !matches {
+			continue
+		}
+		if err := verifySignature(cert, basicResponse.SignatureAlgorithm, basicResponse.TBSResponseData.Raw, signature); err != nil {
+			lastError = err
+			continue
+		}
+		return cert, nil
+	}
+	if lastError != nil {
+		return nil, fmt.Errorf("OCSP response signature verification failed: [%w]", lastError)
+	}
+	return nil, errors.New("no certificate matching OCSP ResponderID to verify signature")
+}
+
+// ocspResponseCertificates разбирает сертификаты, вложенные в BasicOCSPResponse (поле certs).
+func ocspResponseCertificates(basicResponse *ocspBasicResponse) ([]*x509.Certificate, error) {
+	out := make([]*x509.Certificate, 0, len(basicResponse.Certificates))
+	for i := range basicResponse.Certificates {
+		cert, err := x509.ParseCertificate(basicResponse.Certificates[i].FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OCSP response certificate: [%d], [%w]", i, err)
+		}
+		out = append(out, cert)
+	}
+	return out, nil
 }
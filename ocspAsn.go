@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"fmt"
 	"math/big"
 	"time"
 )
@@ -16,6 +17,8 @@ import (
 var (
 	oidOCSPNonceExtension = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
 	oidOCSPBasicResponse  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	oidOCSPNoCheckExtension = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
 )
 
 // ocspRequest определяет структуру OCSP запроса.
@@ -28,6 +31,18 @@ type ocspRequest struct {
 	Signature  asn1.RawValue `asn1:"explicit,tag:0,optional"`
 }
 
+// ocspSignature определяет подпись OCSP запроса (поле optionalSignature).
+//
+//	Signature       ::=     SEQUENCE {
+//	  signatureAlgorithm      AlgorithmIdentifier,
+//	  signature               BIT STRING,
+//	  certs               [0] EXPLICIT SEQUENCE OF Certificate OPTIONAL}
+type ocspSignature struct {
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certs              []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
 // ocspResponse определяет структуру OCSP ответа.
 //
 //	OCSPResponse ::= SEQUENCE {
@@ -48,6 +63,30 @@ type ocspResponse struct {
 	ResponseBytes  ocspResponseBytes `asn1:"explicit,tag:0,optional"`
 }
 
+// Определение используемых значений OCSPResponseStatus
+const (
+	ocspResponseStatusSuccessful       asn1.Enumerated = 0
+	ocspResponseStatusMalformedRequest asn1.Enumerated = 1
+)
+
+// ocspResponseStatusNames определяет имена статусов OCSP ответа (OCSPResponseStatus).
+var ocspResponseStatusNames = map[asn1.Enumerated]string{
+	0: "successful",
+	1: "malformedRequest",
+	2: "internalError",
+	3: "tryLater",
+	5: "sigRequired",
+	6: "unauthorized",
+}
+
+// ocspResponseStatusName возвращает имя статуса OCSP ответа.
+func ocspResponseStatusName(status asn1.Enumerated) string {
+	if name, found := ocspResponseStatusNames[status]; found {
+		return name
+	}
+	return fmt.Sprintf("status(%d)", int(status))
+}
+
 // ocspTBSRequest определяет опционально подписываемое тело OCSP запроса.
 //
 //	TBSRequest      ::=     SEQUENCE {
@@ -103,6 +142,7 @@ type ocspBasicResponse struct {
 
 // ocspResponseData определяет структуру подписанной части ocspBasicResponse.
 type ocspResponseData struct {
+	Raw            asn1.RawContent
 	Version        int `asn1:"optional,default:0,explicit,tag:0"`
 	RawResponderID asn1.RawValue
 	ProducedAt     time.Time `asn1:"generalized"`
@@ -118,3 +158,98 @@ type ocspSingleResponse struct {
 	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
 	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
 }
+
+// ocspCertStatus определяет статус сертификата в ocspSingleResponse.
+//
+//	CertStatus ::= CHOICE {
+//	  good        [0]     IMPLICIT NULL,
+//	  revoked     [1]     IMPLICIT RevokedInfo,
+//	  unknown     [2]     IMPLICIT UnknownInfo }
+type ocspCertStatus int
+
+// Определение статусов сертификата (значения совпадают с тегами CertStatus).
+const (
+	ocspCertStatusGood    ocspCertStatus = 0
+	ocspCertStatusRevoked ocspCertStatus = 1
+	ocspCertStatusUnknown ocspCertStatus = 2
+)
+
+// ocspCertStatuses содержит все статусы сертификата (используется для инициализации метрик).
+var ocspCertStatuses = []ocspCertStatus{ocspCertStatusGood, ocspCertStatusRevoked, ocspCertStatusUnknown}
+
+func (s ocspCertStatus) String() string {
+	switch s {
+	case ocspCertStatusGood:
+		return "good"
+	case ocspCertStatusRevoked:
+		return "revoked"
+	case ocspCertStatusUnknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("status(%d)", int(s))
+}
+
+// ocspParseCertStatusName преобразует имя статуса сертификата (good|revoked|unknown) в ocspCertStatus.
+func ocspParseCertStatusName(name string) (ocspCertStatus, error) {
+	for _, s := range ocspCertStatuses {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown OCSP certificate status: [%s]", name)
+}
+
+// ocspRevokedInfo содержит сведения об отзыве сертификата.
+//
+//	RevokedInfo ::= SEQUENCE {
+//	  revocationTime              GeneralizedTime,
+//	  revocationReason    [0]     EXPLICIT CRLReason OPTIONAL }
+//
+// Если причина отзыва в ответе не указана, то RevocationReason равно -1.
+type ocspRevokedInfo struct {
+	RevocationTime   time.Time       `asn1:"generalized"`
+	RevocationReason asn1.Enumerated `asn1:"explicit,tag:0,optional,default:-1"`
+}
+
+// crlReasonNames определяет имена причин отзыва сертификата (CRLReason, RFC5280).
+var crlReasonNames = map[asn1.Enumerated]string{
+	0:  "unspecified",
+	1:  "keyCompromise",
+	2:  "cACompromise",
+	3:  "affiliationChanged",
+	4:  "superseded",
+	5:  "cessationOfOperation",
+	6:  "certificateHold",
+	8:  "removeFromCRL",
+	9:  "privilegeWithdrawn",
+	10: "aACompromise",
+}
+
+// crlReasonName возвращает имя причины отзыва сертификата.
+func crlReasonName(reason asn1.Enumerated) string {
+	if name, found := crlReasonNames[reason]; found {
+		return name
+	}
+	return fmt.Sprintf("reason(%d)", int(reason))
+}
+
+// ocspParseCertStatus декодирует статус сертификата из CertStatusRaw.
+// Для статуса revoked дополнительно возвращает сведения об отзыве.
+func ocspParseCertStatus(raw asn1.RawValue) (ocspCertStatus, *ocspRevokedInfo, error) {
+	if raw.Class != asn1.ClassContextSpecific {
+		return 0, nil, fmt.Errorf("invalid OCSP CertStatus class: [%d]", raw.Class)
+	}
+
+	switch status := ocspCertStatus(raw.Tag); status {
+	case ocspCertStatusGood, ocspCertStatusUnknown:
+		return status, nil, nil
+
+	case ocspCertStatusRevoked:
+		var info ocspRevokedInfo
+		if _, err := asn1.UnmarshalWithParams(raw.FullBytes, &info, "tag:1"); err != nil {
+			return 0, nil, fmt.Errorf("failed to decode OCSP RevokedInfo: [%w]", err)
+		}
+		return status, &info, nil
+	}
+	return 0, nil, fmt.Errorf("invalid OCSP CertStatus tag: [%d]", raw.Tag)
+}
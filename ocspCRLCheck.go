@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+/*
+  Сверка статусов сертификатов из ответа OCSP сервера с CRL (ocspConfig.CRLCheck): каналы
+  распространения сведений об отзыве НУЦ РК должны быть согласованы с точностью до задержки
+  распространения ocspConfig.CRLGracePeriod.
+*/
+
+// причина ошибки сверки статусов с CRL (метка reason метрики response_error_reasons)
+const ocspReasonRevocationMismatch = "revocation_mismatch"
+
+// ocspCRLCheck сверяет статусы сертификатов certs (в порядке запроса) из OCSP ответа respInfo с CRL,
+// загруженными по URL-ам cc.CRLURL (CRL берутся из кеша cache, см. crlCache.Get; загрузка прерывается
+// при отмене ctx). Сертификаты без URL CRL,
+// не найденные в ответе и со статусом unknown не сверяются. Результат сверки устанавливается в метрике
+// ocsp_revocation_mismatch для HTTP метода method, которым получен ответ.
+//
+// Возвращает ошибку с причиной revocation_mismatch, если статус хотя бы одного сертификата расходится с CRL.
+// Ошибки получения CRL не считаются ошибками проверки ответа и записываются в le (поле crlCheckErrors).
+func ocspCRLCheck(ctx context.Context, respInfo *ocspResponseInfo, certs []*ocspCertConfig, cfg *ocspConfig, method string, cache *crlCache, mt *metrics, verbose bool, le *zerolog.Event) error {
+	var (
+		mismatches  []error
+		checkErrors []string
+		crlNumbers  []string
+	)
+	for i, cc := range certs {
+		if cc.CRLURL == "" || i >= len(respInfo.Certs) {
+			continue
+		}
+		certInfo := &respInfo.Certs[i]
+		if !certInfo.Found || certInfo.Status == ocspCertStatusUnknown {
+			mt.OCSPRevocationMismatch(cfg.Name, method, cc.CertName, false, false)
+			continue
+		}
+
+		record, err := cache.Get(ctx, cc.CRLURL, cc.IssuerCertificate, cc.IssuerURL != "", cfg.TrustCertificates, cfg.CRLTimeoutValue, defaultCRLMaxResponseSize)
+		if err == nil && !bytes.Equal(record.RawIssuer, cc.Certificate.RawIssuer) {
+			err = fmt.Errorf("CRL [%s] issuer does not match certificate issuer: [%s], [%s]", cc.CRLURL, record.Issuer, cc.Certificate.Issuer.String())
+		}
+		if err != nil {
+			mt.OCSPRevocationMismatch(cfg.Name, method, cc.CertName, false, false)
+			checkErrors = append(checkErrors, fmt.Sprintf("certificate [%s]: [%s]", cc.CertName, err.Error()))
+			continue
+		}
+		if verbose && record.Number != nil {
+			crlNumbers = append(crlNumbers, record.Number.String())
+		}
+
+		mismatch := ocspCRLCompare(certInfo, cc, record, cfg.CRLGracePeriodValue)
+		mt.OCSPRevocationMismatch(cfg.Name, method, cc.CertName, true, mismatch != nil)
+		if mismatch != nil {
+			mismatches = append(mismatches, fmt.Errorf("certificate [%s]: [%w]", cc.CertName, mismatch))
+		}
+	}
+
+	if len(checkErrors) > 0 {
+		le.Strs("crlCheckErrors", checkErrors)
+	}
+	if len(crlNumbers) > 0 {
+		le.Strs("crlCheckNumbers", crlNumbers)
+	}
+	if len(mismatches) > 0 {
+		return newValidationErrorReason(responseErrorContents, ocspReasonRevocationMismatch, errors.Join(mismatches...))
+	}
+	return nil
+}
+
+// ocspCRLCompare сравнивает статус сертификата cc из OCSP ответа certInfo с CRL record. Расхождением считается:
+//   - статус revoked, при том что сертификата нет в CRL, выпущенном позже времени отзыва более чем на grace;
+//   - статус good с thisUpdate позже времени отзыва сертификата по CRL более чем на grace.
+func ocspCRLCompare(certInfo *ocspCertResponseInfo, cc *ocspCertConfig, record *crlRecord, grace time.Duration) error {
+	crlRevocationTime, inCRL := record.Revoked(cc.Certificate.SerialNumber)
+
+	switch {
+	case certInfo.Status == ocspCertStatusRevoked && !inCRL && certInfo.RevokedInfo != nil &&
+		record.ThisUpdate.Sub(certInfo.RevokedInfo.RevocationTime) > grace:
+		return fmt.Errorf("certificate revoked by OCSP at [%s] is not listed in CRL [%s] issued at [%s]",
+			certInfo.RevokedInfo.RevocationTime.UTC().Format(time.RFC3339), record.URL, record.ThisUpdate.UTC().Format(time.RFC3339))
+
+	case certInfo.Status == ocspCertStatusGood && inCRL && certInfo.ThisUpdate.Sub(crlRevocationTime) > grace:
+		return fmt.Errorf("certificate revoked by CRL [%s] at [%s] has OCSP status good at [%s]",
+			record.URL, crlRevocationTime.UTC().Format(time.RFC3339), certInfo.ThisUpdate.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
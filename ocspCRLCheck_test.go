@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOCSPCRLCompare(t *testing.T) {
+	const grace = 10 * time.Minute
+	serial := big.NewInt(0x1234)
+	cc := &ocspCertConfig{CertName: "test"}
+	cc.Certificate = &x509.Certificate{SerialNumber: serial}
+
+	revocationTime := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	listed := &crlRecord{URL: "http://crl.test/listed.crl", revoked: map[string]time.Time{serial.Text(16): revocationTime}}
+	notListed := &crlRecord{URL: "http://crl.test/empty.crl", revoked: map[string]time.Time{}}
+
+	revoked := func(thisUpdate time.Time) *ocspCertResponseInfo {
+		return &ocspCertResponseInfo{
+			Found:       true,
+			Status:      ocspCertStatusRevoked,
+			RevokedInfo: &ocspRevokedInfo{RevocationTime: revocationTime},
+			ThisUpdate:  thisUpdate,
+		}
+	}
+	good := func(thisUpdate time.Time) *ocspCertResponseInfo {
+		return &ocspCertResponseInfo{Found: true, Status: ocspCertStatusGood, ThisUpdate: thisUpdate}
+	}
+	withThisUpdate := func(r *crlRecord, thisUpdate time.Time) *crlRecord {
+		out := *r
+		out.ThisUpdate = thisUpdate
+		return &out
+	}
+
+	tests := []struct {
+		name     string
+		certInfo *ocspCertResponseInfo
+		record   *crlRecord
+		mismatch bool
+	}{
+		// статус revoked, сертификата нет в CRL
+		{"revoked not listed within grace", revoked(revocationTime), withThisUpdate(notListed, revocationTime.Add(grace)), false},
+		{"revoked not listed after grace", revoked(revocationTime), withThisUpdate(notListed, revocationTime.Add(grace+time.Second)), true},
+		{"revoked not listed CRL before revocation", revoked(revocationTime), withThisUpdate(notListed, revocationTime.Add(-time.Hour)), false},
+		// статус good, сертификат есть в CRL
+		{"good listed within grace", good(revocationTime.Add(grace)), withThisUpdate(listed, revocationTime), false},
+		{"good listed after grace", good(revocationTime.Add(grace + time.Second)), withThisUpdate(listed, revocationTime), true},
+		{"good listed OCSP before revocation", good(revocationTime.Add(-time.Hour)), withThisUpdate(listed, revocationTime), false},
+		// согласованные статусы
+		{"revoked listed", revoked(revocationTime.Add(time.Hour)), withThisUpdate(listed, revocationTime.Add(time.Hour)), false},
+		{"good not listed", good(revocationTime.Add(time.Hour)), withThisUpdate(notListed, revocationTime.Add(time.Hour)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ocspCRLCompare(tt.certInfo, cc, tt.record, grace)
+			if (err != nil) != tt.mismatch {
+				t.Errorf("ocspCRLCompare() = %v, want mismatch %t", err, tt.mismatch)
+			}
+		})
+	}
+}
+
+// TestCRLCacheGetStale проверяет, что кеш не принимает CRL с наступившим nextUpdate.
+func TestCRLCacheGetStale(t *testing.T) {
+	issuer, issuerKey := testCA(t, "test CA")
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		crl     []byte
+		wantErr string
+	}{
+		{"fresh", testCRL(t, issuer, issuerKey, 1, now.Add(-time.Minute), now.Add(time.Hour)), ""},
+		{"stale", testCRL(t, issuer, issuerKey, 1, now.Add(-2*time.Hour), now.Add(-time.Hour)), "stale CRL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Write(tt.crl)
+			}))
+			defer srv.Close()
+
+			record, err := newCRLCache().Get(context.Background(), srv.URL, issuer, false, nil, 5*time.Second, defaultCRLMaxResponseSize)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				if record.URL != srv.URL {
+					t.Errorf("URL = %q, want %q", record.URL, srv.URL)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Get error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestCRLCacheGetFailure проверяет, что ошибка загрузки CRL запоминается (CRL не загружается при каждой
+// проверке), кроме прерывания загрузки отменой контекста, и сбрасывается CRL, проверенным монитором CRL.
+func TestCRLCacheGetFailure(t *testing.T) {
+	issuer, issuerKey := testCA(t, "test CA")
+	now := time.Now()
+	staleCRL := testCRL(t, issuer, issuerKey, 1, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	validCRL := testCRL(t, issuer, issuerKey, 2, now.Add(-time.Minute), now.Add(time.Hour))
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Write(staleCRL)
+	}))
+	defer srv.Close()
+
+	cache := newCRLCache()
+	get := func(ctx context.Context) error {
+		_, err := cache.Get(ctx, srv.URL, issuer, false, nil, 5*time.Second, defaultCRLMaxResponseSize)
+		return err
+	}
+
+	// прерванная загрузка не запоминается
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := get(canceled); err == nil {
+		t.Fatal("Get with canceled context: no error")
+	}
+	for i := range 3 {
+		if err := get(context.Background()); err == nil || !strings.Contains(err.Error(), "stale CRL") {
+			t.Fatalf("Get %d error = %v, want stale CRL", i, err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("CRL requests = %d, want 1", n)
+	}
+
+	rl, err := crlParse(validCRL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put(srv.URL, rl, now)
+	if err := get(context.Background()); err != nil {
+		t.Errorf("Get after Put: %v", err)
+	}
+}
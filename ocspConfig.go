@@ -1,44 +1,215 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"time"
 )
 
 // значения по умолчанию для "опасных" флагов
 const (
-	defaultOCSPNonceSize             = 8    // байт
-	defaultOCSPMaxResponseSize int64 = 8192 // байт
-	defaultOCSPRetryInterval         = "15m"
+	defaultOCSPNonceSize               = 8    // байт
+	defaultOCSPMaxResponseSize   int64 = 8192 // байт
+	defaultOCSPRetryInterval           = "15m"
+	defaultOCSPCertExpiryWarning       = "720h,168h,24h" // 30, 7 и 1 день
+	defaultOCSPExpectedStatus          = "good"
+	defaultOCSPMethod                  = ocspMethodPost
+	defaultOCSPKind                    = ocspKindStatus
+	defaultOCSPIssuerDigestOID         = "1.3.14.3.2.26" // SHA-1
+	defaultOCSPCRLGracePeriod          = "1h"
+	defaultOCSPCRLTimeout              = "60s"
+)
+
+// Допустимые значения способа отправки OCSP запросов (ocspConfig.Method)
+const (
+	ocspMethodGet  = "get"
+	ocspMethodPost = "post"
+	ocspMethodBoth = "both"
+)
+
+// Допустимые значения вида проверки (ocspConfig.Kind)
+const (
+	ocspKindStatus        = "status"
+	ocspKindUnknownSerial = "unknownserial"
+	ocspKindMalformed     = "malformed"
 )
 
 // ocspConfig определяет структуру с настройками взаимодействия с OCSP сервером.
 type ocspConfig struct {
+	// Name содержит имя цели мониторинга. Используется в протоколе и в метках метрик (target).
+	// Должно быть уникальным среди целей OCSP. Может быть не указано, если цель одна.
+	Name string `json:"name" yaml:"name"`
+
 	// Disabled флаг позволяет отключить опрос OCSP сервера при установке в значение true.
 	Disabled bool `json:"disabled" yaml:"disabled"`
 
 	// URL OCSP сервера
+	// Если не указан, то берется из расширения AIA (id-ad-ocsp) сертификата Cert/CertFile.
 	URL string `json:"url" yaml:"url"`
 
+	// Признак того, что URL получен из расширения AIA сертификата.
+	URLDiscovered bool `json:"-" yaml:"-"`
+
+	// Method определяет способ отправки запросов (RFC6960, Appendix A.1): get, post или both.
+	// При значении both запросы отправляются обоими способами (по отдельному монитору на каждый способ).
+	// По умолчанию устанавливается в post.
+	Method       string   `json:"method" yaml:"method"`
+	MethodValues []string `json:"-" yaml:"-"` // HTTP методы запросов
+
+	// Kind определяет вид проверки:
+	//   - status - запрос статуса сертификатов из настроек (основного и Certs);
+	//   - unknownserial - запрос статуса случайного серийного номера издателя основного сертификата.
+	//     Ожидается статус unknown или revoked (RFC6960 2.2, "extended revoked"), статус good считается ошибкой;
+	//   - malformed - отправка заведомо некорректного (усеченного) запроса. Ожидается ответ со статусом
+	//     malformedRequest(1).
+	// Поля Certs, ExpectedStatus используются только для вида status.
+	// По умолчанию устанавливается в status.
+	Kind string `json:"kind" yaml:"kind"`
+
 	// Timeout сетевого взаимодействия. Должно быть значение допустимое для time.ParseDuration().
 	// Пустая строка - без таймаута.
 	Timeout      string        `json:"timeout" yaml:"timeout"`
 	TimeoutValue time.Duration `json:"-" yaml:"-"`
 
 	// DigestOID OID алгоритма хеширования, использованного для вычисления значений полей NameDigest, KeyDigest (компонентов CertID)
+	// Если указан сертификат издателя (IssuerCert/IssuerCertFile) и поле пустое, то используется SHA-1.
 	DigestOID      string                `json:"digestoid" yaml:"digestoid"`
 	DigestOIDValue asn1.ObjectIdentifier `json:"-" yaml:"-"`
 
+	// Настройки основного сертификата, чей статус проверяем (поля на уровне цели мониторинга).
+	ocspCertConfig `yaml:",inline"`
+
+	// Certs содержит дополнительные сертификаты, статусы которых запрашиваются в том же OCSP запросе
+	// (по одному CertID в requestList на каждый сертификат). Статус каждого сертификата проверяется отдельно.
+	// Значения DigestOID и параметры проверки актуальности ответа общие для всех сертификатов.
+	Certs []*ocspCertConfig `json:"certs" yaml:"certs"`
+
+	// ResponderCert содержит сертификат OCSP сервера (ASN.1 DER в base64), которым проверяется подпись ответа.
+	// Если установлено это поле, то значение в поле ResponderCertFile игнорируется.
+	// Если не указано ни одно из полей, то подпись проверяется сертификатом из ответа.
+	ResponderCert string `json:"respondercert" yaml:"respondercert"`
+
+	// ResponderCertFile содержит путь к файлу с сертификатом OCSP сервера (ASN.1 DER или PEM).
+	// Файл читаем только если поле ResponderCert пустое.
+	ResponderCertFile string `json:"respondercertfile" yaml:"respondercertfile"`
+
+	// Разобранный сертификат OCSP сервера. Поле получаем путем обработки полей ResponderCert/ResponderCertFile.
+	// Если nil, то подпись ответа проверяется сертификатом, вложенным в ответ.
+	ResponderCertificate *x509.Certificate `json:"-" yaml:"-"`
+
+	// TrustFile содержит путь к файлу доверенных сертификатов в PEM (один или несколько сертификатов)
+	// или в ASN.1 DER (один сертификат), дополняющих общее хранилище (секция trust). Если доверенные
+	// сертификаты есть, то цепочка сертификата OCSP сервера (кроме закрепленного ResponderCert) должна
+	// строиться до одного из них.
+	TrustFile         string              `json:"trustfile" yaml:"trustfile"`
+	TrustCertificates []*x509.Certificate `json:"-" yaml:"-"`
+
+	// RequestorCert содержит сертификат, которым подписываются запросы (ASN.1 DER в base64).
+	// Если указан (вместе с RequestorKeyFile), то запросы подписываются (поле optionalSignature), а
+	// имя субъекта сертификата указывается в поле requestorName запроса.
+	// Если установлено это поле, то значение в поле RequestorCertFile игнорируется.
+	RequestorCert string `json:"requestorcert" yaml:"requestorcert"`
+
+	// RequestorCertFile содержит путь к файлу с сертификатом, которым подписываются запросы (ASN.1 DER или PEM).
+	// Файл читаем только если поле RequestorCert пустое.
+	RequestorCertFile string `json:"requestorcertfile" yaml:"requestorcertfile"`
+
+	// RequestorKeyFile содержит путь к файлу с закрытым ключом (RSA или ECDSA) сертификата RequestorCert/RequestorCertFile.
+	// Файл может содержать ключ в PEM (PKCS#8, PKCS#1, SEC1) или в ASN.1 DER (PKCS#8).
+	RequestorKeyFile string `json:"requestorkeyfile" yaml:"requestorkeyfile"`
+
+	// Разобранные сертификат и закрытый ключ для подписи запросов. nil, если запросы не подписываются.
+	RequestorCertificate *x509.Certificate `json:"-" yaml:"-"`
+	RequestorKey         crypto.Signer     `json:"-" yaml:"-"`
+
+	// MaxProducedAtAge содержит максимально допустимый возраст ответа (ResponseData.producedAt).
+	// Должно быть значение допустимое для time.ParseDuration(). Пустая строка - без проверки.
+	MaxProducedAtAge      string        `json:"maxproducedatage" yaml:"maxproducedatage"`
+	MaxProducedAtAgeValue time.Duration `json:"-" yaml:"-"`
+
+	// MaxThisUpdateAge содержит максимально допустимый возраст статуса сертификата (SingleResponse.thisUpdate).
+	// Должно быть значение допустимое для time.ParseDuration(). Пустая строка - без проверки.
+	// Вне зависимости от значения поля проверяется, что nextUpdate (если указано в ответе) еще не наступило.
+	MaxThisUpdateAge      string        `json:"maxthisupdateage" yaml:"maxthisupdateage"`
+	MaxThisUpdateAgeValue time.Duration `json:"-" yaml:"-"`
+
+	// NonceSize содержит размер nonce в байтах. Если установлено 0, то nonce не используется.
+	// В 0 можно установить только параметрами командной строки.
+	NonceSize int `json:"noncesize" yaml:"noncesize"`
+
+	// RetryCount содержит количество повторов отправки запросов о статусе.
+	// 0 - бесконечно.
+	RetryCount int `json:"retrycount" yaml:"retrycount"`
+
+	// RetryInterval содержит временной интервал между двумя попытками отправки запросов о статусе.
+	// Должно быть значение допустимое для time.ParseDuration().
+	// По умолчанию устанавливается в 15m.
+	// Пустая строка - без интервала. Использовать в этом режиме крайне НЕ рекомендуется.
+	// Режим работы без интервала можно установить только параметром командной строки.
+	RetryInterval      string        `json:"retryinterval" yaml:"retryinterval"`
+	RetryIntervalValue time.Duration `json:"-" yaml:"-"`
+
+	// CertExpiryWarning содержит пороги (через запятую) до окончания срока действия запрашиваемых сертификатов
+	// и сертификата OCSP сервера.
+	// При прохождении каждого порога и при истечении срока действия в протокол приложения однократно пишется
+	// предупреждение (уровень warn). Пока до окончания срока действия меньше наибольшего порога, предупреждение
+	// также выводится в протокол каждой проверки (поле certWarnings).
+	// Каждый порог должен быть значением допустимым для time.ParseDuration().
+	// По умолчанию устанавливается в 720h,168h,24h (30, 7 и 1 день).
+	// 0 - предупреждения не выводятся (метрика ncatos_cert_not_after_seconds обновляется всегда).
+	CertExpiryWarning       string          `json:"certexpirywarning" yaml:"certexpirywarning"`
+	CertExpiryWarningValues []time.Duration `json:"-" yaml:"-"` // пороги в порядке убывания
+
+	// CRLCheck флаг включает сверку статусов запрашиваемых сертификатов (только для вида status) с CRL,
+	// загруженным по первому http(s) URL расширения cRLDistributionPoints каждого сертификата. Статус good
+	// для сертификата из CRL и статус revoked для сертификата, отсутствующего в CRL, считаются ошибкой
+	// содержимого (contents) с причиной revocation_mismatch, если расхождение превышает CRLGracePeriod.
+	// CRL берется из кеша (пополняется мониторами CRL) или загружается не чаще раза в час.
+	CRLCheck bool `json:"crlcheck" yaml:"crlcheck"`
+
+	// CRLGracePeriod содержит допустимую задержку распространения сведений об отзыве между OCSP и CRL:
+	// сертификат, отозванный по OCSP, должен присутствовать в CRL, выпущенном позже времени отзыва более
+	// чем на CRLGracePeriod, а сертификат из CRL не должен иметь статус good в OCSP ответе с thisUpdate,
+	// превышающим время отзыва более чем на CRLGracePeriod.
+	// Должно быть значение допустимое для time.ParseDuration(). По умолчанию устанавливается в 1h.
+	CRLGracePeriod      string        `json:"crlgraceperiod" yaml:"crlgraceperiod"`
+	CRLGracePeriodValue time.Duration `json:"-" yaml:"-"`
+
+	// CRLTimeout содержит таймаут загрузки CRL для сверки статусов. По умолчанию устанавливается в 60s.
+	// Должен быть больше 0: загрузка CRL выполняется под блокировкой записи кеша CRL.
+	// Должно быть значение допустимое для time.ParseDuration().
+	CRLTimeout      string        `json:"crltimeout" yaml:"crltimeout"`
+	CRLTimeoutValue time.Duration `json:"-" yaml:"-"`
+
+	// MaxResponseSize определяет максимально допустимый размер ответа от сервера OCSP в байтах.
+	// Если установлен в 0, то размер не ограничен.
+	MaxResponseSize *int64 `json:"maxresponsesize" yaml:"maxresponsesize"`
+}
+
+// ocspCertConfig определяет сертификат, статус которого запрашивается у OCSP сервера, и способ
+// формирования его CertID.
+type ocspCertConfig struct {
+	// CertName содержит имя сертификата. Используется в протоколе и в метках метрик (cert).
+	// По умолчанию - серийный номер сертификата (hex).
+	CertName string `json:"certname" yaml:"certname"`
+
 	// NameDigest содержит значение хеша имени издателя сертификата в поле Cert/CertFile, закодированное в base64.
+	// Может быть не указано, если указан сертификат издателя (IssuerCert/IssuerCertFile). Если указаны оба,
+	// то значения должны совпадать.
 	NameDigest      string `json:"namedigest" yaml:"namedigest"`
 	NameDigestValue []byte `json:"-" yaml:"-"`
 
 	// KeyDigest содержит значение хеша открытого ключа издателя сертификата в поле Cert/CertFile, закодированное в base64.
+	// Может быть не указано, если указан сертификат издателя (IssuerCert/IssuerCertFile). Если указаны оба,
+	// то значения должны совпадать.
 	KeyDigest      string `json:"keydigest" yaml:"keydigest"`
 	KeyDigestValue []byte `json:"-" yaml:"-"`
 
@@ -52,29 +223,62 @@ type ocspConfig struct {
 	// Файл читаем только если поле Cert пустое. При этом хотя бы одно из этих полей должно быть указано.
 	CertFile string `json:"certfile" yaml:"certfile"`
 
+	// Признак того, что кроме ExpectedStatusValue ожидаемым считается статус revoked
+	// (используется для запроса статуса случайного серийного номера).
+	acceptRevoked bool
+
 	// Разобранный сертификат. Поле получаем путем обработки полей Cert - читаем из конфига или
 	// CertFile - читаем из файла.
 	Certificate *x509.Certificate `json:"-" yaml:"-"`
 
-	// NonceSize содержит размер nonce в байтах. Если установлено 0, то nonce не используется.
-	// В 0 можно установить только параметрами командной строки.
-	NonceSize int `json:"noncesize" yaml:"noncesize"`
+	// IssuerCert содержит сертификат издателя сертификата Cert/CertFile (ASN.1 DER в base64).
+	// Если указан, то хеши имени и ключа издателя (NameDigest, KeyDigest) вычисляются из него, а также
+	// проверяется, что сертификат Cert/CertFile выпущен этим издателем.
+	// Если установлено это поле, то значение в поле IssuerCertFile игнорируется.
+	IssuerCert string `json:"issuercert" yaml:"issuercert"`
 
-	// RetryCount содержит количество повторов отправки запросов о статусе.
-	// 0 - бесконечно.
-	RetryCount int `json:"retrycount" yaml:"retrycount"`
+	// IssuerCertFile содержит путь к файлу с сертификатом издателя (ASN.1 DER или PEM).
+	// Файл читаем только если поле IssuerCert пустое.
+	IssuerCertFile string `json:"issuercertfile" yaml:"issuercertfile"`
 
-	// RetryInterval содержит временной интервал между двумя попытками отправки запросов о статусе.
-	// Должно быть значение допустимое для time.ParseDuration().
-	// По умолчанию устанавливается в 15m.
-	// Пустая строка - без интервала. Использовать в этом режиме крайне НЕ рекомендуется.
-	// Режим работы без интервала можно установить только параметром командной строки.
-	RetryInterval      string        `json:"retryinterval" yaml:"retryinterval"`
-	RetryIntervalValue time.Duration `json:"-" yaml:"-"`
+	// Разобранный сертификат издателя. Поле получаем путем обработки полей IssuerCert/IssuerCertFile.
+	// nil, если издатель не указан.
+	IssuerCertificate *x509.Certificate `json:"-" yaml:"-"`
 
-	// MaxResponseSize определяет максимально допустимый размер ответа от сервера OCSP в байтах.
-	// Если установлен в 0, то размер не ограничен.
-	MaxResponseSize *int64 `json:"maxresponsesize" yaml:"maxresponsesize"`
+	// URL, по которому загружен сертификат издателя (caIssuers расширения AIA сертификата Cert/CertFile).
+	// Сертификат издателя загружается, если не указаны ни сертификат издателя, ни NameDigest/KeyDigest.
+	// Пустая строка, если сертификат издателя не загружался или еще не загружен.
+	IssuerURL string `json:"-" yaml:"-"`
+
+	// Загрузка сертификата издателя по AIA при проверках (nil, если сертификат издателя не загружается).
+	// До загрузки IssuerCertificate и хеши издателя не установлены, см. resolveIssuer.
+	discovery *aiaIssuerDiscovery
+
+	// ExpectedStatus содержит ожидаемый статус сертификата в ответе OCSP сервера: good, revoked или unknown.
+	// Несовпадение статуса в ответе с ожидаемым считается ошибкой содержимого (contents).
+	// По умолчанию устанавливается в good.
+	ExpectedStatus      string         `json:"expectedstatus" yaml:"expectedstatus"`
+	ExpectedStatusValue ocspCertStatus `json:"-" yaml:"-"`
+
+	// URL CRL (расширение cRLDistributionPoints сертификата Cert/CertFile), с которым сверяется статус
+	// сертификата. Пустая строка, если сверка с CRL не выполняется.
+	CRLURL string `json:"-" yaml:"-"`
+}
+
+// TargetName возвращает имя цели мониторинга.
+func (cfg *ocspConfig) TargetName() string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Name
+}
+
+// SetTargetName устанавливает имя цели мониторинга.
+func (cfg *ocspConfig) SetTargetName(name string) {
+	if cfg == nil {
+		return
+	}
+	cfg.Name = name
 }
 
 // SetDefaults позволяет инициализировать не заданные/критичные поля значениями по умолчанию.
@@ -88,6 +292,21 @@ func (cfg *ocspConfig) SetDefaults() {
 	if cfg.RetryInterval == "" {
 		cfg.RetryInterval = defaultOCSPRetryInterval
 	}
+	if cfg.CertExpiryWarning == "" {
+		cfg.CertExpiryWarning = defaultOCSPCertExpiryWarning
+	}
+	if cfg.Method == "" {
+		cfg.Method = defaultOCSPMethod
+	}
+	if cfg.Kind == "" {
+		cfg.Kind = defaultOCSPKind
+	}
+	if cfg.CRLGracePeriod == "" {
+		cfg.CRLGracePeriod = defaultOCSPCRLGracePeriod
+	}
+	if cfg.CRLTimeout == "" {
+		cfg.CRLTimeout = defaultOCSPCRLTimeout
+	}
 	if cfg.MaxResponseSize == nil {
 		cfg.MaxResponseSize = new(int64)
 	}
@@ -110,6 +329,10 @@ func (cfg *ocspConfig) UpdateCommandLine(givenFlags []*flag.Flag) {
 			cfg.URL = *clpOCSPURL
 		case "ocsp.timeout":
 			cfg.Timeout = *clpOCSPTimeout
+		case "ocsp.method":
+			cfg.Method = *clpOCSPMethod
+		case "ocsp.kind":
+			cfg.Kind = *clpOCSPKind
 		case "ocsp.digestoid":
 			cfg.DigestOID = *clpOCSPDigestOID
 		case "ocsp.namedigest":
@@ -120,12 +343,42 @@ func (cfg *ocspConfig) UpdateCommandLine(givenFlags []*flag.Flag) {
 			cfg.Cert = *clpOCSPCert
 		case "ocsp.certfile":
 			cfg.CertFile = *clpOCSPCertFile
+		case "ocsp.issuercert":
+			cfg.IssuerCert = *clpOCSPIssuerCert
+		case "ocsp.issuercertfile":
+			cfg.IssuerCertFile = *clpOCSPIssuerCertFile
+		case "ocsp.respondercert":
+			cfg.ResponderCert = *clpOCSPResponderCert
+		case "ocsp.respondercertfile":
+			cfg.ResponderCertFile = *clpOCSPResponderCertFile
+		case "ocsp.trustfile":
+			cfg.TrustFile = *clpOCSPTrustFile
+		case "ocsp.requestorcert":
+			cfg.RequestorCert = *clpOCSPRequestorCert
+		case "ocsp.requestorcertfile":
+			cfg.RequestorCertFile = *clpOCSPRequestorCertFile
+		case "ocsp.requestorkeyfile":
+			cfg.RequestorKeyFile = *clpOCSPRequestorKeyFile
+		case "ocsp.expectedstatus":
+			cfg.ExpectedStatus = *clpOCSPExpectedStatus
+		case "ocsp.maxproducedatage":
+			cfg.MaxProducedAtAge = *clpOCSPMaxProducedAtAge
+		case "ocsp.maxthisupdateage":
+			cfg.MaxThisUpdateAge = *clpOCSPMaxThisUpdateAge
 		case "ocsp.noncesize":
 			cfg.NonceSize = *clpOCSPNonceSize
 		case "ocsp.retrycount":
 			cfg.RetryCount = *clpOCSPRetryCount
 		case "ocsp.retryinterval":
 			cfg.RetryInterval = *clpOCSPRetryInterval
+		case "ocsp.certexpirywarning":
+			cfg.CertExpiryWarning = *clpOCSPCertExpiryWarning
+		case "ocsp.crlcheck":
+			cfg.CRLCheck = *clpOCSPCRLCheck
+		case "ocsp.crlgraceperiod":
+			cfg.CRLGracePeriod = *clpOCSPCRLGracePeriod
+		case "ocsp.crltimeout":
+			cfg.CRLTimeout = *clpOCSPCRLTimeout
 		case "ocsp.maxresponsesize":
 			*cfg.MaxResponseSize = *clpOCSPMaxResponseSize
 		}
@@ -143,10 +396,6 @@ func (cfg *ocspConfig) Validate() error {
 		return nil
 	}
 
-	if cfg.URL == "" {
-		return errors.New("invalid OCSP config: empty URL")
-	}
-
 	if cfg.Timeout != "" {
 		cfg.TimeoutValue, err = time.ParseDuration(cfg.Timeout)
 		if err != nil {
@@ -154,30 +403,109 @@ func (cfg *ocspConfig) Validate() error {
 		}
 	}
 
+	// для вычисления хешей по сертификату издателя по умолчанию используем SHA-1
+	if cfg.DigestOID == "" {
+		for _, cc := range cfg.certConfigs() {
+			if cc.issuerGiven() || cc.issuerDiscover() {
+				cfg.DigestOID = defaultOCSPIssuerDigestOID
+				break
+			}
+		}
+	}
+
 	cfg.DigestOIDValue, err = oidToAsn(cfg.DigestOID)
 	if err != nil {
 		return fmt.Errorf("invalid OCSP config: failed to parse digestoid: [%w]", err)
 	}
 
-	cfg.NameDigestValue, err = base64.StdEncoding.DecodeString(cfg.NameDigest)
-	if err != nil {
-		return fmt.Errorf("invalid OCSP config: failed to parse OCSP namedigest: [%w]", err)
+	if err = cfg.ocspCertConfig.validate(cfg.DigestOIDValue, cfg.TimeoutValue); err != nil {
+		return fmt.Errorf("invalid OCSP config: [%w]", err)
 	}
-	if len(cfg.NameDigestValue) == 0 {
-		return errors.New("invalid OCSP config: decoded OCSP namedigest is empty")
+
+	if cfg.URL == "" {
+		cfg.URL = aiaHTTPURL(cfg.Certificate.OCSPServer)
+		if cfg.URL == "" {
+			return errors.New("invalid OCSP config: empty URL and no OCSP server URL in certificate AIA extension")
+		}
+		cfg.URLDiscovered = true
 	}
 
-	cfg.KeyDigestValue, err = base64.StdEncoding.DecodeString(cfg.KeyDigest)
-	if err != nil {
-		return fmt.Errorf("invalid OCSP config: failed to parse OCSP keydigest: [%w]", err)
+	// имена сертификатов используются в метках метрик и должны быть уникальными
+	certNames := map[string]bool{cfg.CertName: true}
+	for i, cc := range cfg.Certs {
+		if cc == nil {
+			return fmt.Errorf("invalid OCSP config: empty certs[%d]", i)
+		}
+		if err = cc.validate(cfg.DigestOIDValue, cfg.TimeoutValue); err != nil {
+			return fmt.Errorf("invalid OCSP config: certs[%d]: [%w]", i, err)
+		}
+		if certNames[cc.CertName] {
+			return fmt.Errorf("invalid OCSP config: duplicate certificate name: [%s]", cc.CertName)
+		}
+		certNames[cc.CertName] = true
 	}
-	if len(cfg.KeyDigestValue) == 0 {
-		return errors.New("invalid OCSP config: decoded OCSP keydigest is empty")
+
+	if cfg.ResponderCert != "" || cfg.ResponderCertFile != "" {
+		cfg.ResponderCertificate, err = loadCertificate(cfg.ResponderCert, cfg.ResponderCertFile)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to load responder certificate: [%w]", err)
+		}
 	}
 
-	cfg.Certificate, err = loadCertificate(cfg.Cert, cfg.CertFile)
-	if err != nil {
-		return fmt.Errorf("invalid OCSP config: failed to load certificate: [%w]", err)
+	if cfg.TrustFile != "" {
+		cfg.TrustCertificates, err = loadCertificates(cfg.TrustFile)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to load trustfile: [%w]", err)
+		}
+	}
+
+	requestorCertGiven := cfg.RequestorCert != "" || cfg.RequestorCertFile != ""
+	if requestorCertGiven != (cfg.RequestorKeyFile != "") {
+		return errors.New("invalid OCSP config: requestor certificate and requestorkeyfile must be given together")
+	}
+	if requestorCertGiven {
+		cfg.RequestorCertificate, err = loadCertificate(cfg.RequestorCert, cfg.RequestorCertFile)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to load requestor certificate: [%w]", err)
+		}
+		cfg.RequestorKey, err = loadPrivateKey(cfg.RequestorKeyFile)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to load requestor key: [%w]", err)
+		}
+		if pub, ok := cfg.RequestorKey.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(cfg.RequestorCertificate.PublicKey) {
+			return errors.New("invalid OCSP config: requestor key does not match requestor certificate")
+		}
+	}
+
+	switch cfg.Kind {
+	case ocspKindStatus, ocspKindUnknownSerial, ocspKindMalformed:
+	default:
+		return fmt.Errorf("invalid OCSP config: unknown kind: [%s]", cfg.Kind)
+	}
+
+	switch cfg.Method {
+	case ocspMethodGet:
+		cfg.MethodValues = []string{http.MethodGet}
+	case ocspMethodPost:
+		cfg.MethodValues = []string{http.MethodPost}
+	case ocspMethodBoth:
+		cfg.MethodValues = []string{http.MethodGet, http.MethodPost}
+	default:
+		return fmt.Errorf("invalid OCSP config: unknown method: [%s]", cfg.Method)
+	}
+
+	if cfg.MaxProducedAtAge != "" {
+		cfg.MaxProducedAtAgeValue, err = time.ParseDuration(cfg.MaxProducedAtAge)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to parse maxproducedatage: [%w]", err)
+		}
+	}
+
+	if cfg.MaxThisUpdateAge != "" {
+		cfg.MaxThisUpdateAgeValue, err = time.ParseDuration(cfg.MaxThisUpdateAge)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to parse maxthisupdateage: [%w]", err)
+		}
 	}
 
 	if cfg.NonceSize < 0 {
@@ -195,6 +523,36 @@ func (cfg *ocspConfig) Validate() error {
 		}
 	}
 
+	cfg.CertExpiryWarningValues, err = certExpiryParseThresholds(cfg.CertExpiryWarning)
+	if err != nil {
+		return fmt.Errorf("invalid OCSP config: failed to parse certexpirywarning: [%w]", err)
+	}
+
+	if cfg.CRLCheck && cfg.Kind == ocspKindStatus {
+		for _, cc := range cfg.certConfigs() {
+			cc.CRLURL = aiaHTTPURL(cc.Certificate.CRLDistributionPoints)
+			if cc.CRLURL == "" {
+				return fmt.Errorf("invalid OCSP config: crlcheck: no CRL distribution point URL in certificate: [%s]", cc.CertName)
+			}
+		}
+
+		cfg.CRLGracePeriodValue, err = time.ParseDuration(cfg.CRLGracePeriod)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to parse crlgraceperiod: [%w]", err)
+		}
+		if cfg.CRLGracePeriodValue < 0 {
+			return errors.New("invalid OCSP config: crlgraceperiod")
+		}
+
+		cfg.CRLTimeoutValue, err = time.ParseDuration(cfg.CRLTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid OCSP config: failed to parse crltimeout: [%w]", err)
+		}
+		if cfg.CRLTimeoutValue <= 0 {
+			return errors.New("invalid OCSP config: crltimeout must be positive")
+		}
+	}
+
 	if cfg.MaxResponseSize == nil {
 		return errors.New("invalid OCSP config: nil maxresponsesize")
 	}
@@ -204,3 +562,134 @@ func (cfg *ocspConfig) Validate() error {
 
 	return nil
 }
+
+// discoveredURL возвращает URL OCSP сервера, если он получен из AIA сертификата (иначе пустую строку).
+func (cfg *ocspConfig) discoveredURL() string {
+	if cfg.URLDiscovered {
+		return cfg.URL
+	}
+	return ""
+}
+
+// certConfigs возвращает все сертификаты цели мониторинга в порядке их следования в OCSP запросе
+// (основной сертификат первый).
+func (cfg *ocspConfig) certConfigs() []*ocspCertConfig {
+	return append([]*ocspCertConfig{&cfg.ocspCertConfig}, cfg.Certs...)
+}
+
+// issuerGiven возвращает true, если указан сертификат издателя.
+func (cc *ocspCertConfig) issuerGiven() bool {
+	return cc.IssuerCert != "" || cc.IssuerCertFile != ""
+}
+
+// issuerDiscover возвращает true, если сертификат издателя необходимо загрузить по AIA
+// (не указаны ни сертификат издателя, ни хеши издателя).
+func (cc *ocspCertConfig) issuerDiscover() bool {
+	return !cc.issuerGiven() && cc.NameDigest == "" && cc.KeyDigest == ""
+}
+
+// validate загружает сертификат и сертификат издателя, вычисляет (или проверяет) значения хешей
+// издателя алгоритмом digestOID и ожидаемый статус сертификата.
+// timeout - таймаут загрузки сертификата издателя по AIA (сам сертификат загружается при проверках).
+func (cc *ocspCertConfig) validate(digestOID asn1.ObjectIdentifier, timeout time.Duration) error {
+	var err error
+	issuerGiven, issuerDiscover := cc.issuerGiven(), cc.issuerDiscover()
+
+	cc.NameDigestValue, err = base64.StdEncoding.DecodeString(cc.NameDigest)
+	if err != nil {
+		return fmt.Errorf("failed to parse OCSP namedigest: [%w]", err)
+	}
+	if len(cc.NameDigestValue) == 0 && !issuerGiven && !issuerDiscover {
+		return errors.New("decoded OCSP namedigest is empty")
+	}
+
+	cc.KeyDigestValue, err = base64.StdEncoding.DecodeString(cc.KeyDigest)
+	if err != nil {
+		return fmt.Errorf("failed to parse OCSP keydigest: [%w]", err)
+	}
+	if len(cc.KeyDigestValue) == 0 && !issuerGiven && !issuerDiscover {
+		return errors.New("decoded OCSP keydigest is empty")
+	}
+
+	cc.Certificate, err = loadCertificate(cc.Cert, cc.CertFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: [%w]", err)
+	}
+
+	switch {
+	case issuerGiven:
+		issuer, err := loadCertificate(cc.IssuerCert, cc.IssuerCertFile)
+		if err != nil {
+			return fmt.Errorf("failed to load issuer certificate: [%w]", err)
+		}
+		if err = cc.setIssuer(digestOID, issuer); err != nil {
+			return err
+		}
+
+	case issuerDiscover:
+		// сертификат издателя загружается при проверках (см. resolveIssuer)
+		if len(cc.Certificate.IssuingCertificateURL) == 0 {
+			return errors.New("no issuer certificate, issuer digests or caIssuers URL in certificate AIA extension")
+		}
+		cc.discovery = newAIAIssuerDiscovery(cc.Certificate, timeout)
+	}
+
+	if cc.ExpectedStatus == "" {
+		cc.ExpectedStatus = defaultOCSPExpectedStatus
+	}
+	cc.ExpectedStatusValue, err = ocspParseCertStatusName(cc.ExpectedStatus)
+	if err != nil {
+		return fmt.Errorf("failed to parse expectedstatus: [%w]", err)
+	}
+
+	if cc.CertName == "" {
+		cc.CertName = cc.Certificate.SerialNumber.Text(16)
+	}
+	return nil
+}
+
+// setIssuer проверяет, что сертификат выпущен издателем issuer, вычисляет хеши издателя алгоритмом
+// digestOID (и сверяет их с указанными в конфигурации) и устанавливает сертификат издателя.
+func (cc *ocspCertConfig) setIssuer(digestOID asn1.ObjectIdentifier, issuer *x509.Certificate) error {
+	if err := verifyIssuedBy(cc.Certificate, issuer); err != nil {
+		return fmt.Errorf("certificate is not issued by issuer certificate: [%w]", err)
+	}
+
+	nameDigest, keyDigest, err := ocspIssuerDigests(digestOID, issuer)
+	if err != nil {
+		return err
+	}
+	if len(cc.NameDigestValue) != 0 && !bytes.Equal(cc.NameDigestValue, nameDigest) {
+		return errors.New("namedigest does not match issuer certificate")
+	}
+	if len(cc.KeyDigestValue) != 0 && !bytes.Equal(cc.KeyDigestValue, keyDigest) {
+		return errors.New("keydigest does not match issuer certificate")
+	}
+	cc.IssuerCertificate = issuer
+	cc.NameDigestValue, cc.KeyDigestValue = nameDigest, keyDigest
+	return nil
+}
+
+// resolveIssuer загружает по AIA сертификат издателя (загрузка прерывается при отмене ctx), если он загружается
+// при проверках и еще не установлен, и устанавливает его (см. setIssuer). Ошибки загрузки и установки
+// сертификата издателя возвращаются как *aiaDiscoveryError. Безопасен для вызова из разных goroutine-н.
+func (cc *ocspCertConfig) resolveIssuer(ctx context.Context, digestOID asn1.ObjectIdentifier) error {
+	d := cc.discovery
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cc.IssuerCertificate != nil {
+		return nil
+	}
+
+	if err := d.fetch(ctx); err != nil {
+		return fmt.Errorf("certificate [%s]: [%w]", cc.CertName, err)
+	}
+	if err := cc.setIssuer(digestOID, d.issuer); err != nil {
+		return fmt.Errorf("certificate [%s]: [%w]", cc.CertName, d.reject(err))
+	}
+	cc.IssuerURL = d.url
+	return nil
+}
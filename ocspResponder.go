@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+/*
+  Проверка полномочий OCSP сервера, подписавшего ответ (RFC6960 4.2.2.2): ответ должен быть подписан
+  издателем проверяемого сертификата (CA) или делегированным OCSP сервером, сертификат которого выпущен
+  CA и содержит расширенное назначение ключа id-kp-OCSPSigning.
+*/
+
+// Способы авторизации OCSP сервера (метка authorization метрики ocsp_responder_info)
+const (
+	ocspResponderCA        = "ca"        // ответ подписан издателем проверяемого сертификата
+	ocspResponderDelegated = "delegated" // ответ подписан делегированным OCSP сервером
+	ocspResponderPinned    = "pinned"    // ответ подписан закрепленным в настройках сертификатом
+)
+
+// Теги вариантов ResponderID.
+//
+//	ResponderID ::= CHOICE {
+//	  byName   [1] Name,
+//	  byKey    [2] KeyHash }
+//
+//	KeyHash ::= OCTET STRING -- SHA-1 hash of responder's public key
+//	                         -- (excluding the tag and length fields)
+const (
+	ocspResponderIDByName = 1
+	ocspResponderIDByKey  = 2
+)
+
+// ocspResponderIDMatches проверяет, что идентификатор OCSP сервера rawID (ResponseData.responderID)
+// соответствует сертификату cert.
+func ocspResponderIDMatches(rawID *asn1.RawValue, cert *x509.Certificate) (bool, error) {
+	if rawID.Class != asn1.ClassContextSpecific {
+		return false, fmt.Errorf("invalid OCSP ResponderID class: [%d]", rawID.Class)
+	}
+	switch rawID.Tag {
+	case ocspResponderIDByName:
+		return bytes.Equal(rawID.Bytes, cert.RawSubject), nil
+	case ocspResponderIDByKey:
+		var keyHash []byte
+		if _, err := asn1.Unmarshal(rawID.Bytes, &keyHash); err != nil {
+			return false, fmt.Errorf("failed to decode OCSP ResponderID byKey: [%w]", err)
+		}
+		_, certKeyHash, err := ocspIssuerDigests(oidDigestSHA1, cert)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(keyHash, certKeyHash), nil
+	}
+	return false, fmt.Errorf("invalid OCSP ResponderID tag: [%d]", rawID.Tag)
+}
+
+// ocspResponderAuthorization проверяет полномочия OCSP сервера с сертификатом responder на выдачу
+// статуса сертификата cc. Хеши издателя сертификата cc вычислены алгоритмом digestOID.
+//
+// Сертификат OCSP сервера считается сертификатом издателя, если его хеши имени и ключа совпадают
+// с хешами издателя cc. Иначе он должен содержать назначение id-kp-OCSPSigning, действовать на момент
+// checkTime и быть выпущен издателем cc: если сертификат издателя известен, то проверяется подпись, иначе
+// строится цепочка до доверенных сертификатов trust (промежуточные сертификаты берутся из intermediates),
+// в которой сертификат издателя OCSP сервера должен иметь хеши имени и ключа издателя cc. Без сертификата
+// издателя и доверенных сертификатов делегированный OCSP сервер не может быть авторизован.
+//
+// Возвращает способ авторизации: ocspResponderCA или ocspResponderDelegated.
+func ocspResponderAuthorization(responder *x509.Certificate, cc *ocspCertConfig, digestOID asn1.ObjectIdentifier, intermediates, trust []*x509.Certificate, checkTime time.Time) (string, error) {
+	nameDigest, keyDigest, err := ocspIssuerDigests(digestOID, responder)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Equal(nameDigest, cc.NameDigestValue) && bytes.Equal(keyDigest, cc.KeyDigestValue) {
+		return ocspResponderCA, nil
+	}
+
+	if !slices.Contains(responder.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+		return "", errors.New("responder certificate is neither issuer nor has id-kp-OCSPSigning extended key usage")
+	}
+	if checkTime.Before(responder.NotBefore) || checkTime.After(responder.NotAfter) {
+		return "", fmt.Errorf("delegated responder certificate is not valid at [%s]: [%s] - [%s]", checkTime.UTC().Format(time.RFC3339),
+			responder.NotBefore.UTC().Format(time.RFC3339), responder.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if cc.IssuerCertificate != nil {
+		if err := verifyIssuedBy(responder, cc.IssuerCertificate); err != nil {
+			return "", fmt.Errorf("delegated responder certificate is not issued by certificate issuer: [%w]", err)
+		}
+		return ocspResponderDelegated, nil
+	}
+	if len(trust) == 0 {
+		return "", errors.New("delegated responder certificate cannot be checked without issuer certificate or trusted certificates")
+	}
+
+	// издатель сертификата OCSP сервера в цепочке до доверенного сертификата (подпись проверена
+	// certChainBuild) должен быть издателем cc
+	chain, err := certChainBuild(responder, intermediates, trust, checkTime)
+	if err != nil {
+		return "", fmt.Errorf("delegated responder certificate chain: [%w]", err)
+	}
+	if len(chain) < 2 {
+		return "", errors.New("delegated responder certificate is trusted itself, but is not issued by certificate issuer")
+	}
+	issuerNameDigest, issuerKeyDigest, err := ocspIssuerDigests(digestOID, chain[1])
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(issuerNameDigest, cc.NameDigestValue) || !bytes.Equal(issuerKeyDigest, cc.KeyDigestValue) {
+		return "", fmt.Errorf("delegated responder certificate is not issued by certificate issuer: [%s]", chain[1].Subject.String())
+	}
+	return ocspResponderDelegated, nil
+}
+
+// ocspResponderNoCheck проверяет наличие в сертификате OCSP сервера расширения id-pkix-ocsp-nocheck
+// (RFC6960 4.2.2.2.1) - статус такого сертификата клиентам проверять не требуется.
+func ocspResponderNoCheck(responder *x509.Certificate) bool {
+	for i := range responder.Extensions {
+		if responder.Extensions[i].Id.Equal(oidOCSPNoCheckExtension) {
+			return true
+		}
+	}
+	return false
+}
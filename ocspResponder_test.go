@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testIssueCert выпускает сертификат template с новым ключом ECDSA P-256, подписанный ключом parentKey
+// от имени parent.
+func testIssueCert(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// testResponderTemplate возвращает шаблон сертификата делегированного OCSP сервера.
+func testResponderTemplate() *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(100),
+		Subject:      pkix.Name{CommonName: "test OCSP responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+}
+
+func TestOCSPResponderAuthorization(t *testing.T) {
+	issuer, issuerKey := testCA(t, "test CA")
+	responder, _ := testIssueCert(t, testResponderTemplate(), issuer, issuerKey)
+
+	// поддельный CA с тем же именем и идентификатором ключа, что и у издателя: выпущенный им сертификат
+	// OCSP сервера имеет те же имя издателя и authorityKeyIdentifier, что и настоящий
+	forgerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               issuer.Subject,
+		SubjectKeyId:          issuer.SubjectKeyId,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	forgerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgerDER, err := x509.CreateCertificate(rand.Reader, forgerTemplate, forgerTemplate, &forgerKey.PublicKey, forgerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger, err := x509.ParseCertificate(forgerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _ := testIssueCert(t, testResponderTemplate(), forger, forgerKey)
+	if !bytes.Equal(forged.AuthorityKeyId, responder.AuthorityKeyId) || !bytes.Equal(forged.RawIssuer, responder.RawIssuer) {
+		t.Fatal("forged responder certificate issuer name or authority key identifier differs")
+	}
+
+	nameDigest, keyDigest, err := ocspIssuerDigests(oidDigestSHA1, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCertConfig := func(issuerCert *x509.Certificate) *ocspCertConfig {
+		return &ocspCertConfig{CertName: "test", NameDigestValue: nameDigest, KeyDigestValue: keyDigest, IssuerCertificate: issuerCert}
+	}
+
+	tests := []struct {
+		name          string
+		responder     *x509.Certificate
+		issuer        *x509.Certificate
+		intermediates []*x509.Certificate
+		trust         []*x509.Certificate
+		want          string // пустая строка - ожидается ошибка
+	}{
+		{name: "issuer", responder: issuer, want: ocspResponderCA},
+		{name: "delegated with issuer", responder: responder, issuer: issuer, want: ocspResponderDelegated},
+		{name: "delegated with trust", responder: responder, trust: []*x509.Certificate{issuer}, want: ocspResponderDelegated},
+		{name: "delegated without issuer and trust", responder: responder},
+		{name: "forged with issuer", responder: forged, issuer: issuer},
+		{name: "forged without issuer and trust", responder: forged},
+		{name: "forged with trust", responder: forged, intermediates: []*x509.Certificate{forger}, trust: []*x509.Certificate{issuer}},
+		{name: "forged with forger trusted", responder: forged, trust: []*x509.Certificate{forger}},
+		{name: "CA without OCSPSigning", responder: forger, trust: []*x509.Certificate{forger}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ocspResponderAuthorization(tt.responder, newCertConfig(tt.issuer), oidDigestSHA1, tt.intermediates, tt.trust, time.Now())
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("authorization = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authorization error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
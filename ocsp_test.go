@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testOCSPCert создает описание сертификата с серийным номером serial, хешами издателя nameDigest/keyDigest
+// и ожидаемым статусом expected.
+func testOCSPCert(name string, serial int64, nameDigest, keyDigest []byte, expected ocspCertStatus) *ocspCertConfig {
+	cc := &ocspCertConfig{
+		CertName:            name,
+		NameDigestValue:     nameDigest,
+		KeyDigestValue:      keyDigest,
+		ExpectedStatusValue: expected,
+	}
+	cc.Certificate = &x509.Certificate{SerialNumber: big.NewInt(serial)}
+	return cc
+}
+
+// testOCSPSingleResponse создает статус сертификата с CertID certID: good, если revocationTime нулевое, иначе revoked.
+func testOCSPSingleResponse(t *testing.T, certID *ocspCertID, thisUpdate, revocationTime time.Time) ocspSingleResponse {
+	t.Helper()
+	status := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: int(ocspCertStatusGood)}
+	if !revocationTime.IsZero() {
+		der, err := asn1.MarshalWithParams(ocspRevokedInfo{RevocationTime: revocationTime, RevocationReason: 1}, "tag:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = asn1.Unmarshal(der, &status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ocspSingleResponse{CertID: *certID, CertStatusRaw: status, ThisUpdate: thisUpdate}
+}
+
+// TestOCSPCertResponseValidate проверяет, что статус каждого сертификата берется из SingleResponse с его CertID
+// (независимо от порядка ответов и совпадения серийных номеров у сертификатов разных издателей).
+func TestOCSPCertResponseValidate(t *testing.T) {
+	nameDigest := sha1.Sum([]byte("issuer name"))
+	keyDigest := sha1.Sum([]byte("issuer key"))
+	otherNameDigest := sha1.Sum([]byte("other issuer name"))
+	otherKeyDigest := sha1.Sum([]byte("other issuer key"))
+
+	certs := []*ocspCertConfig{
+		testOCSPCert("good", 1, nameDigest[:], keyDigest[:], ocspCertStatusGood),
+		testOCSPCert("revoked", 2, nameDigest[:], keyDigest[:], ocspCertStatusRevoked),
+		testOCSPCert("missing", 3, nameDigest[:], keyDigest[:], ocspCertStatusGood),
+		// тот же серийный номер, что и у good, но другой издатель
+		testOCSPCert("other issuer", 1, otherNameDigest[:], otherKeyDigest[:], ocspCertStatusRevoked),
+		testOCSPCert("mismatch", 4, nameDigest[:], keyDigest[:], ocspCertStatusRevoked),
+	}
+	req := ocspNewRequest(oidDigestSHA1, certs)
+	if _, _, err := ocspEncodeRequest(req, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	certID := func(i int) *ocspCertID { return &req.TBSRequest.RequestList[i].ReqCert }
+
+	now := time.Now()
+	thisUpdate := now.Add(-time.Minute)
+	revocationTime := now.Add(-time.Hour)
+	responseData := &ocspResponseData{
+		// порядок ответов отличается от порядка запроса, статуса сертификата missing нет
+		Responses: []ocspSingleResponse{
+			testOCSPSingleResponse(t, certID(4), thisUpdate, time.Time{}),
+			testOCSPSingleResponse(t, certID(3), thisUpdate, revocationTime),
+			testOCSPSingleResponse(t, certID(1), thisUpdate, revocationTime),
+			testOCSPSingleResponse(t, certID(0), thisUpdate, time.Time{}),
+		},
+	}
+
+	tests := []struct {
+		found   bool
+		status  ocspCertStatus
+		wantErr bool
+	}{
+		{found: true, status: ocspCertStatusGood},
+		{found: true, status: ocspCertStatusRevoked},
+		{found: false, wantErr: true},
+		{found: true, status: ocspCertStatusRevoked},
+		{found: true, status: ocspCertStatusGood, wantErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(certs[i].CertName, func(t *testing.T) {
+			info := ocspCertResponseValidate(responseData, certID(i), certs[i], now, &ocspConfig{})
+			if info.Name != certs[i].CertName {
+				t.Errorf("Name = %q, want %q", info.Name, certs[i].CertName)
+			}
+			if info.Found != tt.found {
+				t.Fatalf("Found = %t, want %t (error: %v)", info.Found, tt.found, info.Err)
+			}
+			if (info.Err != nil) != tt.wantErr {
+				t.Errorf("Err = %v, want error %t", info.Err, tt.wantErr)
+			}
+			if !tt.found {
+				return
+			}
+			if info.Status != tt.status {
+				t.Errorf("Status = %s, want %s", info.Status, tt.status)
+			}
+			if tt.status == ocspCertStatusRevoked && (info.RevokedInfo == nil || !info.RevokedInfo.RevocationTime.Equal(revocationTime.Truncate(time.Second))) {
+				t.Errorf("RevokedInfo = %+v, want revocation time %s", info.RevokedInfo, revocationTime)
+			}
+		})
+	}
+}
+
+// TestOCSPNewRequest проверяет, что запрос содержит по одному CertID на сертификат в порядке certs.
+func TestOCSPNewRequest(t *testing.T) {
+	nameDigest := sha1.Sum([]byte("issuer name"))
+	keyDigest := sha1.Sum([]byte("issuer key"))
+	certs := []*ocspCertConfig{
+		testOCSPCert("a", 10, nameDigest[:], keyDigest[:], ocspCertStatusGood),
+		testOCSPCert("b", 11, nameDigest[:], keyDigest[:], ocspCertStatusGood),
+		testOCSPCert("c", 12, nameDigest[:], keyDigest[:], ocspCertStatusGood),
+	}
+
+	req := ocspNewRequest(oidDigestSHA1, certs)
+	encoded, _, err := ocspEncodeRequest(req, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ocspRequest
+	if _, err = asn1.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.TBSRequest.RequestList) != len(certs) {
+		t.Fatalf("RequestList length = %d, want %d", len(decoded.TBSRequest.RequestList), len(certs))
+	}
+	for i, cc := range certs {
+		reqCert := &decoded.TBSRequest.RequestList[i].ReqCert
+		if reqCert.SerialNumber.Cmp(cc.Certificate.SerialNumber) != 0 {
+			t.Errorf("CertID %d serial = %s, want %s", i, reqCert.SerialNumber, cc.Certificate.SerialNumber)
+		}
+		if !bytes.Equal(reqCert.NameHash, nameDigest[:]) || !bytes.Equal(reqCert.IssuerKeyHash, keyDigest[:]) {
+			t.Errorf("CertID %d issuer hashes mismatch", i)
+		}
+		if !reqCert.HashAlgorithm.Algorithm.Equal(oidDigestSHA1) {
+			t.Errorf("CertID %d hash algorithm = %s, want %s", i, reqCert.HashAlgorithm.Algorithm, oidDigestSHA1)
+		}
+	}
+}
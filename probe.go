@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+/*
+  Общая реализация проверок (целей мониторинга) и их периодического выполнения.
+
+  Каждый тип проверки (OCSP, TSP, HTTP) реализует интерфейс Probe - формирование запроса
+  и проверку ответа. Отправка запроса, повторы, общие метрики и протоколирование
+  выполняются функциями runProbe и probeMonitorStart одинаково для всех типов проверок.
+*/
+
+// Probe определяет проверку одной цели мониторинга.
+type Probe interface {
+	// Protocol возвращает тип проверки.
+	Protocol() protocolType
+
+	// Settings возвращает общие настройки проверки.
+	Settings() probeSettings
+
+	// NewRequest формирует очередной запрос к серверу. Доп. сведения о запросе могут быть записаны в le.
+	// Загрузки, необходимые для формирования запроса, прерываются при отмене ctx.
+	// Ошибка формирования запроса считается фатальной (мониторинг цели завершается).
+	NewRequest(ctx context.Context, verbose bool, le *zerolog.Event) (*probeRequest, error)
+}
+
+// probeMetricsInitializer может быть реализован проверкой, использующей специфичные для нее метрики,
+// для задания их нулевых значений при запуске проверки (см. probeInitMetrics).
+type probeMetricsInitializer interface {
+	InitMetrics(mt *metrics)
+}
+
+// probeSettings содержит общие для всех типов проверок настройки.
+type probeSettings struct {
+	// Имя цели мониторинга
+	Name string
+	// URL сервера
+	URL string
+	// HTTP метод запросов проверки
+	Method string
+	// Таймаут сетевого взаимодействия (0 - без таймаута)
+	Timeout time.Duration
+	// Максимально допустимый размер ответа (0 - без ограничения)
+	MaxResponseSize int64
+	// Количество повторов проверки (0 - бесконечно)
+	RetryCount int
+	// Интервал между двумя проверками
+	RetryInterval time.Duration
+}
+
+// probeRequest определяет HTTP запрос проверки и проверку ответа на него.
+type probeRequest struct {
+	// URL запроса (пустая строка - используется URL из настроек проверки)
+	URL string
+	// Тип содержимого запроса (пустая строка - заголовок не устанавливается)
+	ContentType string
+	// Тело запроса
+	Body []byte
+
+	// Validate декодирует и проверяет ответ сервера на данный запрос (HTTP статус код ответа уже проверен).
+	// Тип ошибки определяется validationErrorType (ошибки декодирования должны иметь тип responseErrorAsn).
+	// Специфичные для проверки метрики обновляются в mt. Если nil, то ответ дополнительно не проверяется.
+	Validate func(nr *networkResult, mt *metrics, verbose bool, le *zerolog.Event) error
+}
+
+// probeResult содержит результат одной проверки.
+type probeResult struct {
+	// Canceled устанавливается, если проверка прервана отменой контекста (результат не учитывается в метриках).
+	Canceled bool
+
+	// ErrorType тип ошибки проверки. Пустая строка - проверка успешна.
+	ErrorType responseErrorType
+
+	// Err ошибка проверки
+	Err error
+
+	// ProcessingTime время обработки запроса
+	ProcessingTime time.Duration
+}
+
+// runProbe выполняет одну проверку: формирует запрос, отправляет его серверу, проверяет ответ.
+// Результат проверки учитывается в метриках mt и записывается в событие протокола le (событие
+// отправляется, если проверка не прервана отменой ctx).
+//
+// Возвращает ошибку только если не удалось сформировать запрос - в этом случае результат
+// проверки не учитывается.
+func runProbe(ctx context.Context, p Probe, mc *http.Client, mt *metrics, verbose bool, le *zerolog.Event) (probeResult, error) {
+	var result probeResult
+	proto := p.Protocol()
+	protoName := strings.ToUpper(string(proto))
+	settings := p.Settings()
+
+	// формируем запрос
+	req, err := p.NewRequest(ctx, verbose, le)
+	var discoveryError *aiaDiscoveryError
+	if errors.As(err, &discoveryError) {
+		if ctx.Err() != nil {
+			// отменен основной контекст - результат не учитываем
+			result.Canceled = true
+			return result, nil
+		}
+		// сертификат издателя не загружен по AIA - считаем сетевой ошибкой, загрузка повторится
+		// при следующей проверке
+		result.ErrorType = responseErrorNet
+		result.Err = err
+		netClass := networkErrorClass(discoveryError.err)
+		mt.NetworkError(proto, settings.Name, settings.Method, netClass)
+		mt.ResponseError(proto, settings.Name, settings.Method, result.ErrorType)
+		le.Str("netError", netClass).Str("errorType", string(result.ErrorType)).Err(result.Err).Msg("request failed")
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if verbose && len(req.Body) != 0 {
+		le.Str("request", base64.StdEncoding.EncodeToString(req.Body))
+	}
+
+	// отправляем запрос на сервер
+	reqURL := req.URL
+	if reqURL == "" {
+		reqURL = settings.URL
+	}
+	nr, err := sendRequest(ctx, mc, settings.Method, reqURL, req.ContentType, settings.MaxResponseSize, req.Body)
+	if nr.StatusCode == 0 && nr.SendReceiveTime == 0 {
+		// произошла ошибка при формировании запроса
+		return result, fmt.Errorf("failed to create %s HTTP request: [%w]", protoName, err)
+	}
+	result.ProcessingTime = nr.SendReceiveTime
+
+	// обновляем статистику времени обработки запроса и его этапов
+	mt.RequestProcessingTimeObserve(proto, settings.Name, settings.Method, nr.SendReceiveTime)
+	mt.RequestPhasesObserve(proto, settings.Name, settings.Method, &nr.Phases)
+
+	// выведем тело ответа и время обработки запроса в протокол (даже при ошибке)
+	if verbose {
+		le.Str("response", base64.StdEncoding.EncodeToString(nr.Body)).
+			Dur("processingTime", nr.SendReceiveTime).
+			Dict("phases", zerolog.Dict().
+				Dur("dns", nr.Phases.DNS).Dur("connect", nr.Phases.Connect).Dur("tls", nr.Phases.TLSHandshake).
+				Dur("firstByte", nr.Phases.FirstByte).Dur("bodyRead", nr.Phases.BodyRead))
+	}
+
+	switch {
+	case err != nil:
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			// отменен основной контекст - результат не учитываем
+			result.Canceled = true
+			return result, nil
+		}
+		result.ErrorType = responseErrorNet
+		result.Err = fmt.Errorf("receive %s response: [%w]", protoName, err)
+
+		// уточняем класс сетевой ошибки
+		netClass := networkErrorClass(err)
+		mt.NetworkError(proto, settings.Name, settings.Method, netClass)
+		le.Str("netError", netClass)
+
+	case nr.StatusCode < http.StatusOK || nr.StatusCode >= http.StatusMultipleChoices:
+		// успешные коды в диапазоне (200,300)
+		result.ErrorType = responseErrorHTTP
+		result.Err = fmt.Errorf("receive %s response: invalid HTTP status code: [%d]: [%s]", protoName, nr.StatusCode, http.StatusText(nr.StatusCode))
+
+	default:
+		// пишем доп. данные об ответе
+		if verbose {
+			le.Int("statusCode", nr.StatusCode).Str("contentType", nr.ContentType)
+		}
+
+		// декодируем и проверяем содержимое ответа
+		if req.Validate != nil {
+			if validateError := req.Validate(&nr, mt, verbose, le); validateError != nil {
+				result.ErrorType = validationErrorType(validateError)
+				result.Err = validateError
+
+				// уточняем причину ошибки проверки
+				if reason := validationErrorReason(validateError); reason != "" {
+					mt.ResponseErrorReason(proto, settings.Name, settings.Method, result.ErrorType, reason)
+					le.Str("errorReason", reason)
+				}
+			}
+		}
+	}
+
+	// обновляем статистику и протоколируем результат
+	if result.Err != nil {
+		mt.ResponseError(proto, settings.Name, settings.Method, result.ErrorType)
+		le.Str("errorType", string(result.ErrorType)).Err(result.Err).Msg("request failed")
+	} else {
+		mt.ProbeSuccess(proto, settings.Name, settings.Method)
+		le.Msg("request succeed")
+	}
+	return result, nil
+}
+
+// probeInitMetrics задает нулевые значения общих метрик проверки p и, если проверка реализует
+// probeMetricsInitializer, специфичных для нее метрик.
+func probeInitMetrics(p Probe, mt *metrics) {
+	settings := p.Settings()
+	mt.InitTarget(p.Protocol(), settings.Name, settings.Method)
+	if mi, ok := p.(probeMetricsInitializer); ok {
+		mi.InitMetrics(mt)
+	}
+}
+
+// probeMonitorStart запускает goroutine-у мониторинга цели p: проверки выполняются
+// с интервалом и количеством повторов из настроек проверки.
+//
+// ctx - контекст выхода. При отмене данного контекста все запущенные goroutine-ы должны завершить работу.
+// Возвращает канал, который будет закрыт при завершении работы goroutine-ы мониторинга. Единственная
+// ошибка, передаваемая через канал перед закрытием - ошибка формирования запроса (при генерации nonce, например).
+func probeMonitorStart(ctx context.Context, p Probe) <-chan error {
+	resultChannel := make(chan error, 1)
+	settings := p.Settings()
+
+	// создаем логгер монитора
+	ml := getAppContext().Logger.With().
+		Str("module", "monitor").Str("protocol", string(p.Protocol())).
+		Str("target", settings.Name).Str("url", settings.URL).Str("method", settings.Method).Logger()
+
+	// создаем клиента для работы с HTTP с поддержкой сетевого таймута
+	mc := &http.Client{
+		Transport: &http.Transport{},
+		Timeout:   settings.Timeout,
+	}
+
+	// объект метрик
+	mt := getAppContext().Metrics
+	probeInitMetrics(p, mt)
+
+	// флаг вывода расширенного лога
+	verbose := getAppContext().Config.Log.Verbose
+
+	// запускаем goroutine-у монитора
+	sch := make(chan struct{})
+	go func() {
+		// горутина инициализирована - закрываем канал запуска
+		close(sch)
+
+		var lastError error
+
+		// при выходе пишем ошибку и закрываем канал
+		defer func() {
+			// выводим ошибку в канал и в протокол
+			le := ml.Log()
+			if lastError != nil {
+				select {
+				case resultChannel <- lastError:
+				default:
+				}
+				le.Err(lastError)
+			}
+			le.Msg("stop")
+			// всегда закрываем канал
+			close(resultChannel)
+		}()
+
+		// основной цикл обработки
+		for i := 0; settings.RetryCount == 0 || i < settings.RetryCount; i++ {
+			// выходим из goroutine-ы при отмене контекста
+			if ctx.Err() != nil {
+				break
+			}
+
+			// выполняем проверку. При ошибках формирования запроса - завершаем goroutine-у
+			if _, lastError = runProbe(ctx, p, mc, mt, verbose, ml.Log().Int("num", i+1)); lastError != nil {
+				break
+			}
+
+			// ждем указанный таймаут
+			if settings.RetryCount == 0 || i != settings.RetryCount-1 {
+				waitForTimeout(ctx, settings.RetryInterval)
+			}
+		}
+	}()
+	<-sch
+
+	ml.Log().
+		Int("retryCount", settings.RetryCount).Dur("retryInterval", settings.RetryInterval).
+		Msg("start")
+	return resultChannel
+}
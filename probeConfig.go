@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// probeModuleConfig определяет настройки модуля проверки, выполняемой по запросу к /probe
+// сервера метрик (аналогично модулям blackbox_exporter).
+//
+// Модуль содержит настройки одной цели мониторинга (секция, соответствующая Prober).
+// Поля retrycount и retryinterval в модуле не используются - расписанием проверок
+// управляет Prometheus.
+type probeModuleConfig struct {
+	// Prober определяет тип проверки: ocsp, tsp, http или crl.
+	Prober protocolType `json:"prober" yaml:"prober"`
+
+	// Настройки проверки OCSP сервера (только для Prober = ocsp)
+	OCSP *ocspConfig `json:"ocsp,omitempty" yaml:"ocsp,omitempty"`
+
+	// Настройки проверки TSP сервера (только для Prober = tsp)
+	TSP *tspConfig `json:"tsp,omitempty" yaml:"tsp,omitempty"`
+
+	// Настройки проверки HTTP сервера (только для Prober = http)
+	HTTP *httpConfig `json:"http,omitempty" yaml:"http,omitempty"`
+
+	// Настройки проверки CRL (только для Prober = crl)
+	CRL *crlConfig `json:"crl,omitempty" yaml:"crl,omitempty"`
+}
+
+// probeModules определяет набор модулей проверки по имени модуля.
+type probeModules map[string]*probeModuleConfig
+
+// target возвращает настройки цели мониторинга модуля в соответствии с Prober
+// (nil, если соответствующая секция не указана).
+func (cfg *probeModuleConfig) target() targetConfig {
+	switch cfg.Prober {
+	case protoOCSP:
+		if cfg.OCSP != nil {
+			return cfg.OCSP
+		}
+	case protoTSP:
+		if cfg.TSP != nil {
+			return cfg.TSP
+		}
+	case protoHTTP:
+		if cfg.HTTP != nil {
+			return cfg.HTTP
+		}
+	case protoCRL:
+		if cfg.CRL != nil {
+			return cfg.CRL
+		}
+	}
+	return nil
+}
+
+// url возвращает URL сервера из настроек модуля.
+func (cfg *probeModuleConfig) url() string {
+	switch cfg.Prober {
+	case protoOCSP:
+		return cfg.OCSP.URL
+	case protoTSP:
+		return cfg.TSP.URL
+	case protoHTTP:
+		return cfg.HTTP.URL
+	case protoCRL:
+		return cfg.CRL.URL
+	}
+	return ""
+}
+
+// Validate устанавливает значения по умолчанию и проверяет настройки каждого модуля.
+// Параметры командной строки к модулям не применяются. Имя модуля используется как имя цели мониторинга.
+func (m probeModules) Validate() error {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := m[name]
+		if name == "" {
+			return errors.New("invalid modules config: empty module name")
+		}
+		if cfg == nil {
+			return fmt.Errorf("invalid modules config: module [%s]: empty module", name)
+		}
+
+		// должна быть указана ровно одна секция, соответствующая типу проверки
+		sections := 0
+		for _, present := range []bool{cfg.OCSP != nil, cfg.TSP != nil, cfg.HTTP != nil, cfg.CRL != nil} {
+			if present {
+				sections++
+			}
+		}
+		target := cfg.target()
+		if target == nil || sections != 1 {
+			return fmt.Errorf("invalid modules config: module [%s]: single section matching prober [%s] expected", name, cfg.Prober)
+		}
+
+		if (cfg.OCSP != nil && cfg.OCSP.Disabled) || (cfg.TSP != nil && cfg.TSP.Disabled) || (cfg.HTTP != nil && cfg.HTTP.Disabled) || (cfg.CRL != nil && cfg.CRL.Disabled) {
+			return fmt.Errorf("invalid modules config: module [%s]: module can not be disabled", name)
+		}
+
+		target.SetDefaults()
+		target.SetTargetName(name)
+		if validateError := target.Validate(); validateError != nil {
+			return fmt.Errorf("module [%s]: [%w]", name, validateError)
+		}
+	}
+	return nil
+}
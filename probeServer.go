@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
+)
+
+/*
+  Выполнение проверок по запросу (в стиле blackbox_exporter):
+
+    GET /probe?module=<имя модуля>&target=<URL сервера>
+
+  Проверка выполняется синхронно с использованием настроек модуля из секции modules
+  конфигурации. Результат возвращается в виде отдельного набора метрик (в отдельном реестре),
+  при этом метка target метрик содержит имя модуля.
+*/
+
+// probeHandler обрабатывает запросы на выполнение проверки по модулю.
+func probeHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	// ищем модуль
+	moduleName := params.Get("module")
+	module, found := getAppContext().Config.Modules[moduleName]
+	if !found {
+		http.Error(w, fmt.Sprintf("unknown module: [%s]", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	// URL сервера из запроса имеет приоритет над URL из модуля
+	target := params.Get("target")
+	probeURL := module.url()
+	if target != "" {
+		targetURL, parseError := url.Parse(target)
+		if parseError != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+			http.Error(w, fmt.Sprintf("invalid target: [%s]", target), http.StatusBadRequest)
+			return
+		}
+		probeURL = target
+
+		// URL delta CRL из target не выводится - проверка delta CRL модуля относилась бы к другому CRL
+		if module.Prober == protoCRL && module.CRL.Delta {
+			http.Error(w, fmt.Sprintf("target is not supported for CRL module with delta: [%s]", moduleName), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// создаем логгер проверки
+	pl := getAppContext().Logger.With().
+		Str("module", "probe").Str("protocol", string(module.Prober)).
+		Str("target", moduleName).Str("url", probeURL).Logger()
+
+	// метрики проверки собираем в отдельный реестр
+	registry := prometheus.NewRegistry()
+	mt := newProbeMetrics(registry)
+
+	// ошибка выполнения проверки не является ошибкой запроса: она отражается в probe_success
+	success, probeError := module.probe(r.Context(), target, mt, getAppContext().Config.Log.Verbose, &pl)
+	if probeError != nil {
+		pl.Log().Err(probeError).Msg("probe failed")
+	}
+	mt.ProbeResult(success)
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// probe выполняет проверку по настройкам модуля. Если указан target, то он используется
+// вместо URL из настроек модуля. Если модуль определяет несколько проверок (например, OCSP
+// с методом both), то они выполняются последовательно.
+//
+// Результат каждой проверки учитывается в метриках mt и записывается в протокол pl.
+// Возвращает true, если все проверки выполнены успешно, и ошибку, если проверку не удалось
+// выполнить (не удалось загрузить сертификат издателя или сформировать запрос).
+func (cfg *probeModuleConfig) probe(ctx context.Context, target string, mt *metrics, verbose bool, pl *zerolog.Logger) (bool, error) {
+	if err := cfg.resolveIssuers(ctx); err != nil {
+		return false, err
+	}
+	probes, err := cfg.newProbes(target)
+	if err != nil {
+		return false, err
+	}
+
+	success := true
+	for _, p := range probes {
+		// клиента создаем на одну проверку
+		mc := &http.Client{
+			Transport: &http.Transport{},
+			Timeout:   p.Settings().Timeout,
+		}
+
+		probeInitMetrics(p, mt)
+		result, err := runProbe(ctx, p, mc, mt, verbose, pl.Log().Str("method", p.Settings().Method))
+		mc.CloseIdleConnections()
+		if err != nil {
+			return false, err
+		}
+		if result.ErrorType != "" || result.Canceled {
+			success = false
+		}
+	}
+	return success, nil
+}
+
+// resolveIssuers загружает по AIA сертификаты издателей, загружаемые при проверках, в настройках модуля
+// (а не в их копиях, создаваемых newProbes): сертификаты загружаются и устанавливаются один раз для всех
+// запросов, копии получают уже установленные сертификаты. Загрузка прерывается при отмене ctx.
+func (cfg *probeModuleConfig) resolveIssuers(ctx context.Context) error {
+	switch cfg.Prober {
+	case protoOCSP:
+		for _, cc := range cfg.OCSP.certConfigs() {
+			if err := cc.resolveIssuer(ctx, cfg.OCSP.DigestOIDValue); err != nil {
+				return err
+			}
+		}
+	case protoCRL:
+		return cfg.CRL.resolveIssuer(ctx)
+	}
+	return nil
+}
+
+// newProbes создает проверки по копии настроек модуля. Если указан target, то он используется
+// вместо URL из настроек модуля.
+func (cfg *probeModuleConfig) newProbes(target string) ([]Probe, error) {
+	switch cfg.Prober {
+	case protoOCSP:
+		probeCfg := *cfg.OCSP
+		if target != "" {
+			probeCfg.URL = target
+		}
+		probes := make([]Probe, 0, len(probeCfg.MethodValues))
+		for _, method := range probeCfg.MethodValues {
+			probes = append(probes, &ocspProber{&probeCfg, method})
+		}
+		return probes, nil
+
+	case protoTSP:
+		probeCfg := *cfg.TSP
+		if target != "" {
+			probeCfg.URL = target
+		}
+		return []Probe{&tspProber{&probeCfg}}, nil
+
+	case protoHTTP:
+		probeCfg := *cfg.HTTP
+		if target != "" {
+			probeCfg.URL = target
+		}
+		return []Probe{&httpProber{&probeCfg}}, nil
+
+	case protoCRL:
+		probeCfg := *cfg.CRL
+		if target != "" {
+			probeCfg.URL = target
+		}
+		// сведения о номерах CRL создаются на каждый запрос: монотонность номеров между запросами
+		// не контролируется, delta CRL сверяется с полным CRL этого же запроса
+		state := &crlState{}
+		probes := []Probe{&crlProber{&probeCfg, false, state}}
+		if probeCfg.Delta {
+			probes = append(probes, &crlProber{&probeCfg, true, state})
+		}
+		return probes, nil
+	}
+	return nil, fmt.Errorf("unsupported prober: [%s]", cfg.Prober)
+}
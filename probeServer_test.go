@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProbeHandler проверяет, что результат проверки по запросу к /probe (в том числе невозможность
+// сформировать запрос) возвращается метрикой probe_success, а метрики приложения не возвращаются.
+func TestProbeHandler(t *testing.T) {
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer okServer.Close()
+	failServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failServer.Close()
+
+	maxSize := int64(1024)
+	// сертификат издателя CRL загружается по недоступному URL: запрос не формируется
+	crlCfg := &crlConfig{Name: "crl", URL: "http://127.0.0.1:1/test.crl", MaxResponseSize: &maxSize}
+	crlCfg.issuerDiscovery = newAIAIssuerDiscovery(&x509.Certificate{IssuingCertificateURL: []string{"http://127.0.0.1:1/ca.der"}}, time.Second)
+
+	ctx := getAppContext()
+	ctx.Config = &appConfig{Modules: probeModules{
+		"web": {Prober: protoHTTP, HTTP: &httpConfig{Name: "web", URL: okServer.URL, TimeoutValue: 5 * time.Second, MaxResponseSize: &maxSize}},
+		"crl": {Prober: protoCRL, CRL: crlCfg},
+	}}
+	defer func() { ctx.Config = nil }()
+
+	tests := []struct {
+		name    string
+		module  string
+		target  string
+		success string
+	}{
+		{name: "success", module: "web", success: "1"},
+		{name: "HTTP status", module: "web", target: failServer.URL, success: "0"},
+		{name: "issuer discovery failed", module: "crl", success: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"module": {tt.module}}
+			if tt.target != "" {
+				query.Set("target", tt.target)
+			}
+			rec := httptest.NewRecorder()
+			probeHandler(rec, httptest.NewRequest(http.MethodGet, "/probe?"+query.Encode(), nil))
+
+			body, _ := io.ReadAll(rec.Body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, body)
+			}
+			if want := "ncatos_probe_success " + tt.success + "\n"; !strings.Contains(string(body), want) {
+				t.Errorf("metrics do not contain %q:\n%s", want, body)
+			}
+			for _, name := range []string{"ncatos_build_info", "ncatos_config_info"} {
+				if strings.Contains(string(body), name) {
+					t.Errorf("metrics contain %s", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// testCA создает самоподписанный сертификат CA с ключом ECDSA P-256, допускающим подпись CRL.
+func testCA(t *testing.T, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// testCRL создает CRL с номером number, выпущенный в thisUpdate и подписанный ключом key от имени issuer.
+func testCRL(t *testing.T, issuer *x509.Certificate, key *ecdsa.PrivateKey, number int64, thisUpdate, nextUpdate time.Time) []byte {
+	t.Helper()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: thisUpdate,
+		NextUpdate: nextUpdate,
+	}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// testRunProbe выполняет проверку p и сравнивает тип ошибки результата с wantType (пустая строка - проверка
+// успешна) и, если указана, причину ошибки с wantReason.
+func testRunProbe(t *testing.T, p Probe, mt *metrics, wantType responseErrorType, wantReason string) {
+	t.Helper()
+	logger := zerolog.Nop()
+	result, err := runProbe(context.Background(), p, &http.Client{Timeout: 5 * time.Second}, mt, false, logger.Log())
+	if err != nil {
+		t.Fatalf("runProbe: %v", err)
+	}
+	if result.Canceled {
+		t.Fatal("result canceled")
+	}
+	if result.ErrorType != wantType {
+		t.Errorf("ErrorType = %q, want %q (error: %v)", result.ErrorType, wantType, result.Err)
+	}
+	if (result.Err == nil) != (wantType == "") {
+		t.Errorf("Err = %v, want error %t", result.Err, wantType != "")
+	}
+	if reason := validationErrorReason(result.Err); wantReason != "" && reason != wantReason {
+		t.Errorf("reason = %q, want %q", reason, wantReason)
+	}
+}
+
+func TestRunProbe(t *testing.T) {
+	issuer, issuerKey := testCA(t, "test CA")
+	// сертификат с тем же именем, но другим ключом - подпись CRL не подтверждается
+	otherIssuer, _ := testCA(t, "test CA")
+
+	now := time.Now()
+	validCRL := testCRL(t, issuer, issuerKey, 1, now.Add(-time.Minute), now.Add(time.Hour))
+	expiredCRL := testCRL(t, issuer, issuerKey, 1, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	// закрытый сервер - сетевая ошибка
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	tests := []struct {
+		name       string
+		status     int
+		body       []byte
+		url        string // URL вместо URL тестового сервера
+		issuer     *x509.Certificate
+		issuerURL  string // URL загрузки сертификата издателя по AIA
+		wantType   responseErrorType
+		wantReason string
+	}{
+		{name: "success", status: http.StatusOK, body: validCRL, issuer: issuer},
+		{name: "net", url: closedURL, issuer: issuer, wantType: responseErrorNet},
+		{name: "http", status: http.StatusNotFound, body: validCRL, issuer: issuer, wantType: responseErrorHTTP},
+		{name: "asn1", status: http.StatusOK, body: []byte("not a CRL"), issuer: issuer, wantType: responseErrorAsn},
+		{name: "contents", status: http.StatusOK, body: expiredCRL, issuer: issuer, wantType: responseErrorContents, wantReason: crlReasonNextUpdate},
+		{name: "signature", status: http.StatusOK, body: validCRL, issuer: otherIssuer, wantType: responseErrorSignature},
+		{name: "issuer discovery", status: http.StatusOK, body: validCRL, issuerURL: closedURL, wantType: responseErrorNet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			u := srv.URL
+			if tt.url != "" {
+				u = tt.url
+			}
+			maxSize := defaultCRLMaxResponseSize
+			cfg := &crlConfig{
+				Name:              "test",
+				URL:               u,
+				IssuerCertificate: tt.issuer,
+				MaxResponseSize:   &maxSize,
+			}
+			if tt.issuerURL != "" {
+				cfg.issuerDiscovery = newAIAIssuerDiscovery(&x509.Certificate{IssuingCertificateURL: []string{tt.issuerURL}}, time.Second)
+			}
+			p := &crlProber{cfg, false, &crlState{}}
+			mt := newMetrics(prometheus.NewRegistry())
+
+			testRunProbe(t, p, mt, tt.wantType, tt.wantReason)
+		})
+	}
+}
+
+// TestRunProbeCanceled проверяет, что проверка, прерванная отменой контекста, не учитывается.
+func TestRunProbeCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	maxSize := defaultCRLMaxResponseSize
+	p := &crlProber{&crlConfig{Name: "test", URL: srv.URL, MaxResponseSize: &maxSize}, false, &crlState{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logger := zerolog.Nop()
+	result, err := runProbe(ctx, p, &http.Client{}, newMetrics(prometheus.NewRegistry()), false, logger.Log())
+	if err != nil {
+		t.Fatalf("runProbe: %v", err)
+	}
+	if !result.Canceled {
+		t.Errorf("Canceled = false, want true (error type %q: %v)", result.ErrorType, result.Err)
+	}
+}
+
+// testOCSPServer создает OCSP сервер, отвечающий на запросы GET и POST статусом good всех запрошенных
+// сертификатов (с nonce запроса). Ответ подписывается ключом key, ResponderID - хеш ключа responder.
+func testOCSPServer(t *testing.T, responder *x509.Certificate, key *ecdsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	_, responderKeyHash, err := ocspIssuerDigests(oidDigestSHA1, responder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderID, err := asn1.Marshal(responderKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqEnc []byte
+		var err error
+		if r.Method == http.MethodGet {
+			reqEnc, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, "/"))
+		} else {
+			reqEnc, err = io.ReadAll(r.Body)
+		}
+		var req ocspRequest
+		if err == nil {
+			_, err = asn1.Unmarshal(reqEnc, &req)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		responseData := ocspResponseData{
+			RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: ocspResponderIDByKey, IsCompound: true, Bytes: responderID},
+			ProducedAt:     now,
+			Extensions:     req.TBSRequest.RequestExtensions,
+		}
+		for i := range req.TBSRequest.RequestList {
+			responseData.Responses = append(responseData.Responses, testOCSPSingleResponse(t, &req.TBSRequest.RequestList[i].ReqCert, now.Add(-time.Minute), time.Time{}))
+		}
+		tbs, err := asn1.Marshal(responseData)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		digest := sha256.Sum256(tbs)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		basicResponse, err := asn1.Marshal(ocspBasicResponse{
+			TBSResponseData:    ocspResponseData{Raw: tbs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256},
+			Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, err := asn1.Marshal(ocspResponse{
+			ResponseStatus: ocspResponseStatusSuccessful,
+			ResponseBytes:  ocspResponseBytes{ResponseType: oidOCSPBasicResponse, Response: basicResponse},
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+}
+
+// TestRunProbeOCSP проверяет результаты проверки OCSP сервера методами GET и POST.
+func TestRunProbeOCSP(t *testing.T) {
+	issuer, issuerKey := testCA(t, "test CA")
+	// ключ, не соответствующий ResponderID - подпись ответа не подтверждается
+	_, otherKey := testCA(t, "test CA")
+
+	template := testResponderTemplate()
+	template.ExtKeyUsage = nil
+	cert, _ := testIssueCert(t, template, issuer, issuerKey)
+	nameDigest, keyDigest, err := ocspIssuerDigests(oidDigestSHA1, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validServer := testOCSPServer(t, issuer, issuerKey)
+	defer validServer.Close()
+	forgedServer := testOCSPServer(t, issuer, otherKey)
+	defer forgedServer.Close()
+	garbageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("not an OCSP response"))
+	}))
+	defer garbageServer.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		expected ocspCertStatus
+		wantType responseErrorType
+	}{
+		{name: "success", url: validServer.URL, expected: ocspCertStatusGood},
+		{name: "contents", url: validServer.URL, expected: ocspCertStatusRevoked, wantType: responseErrorContents},
+		{name: "signature", url: forgedServer.URL, expected: ocspCertStatusGood, wantType: responseErrorSignature},
+		{name: "asn1", url: garbageServer.URL, expected: ocspCertStatusGood, wantType: responseErrorAsn},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			t.Run(tt.name+" "+method, func(t *testing.T) {
+				maxSize := int64(65536)
+				cfg := &ocspConfig{
+					Name:            "test",
+					URL:             tt.url,
+					Kind:            ocspKindStatus,
+					DigestOIDValue:  oidDigestSHA1,
+					NonceSize:       defaultOCSPNonceSize,
+					MaxResponseSize: &maxSize,
+				}
+				cfg.CertName = "test"
+				cfg.Certificate = cert
+				cfg.IssuerCertificate = issuer
+				cfg.NameDigestValue, cfg.KeyDigestValue = nameDigest, keyDigest
+				cfg.ExpectedStatusValue = tt.expected
+
+				testRunProbe(t, &ocspProber{cfg, method}, newMetrics(prometheus.NewRegistry()), tt.wantType, "")
+			})
+		}
+	}
+}
+
+// testTSPServer создает TSP сервер, выдающий метки времени, подписанные ключом key сертификата tsa.
+// Если указан mutate, то он изменяет метку времени перед подписью.
+func testTSPServer(t *testing.T, tsa *x509.Certificate, key *ecdsa.PrivateKey, mutate func(*tspTSTInfo)) *httptest.Server {
+	t.Helper()
+	marshal := func(value any) []byte {
+		der, err := asn1.Marshal(value)
+		if err != nil {
+			t.Error(err)
+		}
+		return der
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqEnc, err := io.ReadAll(r.Body)
+		var req tspRequest
+		if err == nil {
+			_, err = asn1.Unmarshal(reqEnc, &req)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ti := tspTSTInfo{
+			Version:        1,
+			Policy:         req.ReqPolicy,
+			MessageImprint: req.MessageImprint,
+			SerialNumber:   big.NewInt(1),
+			Time:           time.Now().UTC().Truncate(time.Second),
+			Accuracy:       tspAccuracy{Seconds: 1},
+			Nonce:          req.Nonce,
+		}
+		if mutate != nil {
+			mutate(&ti)
+		}
+		content := marshal(ti)
+
+		// подписываемые атрибуты: contentType, messageDigest, signingCertificateV2
+		contentDigest := sha256.Sum256(content)
+		certHash := sha256.Sum256(tsa.Raw)
+		attributes := []cmsAttribute{
+			{Type: oidCmsAttributeContentType, Values: []asn1.RawValue{{FullBytes: marshal(oidTSPTimeStampTokenContent)}}},
+			{Type: oidCmsAttributeMessageDigest, Values: []asn1.RawValue{{FullBytes: marshal(contentDigest[:])}}},
+			{Type: oidCmsAttributeSigningCertificateV2, Values: []asn1.RawValue{{FullBytes: marshal(essSigningCertificateV2{
+				Certs: []essCertIDv2{{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256}, CertHash: certHash[:]}},
+			})}}},
+		}
+		signed, err := asn1.MarshalWithParams(attributes, "set")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		signedDigest := sha256.Sum256(signed)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, signedDigest[:])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		// в SignerInfo атрибуты кодируются как [0] IMPLICIT
+		signedAttributes := append([]byte{}, signed...)
+		signedAttributes[0] = asn1.ClassContextSpecific<<6 | 0x20
+
+		digestAlgorithm := pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256}
+		resp := tspResp{
+			Status: tspPKIStatusInfo{Status: tspResponseStatusGranted},
+			TimeStampToken: cmsEncapsulatedContentInfoSigned{
+				ContentType: oidTSPCmsSignedData,
+				Content: cmsSignedData{
+					Version:          3,
+					DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+					EncapContentInfo: cmsEncapsulatedContentInfo{EContentType: oidTSPTimeStampTokenContent, EContent: content},
+					Certificates:     []asn1.RawValue{{FullBytes: tsa.Raw}},
+					SignerInfos: []cmsSignerInfo{{
+						Version: 1,
+						RawSignerIdentifier: asn1.RawValue{FullBytes: marshal(cmsIssuerAndSerialNumber{
+							Issuer:       asn1.RawValue{FullBytes: tsa.RawIssuer},
+							SerialNumber: tsa.SerialNumber,
+						})},
+						DigestAlgorithm:    digestAlgorithm,
+						SignedAttributes:   asn1.RawValue{FullBytes: signedAttributes},
+						SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256},
+						Signature:          signature,
+					}},
+				},
+			},
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(marshal(resp))
+	}))
+}
+
+// TestRunProbeTSP проверяет результаты проверки TSP сервера.
+func TestRunProbeTSP(t *testing.T) {
+	ca, caKey := testCA(t, "test CA")
+	ekuValue, err := asn1.Marshal([]asn1.ObjectIdentifier{oidExtKeyUsageTimeStamping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := testResponderTemplate()
+	template.Subject.CommonName = "test TSA"
+	template.ExtKeyUsage = nil
+	template.ExtraExtensions = []pkix.Extension{{Id: oidExtensionExtKeyUsage, Critical: true, Value: ekuValue}}
+	tsa, tsaKey := testIssueCert(t, template, ca, caKey)
+	// сертификат без назначения id-kp-timeStamping
+	noEKU, noEKUKey := testIssueCert(t, testResponderTemplate(), ca, caKey)
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		key        *ecdsa.PrivateKey
+		mutate     func(*tspTSTInfo)
+		wantType   responseErrorType
+		wantReason string
+	}{
+		{name: "success", cert: tsa, key: tsaKey},
+		{name: "nonce mismatch", cert: tsa, key: tsaKey, mutate: func(ti *tspTSTInfo) { ti.Nonce = big.NewInt(1) }, wantType: responseErrorContents},
+		{name: "clock skew", cert: tsa, key: tsaKey, mutate: func(ti *tspTSTInfo) { ti.Time = ti.Time.Add(time.Hour) }, wantType: responseErrorContents},
+		{name: "signer EKU", cert: noEKU, key: noEKUKey, wantType: responseErrorSignature, wantReason: tspSignerReasonEKU},
+		// подпись ключом, не соответствующим сертификату
+		{name: "signature", cert: tsa, key: noEKUKey, wantType: responseErrorSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := testTSPServer(t, tt.cert, tt.key, tt.mutate)
+			defer srv.Close()
+
+			maxSize := int64(65536)
+			cfg := &tspConfig{
+				Name:              "test",
+				URL:               srv.URL,
+				Kind:              tspKindTimestamp,
+				PolicyOIDValue:    asn1.ObjectIdentifier{1, 2, 3, 4},
+				DigestOIDValue:    oidDigestSHA256,
+				DigestSize:        sha256.Size,
+				NonceSize:         8,
+				MaxClockSkewValue: time.Minute,
+				MaxResponseSize:   &maxSize,
+			}
+			testRunProbe(t, &tspProber{cfg}, newMetrics(prometheus.NewRegistry()), tt.wantType, tt.wantReason)
+		})
+	}
+}
+
+// TestRunProbeHTTP проверяет результаты проверки HTTP сервера.
+func TestRunProbeHTTP(t *testing.T) {
+	// закрытый сервер - сетевая ошибка
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		status   int
+		url      string // URL вместо URL тестового сервера
+		wantType responseErrorType
+	}{
+		{name: "success", status: http.StatusOK},
+		{name: "http", status: http.StatusNotFound, wantType: responseErrorHTTP},
+		{name: "net", url: closedURL, wantType: responseErrorNet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte("ok"))
+			}))
+			defer srv.Close()
+
+			u := srv.URL
+			if tt.url != "" {
+				u = tt.url
+			}
+			maxSize := int64(1024)
+			cfg := &httpConfig{Name: "test", URL: u, MaxResponseSize: &maxSize}
+			testRunProbe(t, &httpProber{cfg}, newMetrics(prometheus.NewRegistry()), tt.wantType, "")
+		})
+	}
+}
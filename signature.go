@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	_ "crypto/sha1"   // регистрация алгоритма хеширования для crypto.Hash
+	_ "crypto/sha256" // регистрация алгоритма хеширования для crypto.Hash
+	_ "crypto/sha512" // регистрация алгоритма хеширования для crypto.Hash
+)
+
+/*
+  Проверка подписей ответов OCSP/TSP серверов и подпись запросов.
+*/
+
+// Определение OID-ов алгоритмов подписи и хеширования
+var (
+	oidSignatureSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSignatureSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidSignatureRSAPSS          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidSignatureECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+
+	oidDigestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// signatureAlgorithm описывает поддерживаемый алгоритм подписи.
+type signatureAlgorithm struct {
+	oid        asn1.ObjectIdentifier
+	hash       crypto.Hash
+	pubKeyAlgo x509.PublicKeyAlgorithm
+}
+
+// поддерживаемые алгоритмы подписи (RSASSA-PSS обрабатывается отдельно, т.к. алгоритм
+// хеширования указывается в параметрах)
+var signatureAlgorithms = []signatureAlgorithm{
+	{oidSignatureSHA1WithRSA, crypto.SHA1, x509.RSA},
+	{oidSignatureSHA256WithRSA, crypto.SHA256, x509.RSA},
+	{oidSignatureSHA384WithRSA, crypto.SHA384, x509.RSA},
+	{oidSignatureSHA512WithRSA, crypto.SHA512, x509.RSA},
+	{oidSignatureECDSAWithSHA1, crypto.SHA1, x509.ECDSA},
+	{oidSignatureECDSAWithSHA256, crypto.SHA256, x509.ECDSA},
+	{oidSignatureECDSAWithSHA384, crypto.SHA384, x509.ECDSA},
+	{oidSignatureECDSAWithSHA512, crypto.SHA512, x509.ECDSA},
+}
+
+// поддерживаемые алгоритмы хеширования
+var digestAlgorithms = map[string]crypto.Hash{
+	oidDigestSHA1.String():   crypto.SHA1,
+	oidDigestSHA256.String(): crypto.SHA256,
+	oidDigestSHA384.String(): crypto.SHA384,
+	oidDigestSHA512.String(): crypto.SHA512,
+}
+
+// newDigest создает объект вычисления хеша для алгоритма хеширования с указанным OID
+// (в т.ч. алгоритмов ГОСТ).
+func newDigest(oid asn1.ObjectIdentifier) (hash.Hash, error) {
+	if h, found := digestAlgorithms[oid.String()]; found && h.Available() {
+		return h.New(), nil
+	}
+	if newHash, found := gostDigestAlgorithms[oid.String()]; found {
+		return newHash(), nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm: [%s]", oid.String())
+}
+
+// rsaPSSParameters определяет параметры алгоритма подписи RSASSA-PSS (RFC4055).
+// Нас интересует только алгоритм хеширования.
+//
+//	RSASSA-PSS-params  ::=  SEQUENCE  {
+//	  hashAlgorithm      [0] HashAlgorithm DEFAULT sha1Identifier,
+//	  maskGenAlgorithm   [1] MaskGenAlgorithm DEFAULT mgf1SHA1Identifier,
+//	  saltLength         [2] INTEGER DEFAULT 20,
+//	  trailerField       [3] INTEGER DEFAULT 1  }
+type rsaPSSParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0,optional"`
+	MGF          asn1.RawValue            `asn1:"explicit,tag:1,optional"`
+	SaltLength   int                      `asn1:"explicit,tag:2,optional,default:20"`
+	TrailerField int                      `asn1:"explicit,tag:3,optional,default:1"`
+}
+
+// verifySignature проверяет подпись signature данных signed открытым ключом сертификата cert
+// с использованием алгоритма подписи sigAlg.
+func verifySignature(cert *x509.Certificate, sigAlg pkix.AlgorithmIdentifier, signed, signature []byte) error {
+	if cert == nil {
+		return errors.New("no certificate to verify signature")
+	}
+
+	// алгоритмы ГОСТ проверяем отдельно (не поддерживаются crypto/x509)
+	if gostAlg := gostSignatureAlgorithmByOID(sigAlg.Algorithm); gostAlg != nil {
+		return gostVerify(cert, gostAlg, signed, signature)
+	}
+
+	// определяем алгоритм хеширования и тип ключа
+	var (
+		hash       crypto.Hash
+		pubKeyAlgo x509.PublicKeyAlgorithm
+		pss        bool
+	)
+	if sigAlg.Algorithm.Equal(oidSignatureRSAPSS) {
+		var params rsaPSSParameters
+		if _, err := asn1.Unmarshal(sigAlg.Parameters.FullBytes, &params); err != nil {
+			return fmt.Errorf("failed to decode RSASSA-PSS parameters: [%w]", err)
+		}
+		hash = crypto.SHA1
+		if len(params.Hash.Algorithm) > 0 {
+			hash = digestAlgorithms[params.Hash.Algorithm.String()]
+		}
+		pubKeyAlgo, pss = x509.RSA, true
+	} else {
+		for i := range signatureAlgorithms {
+			if signatureAlgorithms[i].oid.Equal(sigAlg.Algorithm) {
+				hash, pubKeyAlgo = signatureAlgorithms[i].hash, signatureAlgorithms[i].pubKeyAlgo
+				break
+			}
+		}
+	}
+	if hash == 0 || !hash.Available() {
+		return fmt.Errorf("unsupported signature algorithm: [%s]", sigAlg.Algorithm.String())
+	}
+	if cert.PublicKeyAlgorithm != pubKeyAlgo {
+		return fmt.Errorf("signature algorithm does not match certificate public key: [%s], [%s]", sigAlg.Algorithm.String(), cert.PublicKeyAlgorithm.String())
+	}
+
+	// вычисляем хеш подписанных данных
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	// проверяем подпись
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		var err error
+		if pss {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid RSA signature: [%w]", err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, signature) {
+			return errors.New("invalid ECDSA signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type: [%T]", cert.PublicKey)
+	}
+	return nil
+}
+
+// x509CertificateRaw определяет структуру сертификата X.509 верхнего уровня (для получения
+// алгоритма подписи в виде AlgorithmIdentifier, в т.ч. для алгоритмов ГОСТ).
+//
+//	Certificate ::= SEQUENCE {
+//	  tbsCertificate       TBSCertificate,
+//	  signatureAlgorithm   AlgorithmIdentifier,
+//	  signatureValue       BIT STRING }
+type x509CertificateRaw struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// verifyIssuedBy проверяет, что сертификат cert выпущен издателем issuer: имя издателя cert
+// совпадает с именем субъекта issuer и подпись cert подтверждается ключом issuer.
+func verifyIssuedBy(cert, issuer *x509.Certificate) error {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return fmt.Errorf("certificate issuer name mismatch: [%s], [%s]", cert.Issuer.String(), issuer.Subject.String())
+	}
+
+	var raw x509CertificateRaw
+	if _, err := asn1.Unmarshal(cert.Raw, &raw); err != nil {
+		return fmt.Errorf("failed to decode certificate: [%w]", err)
+	}
+	if err := verifySignature(issuer, raw.SignatureAlgorithm, cert.RawTBSCertificate, raw.SignatureValue.RightAlign()); err != nil {
+		return fmt.Errorf("certificate signature verification failed: [%w]", err)
+	}
+	return nil
+}
+
+// signData подписывает данные data ключом key (RSA PKCS#1 v1.5 или ECDSA).
+// Для RSA используется SHA-256, для ECDSA - алгоритм хеширования, соответствующий размеру кривой.
+//
+// Возвращает идентификатор алгоритма подписи и значение подписи.
+func signData(key crypto.Signer, data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	var (
+		sigAlg pkix.AlgorithmIdentifier
+		h      crypto.Hash
+	)
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidSignatureSHA256WithRSA, Parameters: asn1.NullRawValue}
+		h = crypto.SHA256
+
+	case *ecdsa.PublicKey:
+		switch bitSize := pub.Curve.Params().BitSize; {
+		case bitSize > 384:
+			sigAlg, h = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA512}, crypto.SHA512
+		case bitSize > 256:
+			sigAlg, h = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}, crypto.SHA384
+		default:
+			sigAlg, h = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}, crypto.SHA256
+		}
+
+	default:
+		return sigAlg, nil, fmt.Errorf("unsupported signing key type: [%T]", pub)
+	}
+
+	hasher := h.New()
+	hasher.Write(data)
+	signature, err := key.Sign(rand.Reader, hasher.Sum(nil), h)
+	if err != nil {
+		return sigAlg, nil, fmt.Errorf("failed to sign data: [%w]", err)
+	}
+	return sigAlg, signature, nil
+}
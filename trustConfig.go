@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Расширения файлов, загружаемых из каталогов доверенных сертификатов
+var trustDirExtensions = []string{".pem", ".crt", ".cer", ".der"}
+
+// trustConfig определяет структуру с настройками общего хранилища доверенных сертификатов
+// (корневых и промежуточных сертификатов НУЦ РК, RSA и ГОСТ). Хранилище используется для построения
+// цепочек сертификатов OCSP серверов и TSA всех целей мониторинга (см. certChain.go).
+type trustConfig struct {
+	// Files содержит пути к файлам доверенных сертификатов. Файл может содержать один или несколько
+	// сертификатов в PEM либо один сертификат в ASN.1 DER.
+	Files []string `json:"files" yaml:"files"`
+
+	// Dirs содержит пути к каталогам доверенных сертификатов. Из каталога загружаются файлы
+	// с расширениями .pem, .crt, .cer и .der (без обхода вложенных каталогов).
+	Dirs []string `json:"dirs" yaml:"dirs"`
+
+	// Certs содержит доверенные сертификаты: ASN.1 DER в base64 или текст PEM.
+	Certs []string `json:"certs" yaml:"certs"`
+
+	// Разобранные доверенные сертификаты (без повторов).
+	Certificates []*x509.Certificate `json:"-" yaml:"-"`
+}
+
+// SetDefaults позволяет инициализировать не заданные/критичные поля значениями по умолчанию.
+func (cfg *trustConfig) SetDefaults() {
+	if cfg == nil {
+		return
+	}
+}
+
+// UpdateCommandLine позволяет проверить и установить значения объекта конфигурации из
+// параметров командной строки.
+func (cfg *trustConfig) UpdateCommandLine(givenFlags []*flag.Flag) {
+	if cfg == nil {
+		return
+	}
+	for _, f := range givenFlags {
+		switch f.Name {
+		case "trust.files":
+			cfg.Files = trustSplitList(*clpTrustFiles)
+		case "trust.dirs":
+			cfg.Dirs = trustSplitList(*clpTrustDirs)
+		}
+	}
+}
+
+// Validate проверяет формат и наличие необходимых параметров, декодирует нужные значения и т.д.
+func (cfg *trustConfig) Validate() error {
+	if cfg == nil {
+		return errors.New("nil trust config object")
+	}
+
+	cfg.Certificates = nil
+	for _, fn := range cfg.Files {
+		certs, err := loadCertificates(fn)
+		if err != nil {
+			return fmt.Errorf("invalid trust config: failed to load file: [%w]", err)
+		}
+		cfg.Certificates = trustMerge(cfg.Certificates, certs)
+	}
+
+	for _, dir := range cfg.Dirs {
+		entries, err := os.ReadDir(filepath.Clean(dir))
+		if err != nil {
+			return fmt.Errorf("invalid trust config: failed to read dir: [%s], [%w]", dir, err)
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.IsDir() || !slices.Contains(trustDirExtensions, ext) {
+				continue
+			}
+			certs, err := loadCertificates(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return fmt.Errorf("invalid trust config: failed to load dir: [%s], [%w]", dir, err)
+			}
+			cfg.Certificates = trustMerge(cfg.Certificates, certs)
+		}
+	}
+
+	for i, cert := range cfg.Certs {
+		certs, err := trustParseInline(cert)
+		if err != nil {
+			return fmt.Errorf("invalid trust config: certs[%d]: [%w]", i, err)
+		}
+		cfg.Certificates = trustMerge(cfg.Certificates, certs)
+	}
+
+	return nil
+}
+
+// trustParseInline разбирает доверенные сертификаты, указанные в конфигурации: текст PEM
+// (один или несколько сертификатов) или ASN.1 DER в base64.
+func trustParseInline(cert string) ([]*x509.Certificate, error) {
+	if strings.Contains(cert, "-----BEGIN") {
+		certs, err := parseCertificatesPEM([]byte(cert))
+		if err != nil {
+			return nil, err
+		}
+		if len(certs) == 0 {
+			return nil, errors.New("no certificates in PEM")
+		}
+		return certs, nil
+	}
+
+	derCert, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields([]byte(cert)), nil)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode from cert: [%w]", err)
+	}
+	out, err := x509.ParseCertificate(derCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: [%w]", err)
+	}
+	return []*x509.Certificate{out}, nil
+}
+
+// trustSplitList разбирает список путей, разделенных запятыми (параметры командной строки).
+func trustSplitList(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// trustMerge возвращает объединение доверенных сертификатов общего хранилища trust и цели мониторинга own
+// (без повторов). Результат не разделяет память с аргументами.
+func trustMerge(trust, own []*x509.Certificate) []*x509.Certificate {
+	out := make([]*x509.Certificate, 0, len(trust)+len(own))
+	for _, cert := range slices.Concat(trust, own) {
+		if !certChainContains(out, cert) {
+			out = append(out, cert)
+		}
+	}
+	return out
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
@@ -10,25 +11,106 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
-// tspMonitorStart проверяет конфигурацию и запускает goroutine-у мониторинга TSP сервера.
+// tspProber реализует Probe для проверки TSP сервера: запрашивает метку времени,
+// проверяет ее подпись и содержимое.
+type tspProber struct {
+	cfg *tspConfig
+}
+
+// Protocol возвращает тип проверки.
+func (p *tspProber) Protocol() protocolType {
+	return protoTSP
+}
+
+// Settings возвращает общие настройки проверки.
+func (p *tspProber) Settings() probeSettings {
+	return probeSettings{
+		Name:            p.cfg.Name,
+		URL:             p.cfg.URL,
+		Method:          http.MethodPost,
+		Timeout:         p.cfg.TimeoutValue,
+		MaxResponseSize: *p.cfg.MaxResponseSize,
+		RetryCount:      p.cfg.RetryCount,
+		RetryInterval:   p.cfg.RetryIntervalValue,
+	}
+}
+
+// tspKindFailInfo определяет ожидаемый бит PKIFailureInfo отказа для видов проверки некорректными запросами.
+var tspKindFailInfo = map[string]int{
+	tspKindBadPolicy:     tspFailInfoUnacceptedPolicy,
+	tspKindBadDigestSize: tspFailInfoBadDataFormat,
+	tspKindBadAlg:        tspFailInfoBadAlg,
+}
+
+// NewRequest формирует TSP запрос из настроек (со случайными хешем данных, если он не задан, и nonce)
+// в соответствии с видом проверки cfg.Kind.
+func (p *tspProber) NewRequest(_ context.Context, verbose bool, le *zerolog.Event) (*probeRequest, error) {
+	cfg := p.cfg
+
+	// кодируем запрос
+	req, digestSize := tspNewRequest(cfg)
+	reqEnc, encodeError := tspEncodeRequest(req, digestSize, cfg.NonceSize)
+	if encodeError != nil {
+		return nil, encodeError
+	}
+	if verbose {
+		le.Str("digest", base64.StdEncoding.EncodeToString(req.MessageImprint.HashedMessage)).
+			Str("nonce", base64.StdEncoding.EncodeToString(req.Nonce.Bytes()))
+	}
+
+	return &probeRequest{
+		ContentType: "application/timestamp-query",
+		Body:        reqEnc,
+		Validate: func(nr *networkResult, mt *metrics, verbose bool, le *zerolog.Event) error {
+			// декодируем
+			var resp tspResp
+			if _, decodeError := asn1.Unmarshal(nr.Body, &resp); decodeError != nil {
+				return newValidationError(responseErrorAsn, fmt.Errorf("decode TSP response: [%w]", decodeError))
+			}
+
+			// статус ответа учитываем для всех видов проверки
+			tspLogStatus(&resp.Status, le)
+			mt.TSPStatus(cfg.Name, &resp.Status)
+
+			// на некорректный запрос ожидаем отказ
+			if failInfo, found := tspKindFailInfo[cfg.Kind]; found {
+				if validateError := tspRejectionValidate(&resp, failInfo); validateError != nil {
+					return fmt.Errorf("validate TSP response: [%w]", validateError)
+				}
+				return nil
+			}
+
+			// проверяем содержимое
+			respInfo, validateError := tspResponseValidate(&resp, req, cfg, nr, verbose, le)
+			if respInfo != nil {
+				certWarnings := certExpiryCheck(mt, cfg.Name, certRoleTSA, []*x509.Certificate{respInfo.Signer}, cfg.CertExpiryWarningValues, nil)
+				if len(certWarnings) > 0 {
+					le.Strs("certWarnings", certWarnings)
+				}
+				if !respInfo.GenTime.IsZero() {
+					mt.TSPClockSkew(cfg.Name, respInfo.ClockSkew)
+				}
+			}
+			if validateError != nil {
+				return fmt.Errorf("validate TSP response: [%w]", validateError)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// tspNewRequest создает шаблон TSP запроса по настройкам cfg. Для видов проверки некорректными
+// запросами в шаблон вносится соответствующее искажение (политика, размер хеша или алгоритм хеширования).
 //
-// ctx - контекст выхода. При отмене данного контекста все запущенные goroutine-ы должны завершить работу.
-// Возвращает канал, который будет закрыт при ошибке запуска/завершении работы goroutine-ы мониторинга.
-// В остальных случаях через него будут возвращены результаты работы мониторинга
-func tspMonitorStart(ctx context.Context) <-chan error {
-	cfg := getAppContext().Config.TSP
-	resultChannel := make(chan error, 1)
-
-	// создаем логгер для TSP
-	ml := getAppContext().Logger.With().
-		Str("module", "monitor").Str("protocol", string(protoTSP)).
-		Str("url", cfg.URL).Logger()
-
-	// создаем шаблон запроса
+// Возвращает шаблон и размер случайно генерируемого хеша данных для tspEncodeRequest
+// (0, если в настройках указан постоянный хеш).
+func tspNewRequest(cfg *tspConfig) (*tspRequest, int) {
 	req := &tspRequest{
 		Version: 1,
 		MessageImprint: tspMessageImprint{
@@ -43,12 +125,6 @@ func tspMonitorStart(ctx context.Context) <-chan error {
 		CertReq:   true,
 	}
 
-	// создаем клиента для работы с HTTP с поддержкой сетевого таймута
-	mc := &http.Client{
-		Transport: &http.Transport{},
-		Timeout:   cfg.TimeoutValue,
-	}
-
 	// проверим есть ли у нас хеш данных на который получаем метку времени
 	digestSize := cfg.DigestSize
 	if len(cfg.DigestValue) != 0 {
@@ -58,139 +134,20 @@ func tspMonitorStart(ctx context.Context) <-chan error {
 		digestSize = 0
 	}
 
-	// объект метрик
-	mt := getAppContext().Metrics
-
-	// флаг вывода расширенного лога
-	verbose := getAppContext().Config.Log.Verbose
-
-	// запускаем gorotuine-у монитора
-	sch := make(chan struct{})
-	go func() {
-		// горутина инициализирована - закрываем канал запуска
-		close(sch)
-
-		var lastError error
-
-		// при выходе пишем ошибку и закрываем канал
-		defer func() {
-			// выводим ошибку в канал и в протокол
-			le := ml.Log()
-			if lastError != nil {
-				select {
-				case resultChannel <- lastError:
-				default:
-				}
-				le.Err(lastError)
-			}
-			le.Msg("stop")
-			// всегда закрываем канал
-			close(resultChannel)
-		}()
-
-		// основной цикл обработки
-		for i := 0; cfg.RetryCount == 0 || i < cfg.RetryCount; i++ {
-			// выходим из goroutine-ы при отмене контекста
-			if ctx.Err() != nil {
-				break
-			}
-
-			// кодируем запрос
-			reqEnc, encodeError := tspEncodeRequest(req, digestSize, cfg.NonceSize)
-			if encodeError != nil {
-				// при ошибках кодирования запроса - завершаем goroutine-у
-				lastError = encodeError
-				break
-			}
-
-			// создаем событие протокола
-			le := ml.Log().Int("num", i+1)
-			if verbose {
-				le.Str("request", base64.StdEncoding.EncodeToString(reqEnc)).
-					Str("digest", base64.StdEncoding.EncodeToString(req.MessageImprint.HashedMessage)).
-					Str("nonce", base64.StdEncoding.EncodeToString(req.Nonce.Bytes()))
-			}
-
-			// отправляем запрос на сервер
-			nr, err := postRequest(ctx, mc, protoTSP, cfg.URL, *cfg.MaxResponseSize, reqEnc)
-			if nr.StatusCode == 0 && nr.SendReceiveTime == 0 {
-				// произошла ошибка при формировании запроса - завершаем goroutine-у
-				lastError = errors.New("failed to create TSP HTTP request")
-				break
-			}
-
-			// обновляем статистику времени обработки запроса
-			mt.RequestProcessingTimeObserve(protoTSP, nr.SendReceiveTime)
-
-			// выведем тело и время обработки запроса в протокол
-			if verbose {
-				le.Str("response", base64.StdEncoding.EncodeToString(nr.Body)).
-					Dur("processingTime", nr.SendReceiveTime)
-			}
-
-			// наконец обработаем ошибку postRequest
-			if err != nil {
-				if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
-					// отменен основной контекст - просто выходим из goroutine-ы
-					break
-				}
-
-				// обновляем статистику и протоколируем ошибку
-				mt.ResponseError(protoTSP, responseErrorNet)
-				le.Str("errorType", string(responseErrorNet)).Err(fmt.Errorf("receive TSP response: [%w]", err)).Msg("request failed")
-				if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-					waitForTimeout(ctx, cfg.RetryIntervalValue)
-				}
-				continue
-			}
-
-			// проверим HTTP статус код ответа - успешные коды в диапазоне (200,300)
-			if nr.StatusCode < http.StatusOK || nr.StatusCode >= http.StatusMultipleChoices {
-				mt.ResponseError(protoTSP, responseErrorHTTP)
-				err = fmt.Errorf("receive TSP response: invalid HTTP status code: [%d]: [%s]", nr.StatusCode, http.StatusText(nr.StatusCode))
-				le.Str("errorType", string(responseErrorHTTP)).Err(err).Msg("request failed")
-				if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-					waitForTimeout(ctx, cfg.RetryIntervalValue)
-				}
-				continue
-			}
-
-			// пишем доп. данные
-			if verbose {
-				le.Int("statusCode", nr.StatusCode).Str("contentType", nr.ContentType)
-			}
-
-			// декодируем
-			var resp tspResp
-			if _, decodeError := asn1.Unmarshal(nr.Body, &resp); decodeError != nil {
-				mt.ResponseError(protoTSP, responseErrorAsn)
-				le.Str("errorType", string(responseErrorAsn)).Err(fmt.Errorf("decode TSP response: [%w]", decodeError)).Msg("request failed")
-				if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-					waitForTimeout(ctx, cfg.RetryIntervalValue)
-				}
-				continue
-			}
-
-			// проверяем содержимое
-			if validateError := tspResponseValidate(&resp, req, verbose, le); validateError != nil {
-				mt.ResponseError(protoTSP, responseErrorContents)
-				le.Str("errorType", string(responseErrorContents)).Err(fmt.Errorf("validate TSP response: [%w]", validateError)).Msg("request failed")
-			} else {
-				le.Msg("request succeed")
-			}
-
-			// ждем указанный таймаут
-			if cfg.RetryCount == 0 || i != cfg.RetryCount-1 {
-				waitForTimeout(ctx, cfg.RetryIntervalValue)
-			}
+	switch cfg.Kind {
+	case tspKindBadPolicy:
+		req.ReqPolicy = oidTSPUnsupportedPolicy
+	case tspKindBadAlg:
+		req.MessageImprint.HashAlgorithm.Algorithm = oidTSPUnsupportedDigest
+	case tspKindBadDigestSize:
+		// хеш на байт длиннее, чем положено алгоритму DigestOID
+		if digestSize > 0 {
+			digestSize++
+		} else {
+			req.MessageImprint.HashedMessage = append(cfg.DigestValue[:len(cfg.DigestValue):len(cfg.DigestValue)], 0)
 		}
-	}()
-	<-sch
-
-	ml.Log().
-		Int("retryCount", cfg.RetryCount).Dur("retryInterval", cfg.RetryIntervalValue).
-		Msg("start")
-	return resultChannel
+	}
+	return req, digestSize
 }
 
 // tspEncodeRequest позволяет закодировать TSP запрос в ASN.1.
@@ -236,22 +193,76 @@ func tspEncodeRequest(request *tspRequest, digestSize, nonceSize int) (encoded [
 	return encoded, outError
 }
 
+// tspRejectionValidate проверяет, что TSA отказал в выдаче метки времени (PKIStatus rejection)
+// и установил в PKIFailureInfo бит failInfo.
+func tspRejectionValidate(response *tspResp, failInfo int) error {
+	if response.Status.Status != tspResponseStatusRejection {
+		if response.Status.Status == tspResponseStatusGranted || response.Status.Status == tspResponseStatusGrantedWithMods {
+			return fmt.Errorf("TSA granted timestamp for invalid request: [%s]", tspResponseStatusName(response.Status.Status))
+		}
+		return fmt.Errorf("TSP response Status mismatch: [%s], expected [%s]",
+			tspResponseStatusName(response.Status.Status), tspResponseStatusName(tspResponseStatusRejection))
+	}
+	if response.Status.FailInfo.At(failInfo) != 1 {
+		return fmt.Errorf("TSP response failInfo mismatch: [%s], expected [%s]",
+			strings.Join(response.Status.FailInfoNames(), ","), tspFailInfoNames[failInfo])
+	}
+	return nil
+}
+
+// tspLogStatus записывает в le статус TSP ответа, а также, если они есть в ответе, имена битов
+// failInfo и строки statusString.
+func tspLogStatus(si *tspPKIStatusInfo, le *zerolog.Event) {
+	le.Str("status", tspResponseStatusName(si.Status))
+	if names := si.FailInfoNames(); len(names) > 0 {
+		le.Strs("failInfo", names)
+	}
+	if strs := si.StatusStrings(); len(strs) > 0 {
+		le.Strs("statusString", strs)
+	}
+}
+
+// tspResponseInfo содержит сведения о подписи и времени метки из TSP ответа.
+type tspResponseInfo struct {
+	// GenTime время формирования метки (TSTInfo.genTime)
+	GenTime time.Time
+
+	// Accuracy заявленная TSA точность времени метки (TSTInfo.accuracy)
+	Accuracy time.Duration
+
+	// ClockSkew расхождение GenTime с локальным временем - серединой интервала от отправки запроса
+	// до получения ответа. Положительное значение - время TSA опережает локальное.
+	ClockSkew time.Duration
+
+	// Signer сертификат, которым подтверждена подпись метки времени
+	Signer *x509.Certificate
+}
+
 // tspResponseValidate проверяет корректность декодированного TSP ответа и сравнивает
-// его содержимое с отправленным запросом.
-func tspResponseValidate(response *tspResp, request *tspRequest, verbose bool, le *zerolog.Event) error {
+// его содержимое с отправленным запросом и настройками цели мониторинга cfg.
+// Ошибки проверки CMS подписи метки времени и сертификата подписи TSA (см. tspSignerValidate)
+// возвращаются с типом responseErrorSignature.
+//
+// nr содержит результаты сетевого взаимодействия, по которым вычисляется расхождение времени TSA.
+// Если подпись метки времени проверена, то сведения о метке возвращаются даже в случае ошибки
+// дальнейшей проверки (в том числе при превышении cfg.MaxClockSkewValue). Сведения о времени метки
+// заполняются только после проверки ее содержимого (политики, MessageImprint и nonce), иначе GenTime нулевое.
+func tspResponseValidate(response *tspResp, request *tspRequest, cfg *tspConfig, nr *networkResult, verbose bool, le *zerolog.Event) (*tspResponseInfo, error) {
 	// проверяем статус ответа
 	if response.Status.Status != tspResponseStatusGranted && response.Status.Status != tspResponseStatusGrantedWithMods {
-		return fmt.Errorf("invalid TSP response Status: %d", response.Status.Status)
+		return nil, fmt.Errorf("invalid TSP response Status: [%s], failInfo [%s], statusString [%s]",
+			tspResponseStatusName(response.Status.Status), strings.Join(response.Status.FailInfoNames(), ","),
+			strings.Join(response.Status.StatusStrings(), "; "))
 	}
 
 	// проверяем OID типа CMS
 	if !response.TimeStampToken.ContentType.Equal(oidTSPCmsSignedData) {
-		return fmt.Errorf("invalid TSP TimeStampToken OID: [%s]", response.TimeStampToken.ContentType.String())
+		return nil, fmt.Errorf("invalid TSP TimeStampToken OID: [%s]", response.TimeStampToken.ContentType.String())
 	}
 
 	// должна быть одна подпись
 	if len(response.TimeStampToken.Content.SignerInfos) != 1 {
-		return fmt.Errorf("single signature under TSP TimeStampToken expected: [%d]", len(response.TimeStampToken.Content.SignerInfos))
+		return nil, fmt.Errorf("single signature under TSP TimeStampToken expected: [%d]", len(response.TimeStampToken.Content.SignerInfos))
 	}
 
 	// выведем алгоритмы подписи/хеширования
@@ -262,39 +273,81 @@ func tspResponseValidate(response *tspResp, request *tspRequest, verbose bool, l
 
 	// проверим OID содержимого CMS
 	if !response.TimeStampToken.Content.EncapContentInfo.EContentType.Equal(oidTSPTimeStampTokenContent) {
-		return fmt.Errorf("invalid TSP EncapContentInfo OID: [%s]", response.TimeStampToken.Content.EncapContentInfo.EContentType.String())
+		return nil, fmt.Errorf("invalid TSP EncapContentInfo OID: [%s]", response.TimeStampToken.Content.EncapContentInfo.EContentType.String())
+	}
+
+	// проверяем CMS подпись метки времени
+	signer, signatureError := cmsVerify(&response.TimeStampToken.Content, &response.TimeStampToken.Content.SignerInfos[0])
+	if signatureError != nil {
+		return nil, newValidationError(responseErrorSignature, fmt.Errorf("TSP TimeStampToken: [%w]", signatureError))
+	}
+	if verbose {
+		le.Str("respSigner", signer.Subject.String())
+	}
+	respInfo := &tspResponseInfo{Signer: signer}
+
+	// проверяем сертификат подписи TSA и его цепочку
+	chain, signerError := tspSignerValidate(&response.TimeStampToken.Content, &response.TimeStampToken.Content.SignerInfos[0], signer, cfg.TrustCertificates)
+	if signerError != nil {
+		return respInfo, fmt.Errorf("TSP TimeStampToken signer: [%w]", signerError)
+	}
+	if verbose && len(chain) > 0 {
+		le.Strs("respChain", certChainSubjects(chain))
 	}
 
 	// декодируем метку времени
 	encodedTstInfo := response.TimeStampToken.Content.EncapContentInfo.EContent
 	if len(encodedTstInfo) < 1 {
-		return fmt.Errorf("invalid TSP TSTInfo encoded size: [%d]", len(encodedTstInfo))
+		return respInfo, fmt.Errorf("invalid TSP TSTInfo encoded size: [%d]", len(encodedTstInfo))
 	}
 
 	var ti tspTSTInfo
 	if _, decodeError := asn1.Unmarshal(encodedTstInfo, &ti); decodeError != nil {
-		return fmt.Errorf("failed to decode TSTInfo: [%w]", decodeError)
+		return respInfo, fmt.Errorf("failed to decode TSTInfo: [%w]", decodeError)
 	}
 
 	// проверяем содержимое. Сначала политику
 	if !ti.Policy.Equal(request.ReqPolicy) {
-		return fmt.Errorf("TSP policy OID mismatch: [%s], [%s]", ti.Policy.String(), request.ReqPolicy.String())
+		return respInfo, fmt.Errorf("TSP policy OID mismatch: [%s], [%s]", ti.Policy.String(), request.ReqPolicy.String())
 	}
 
 	// затем MessageImprint
 	if !bytes.Equal(ti.MessageImprint.Raw, request.MessageImprint.Raw) {
-		return errors.New("TSP MessageImprint mismatch")
+		return respInfo, errors.New("TSP MessageImprint mismatch")
 	}
 
 	// и если есть nonce
 	if request.Nonce != nil {
 		if ti.Nonce == nil {
-			return errors.New("TSP response nonce mismatch (nil)")
+			return respInfo, errors.New("TSP response nonce mismatch (nil)")
 		}
 		if ti.Nonce.Cmp(request.Nonce) != 0 {
-			return errors.New("TSP nonce mismatch")
+			return respInfo, errors.New("TSP nonce mismatch")
 		}
 	}
 
-	return nil
+	// вычисляем расхождение времени TSA с локальным временем (серединой интервала отправки/получения)
+	roundTrip := nr.SendReceiveTime
+	respInfo.GenTime = ti.Time
+	respInfo.Accuracy = ti.Accuracy.Duration()
+	respInfo.ClockSkew = respInfo.GenTime.Sub(nr.SendTime.Add(roundTrip / 2))
+
+	if verbose {
+		le.Time("genTime", respInfo.GenTime).Dur("accuracy", respInfo.Accuracy)
+	}
+	le.Dur("clockSkew", respInfo.ClockSkew)
+
+	// проверяем расхождение с учетом заявленной точности и неопределенности, вносимой временем обработки запроса
+	if cfg.MaxClockSkewValue > 0 {
+		skew := respInfo.ClockSkew
+		if skew < 0 {
+			skew = -skew
+		}
+		if tolerance := cfg.MaxClockSkewValue + respInfo.Accuracy + roundTrip/2; skew > tolerance {
+			return respInfo, fmt.Errorf("TSA clock skew exceeded: [%s], max [%s] (accuracy [%s], round trip [%s])",
+				respInfo.ClockSkew, cfg.MaxClockSkewValue, respInfo.Accuracy, roundTrip)
+		}
+	}
+
+	return respInfo, nil
 }
@@ -3,8 +3,10 @@ package main
 import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"fmt"
 	"math/big"
 	"time"
+	"unicode/utf8"
 )
 
 /*
@@ -16,6 +18,22 @@ import (
 var (
 	oidTSPCmsSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
 	oidTSPTimeStampTokenContent = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+	oidCmsAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidCmsAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	// атрибуты ESS (RFC2634, RFC5035), идентифицирующие сертификат подписи TSA
+	oidCmsAttributeSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidCmsAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	// расширенное назначение ключа id-kp-timeStamping и OID расширения extKeyUsage (RFC5280)
+	oidExtKeyUsageTimeStamping = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	oidExtensionExtKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+	// OID-ы из арки example (2.999, ITU-T X.660), заведомо не поддерживаемые TSA.
+	// Используются в проверках реакции TSA на некорректные запросы.
+	oidTSPUnsupportedPolicy = asn1.ObjectIdentifier{2, 999, 1}
+	oidTSPUnsupportedDigest = asn1.ObjectIdentifier{2, 999, 2}
 )
 
 // Определение разрешенных (считающихся корректными) статусов TSP ответа.
@@ -24,6 +42,61 @@ const (
 	tspResponseStatusGrantedWithMods = int(1)
 )
 
+// Статус отказа в выдаче метки времени (PKIStatus rejection).
+const tspResponseStatusRejection = int(2)
+
+// tspResponseStatusNames определяет имена статусов TSP ответа (PKIStatus, RFC3161 2.4.2).
+var tspResponseStatusNames = map[int]string{
+	tspResponseStatusGranted:         "granted",
+	tspResponseStatusGrantedWithMods: "grantedWithMods",
+	tspResponseStatusRejection:       "rejection",
+	3:                                "waiting",
+	4:                                "revocationWarning",
+	5:                                "revocationNotification",
+}
+
+// tspResponseStatusName возвращает имя статуса TSP ответа.
+func tspResponseStatusName(status int) string {
+	if name, found := tspResponseStatusNames[status]; found {
+		return name
+	}
+	return fmt.Sprintf("status(%d)", status)
+}
+
+// Номера битов PKIFailureInfo (RFC3161 2.4.2).
+//
+//	PKIFailureInfo ::= BIT STRING {
+//	  badAlg               (0),
+//	  badRequest           (2),
+//	  badDataFormat        (5),
+//	  timeNotAvailable    (14),
+//	  unacceptedPolicy    (15),
+//	  unacceptedExtension (16),
+//	  addInfoNotAvailable (17),
+//	  systemFailure       (25) }
+const (
+	tspFailInfoBadAlg              = 0
+	tspFailInfoBadRequest          = 2
+	tspFailInfoBadDataFormat       = 5
+	tspFailInfoTimeNotAvailable    = 14
+	tspFailInfoUnacceptedPolicy    = 15
+	tspFailInfoUnacceptedExtension = 16
+	tspFailInfoAddInfoNotAvailable = 17
+	tspFailInfoSystemFailure       = 25
+)
+
+// tspFailInfoNames определяет имена битов PKIFailureInfo.
+var tspFailInfoNames = map[int]string{
+	tspFailInfoBadAlg:              "badAlg",
+	tspFailInfoBadRequest:          "badRequest",
+	tspFailInfoBadDataFormat:       "badDataFormat",
+	tspFailInfoTimeNotAvailable:    "timeNotAvailable",
+	tspFailInfoUnacceptedPolicy:    "unacceptedPolicy",
+	tspFailInfoUnacceptedExtension: "unacceptedExtension",
+	tspFailInfoAddInfoNotAvailable: "addInfoNotAvailable",
+	tspFailInfoSystemFailure:       "systemFailure",
+}
+
 // tspRequest определяет структуру TSP запроса.
 //
 //	TimeStampReq ::= SEQUENCE {
@@ -82,6 +155,34 @@ type tspPKIStatusInfo struct {
 	FailInfo     asn1.BitString  `asn1:"optional,omitempty"`
 }
 
+// FailInfoNames возвращает имена установленных битов PKIFailureInfo (неизвестные биты - в виде bit(N)).
+func (si *tspPKIStatusInfo) FailInfoNames() []string {
+	var names []string
+	for i := 0; i < si.FailInfo.BitLength; i++ {
+		if si.FailInfo.At(i) == 0 {
+			continue
+		}
+		name, found := tspFailInfoNames[i]
+		if !found {
+			name = fmt.Sprintf("bit(%d)", i)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// StatusStrings возвращает строки statusString (PKIFreeText ::= SEQUENCE SIZE (1..MAX) OF UTF8String).
+// Элементы, не являющиеся корректными UTF8String, пропускаются.
+func (si *tspPKIStatusInfo) StatusStrings() []string {
+	var out []string
+	for _, s := range si.StatusString {
+		if s.Class == asn1.ClassUniversal && s.Tag == asn1.TagUTF8String && utf8.Valid(s.Bytes) {
+			out = append(out, string(s.Bytes))
+		}
+	}
+	return out
+}
+
 // cmsSignedData определяет структуру CMS с подписью.
 //
 //	SignedData ::= SEQUENCE {
@@ -121,12 +222,37 @@ type cmsSignerInfo struct {
 	Version             int
 	RawSignerIdentifier asn1.RawValue
 	DigestAlgorithm     pkix.AlgorithmIdentifier
-	SignedAttributes    []asn1.RawValue `asn1:"optional,omitempty,tag:0"`
+	SignedAttributes    asn1.RawValue `asn1:"optional,tag:0"`
 	SignatureAlgorithm  pkix.AlgorithmIdentifier
 	Signature           []byte
 	UnsignedAttributes  []asn1.RawValue `asn1:"optional,omitempty,tag:1"`
 }
 
+// cmsAttribute определяет структуру атрибута SignerInfo (подписываемого или нет).
+//
+//	Attribute ::= SEQUENCE {
+//	  attrType OBJECT IDENTIFIER,
+//	  attrValues SET OF AttributeValue }
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// cmsIssuerAndSerialNumber определяет вариант SignerIdentifier с именем издателя и серийным номером
+// сертификата подписанта.
+//
+//	SignerIdentifier ::= CHOICE {
+//	  issuerAndSerialNumber IssuerAndSerialNumber,
+//	  subjectKeyIdentifier [0] SubjectKeyIdentifier }
+//
+//	IssuerAndSerialNumber ::= SEQUENCE {
+//	  issuer Name,
+//	  serialNumber CertificateSerialNumber }
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
 // cmsEncapsulatedContentInfoSigned определяет структуру для вложенных в CMS с подписью данных (здесь один из вариантов cmsEncapsulatedContentInfo).
 type cmsEncapsulatedContentInfoSigned struct {
 	ContentType asn1.ObjectIdentifier
@@ -159,6 +285,11 @@ type tspAccuracy struct {
 	Micros  int `asn1:"optional,tag:1"`
 }
 
+// Duration возвращает точность времени метки в виде time.Duration.
+func (a tspAccuracy) Duration() time.Duration {
+	return time.Duration(a.Seconds)*time.Second + time.Duration(a.Millis)*time.Millisecond + time.Duration(a.Micros)*time.Microsecond
+}
+
 // tspTSTInfo представляет собой собственно метку времени, подписанную TSA.
 //
 //	TSTInfo ::= SEQUENCE  {
@@ -185,3 +316,54 @@ type tspTSTInfo struct {
 	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
 	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
 }
+
+// essSigningCertificate значение атрибута signingCertificate (RFC2634 5.4). Хеш сертификата - SHA-1.
+//
+//	SigningCertificate ::=  SEQUENCE {
+//	  certs        SEQUENCE OF ESSCertID,
+//	  policies     SEQUENCE OF PolicyInformation OPTIONAL }
+//
+//	ESSCertID ::=  SEQUENCE {
+//	  certHash                 Hash,
+//	  issuerSerial             IssuerSerial OPTIONAL }
+type essSigningCertificate struct {
+	Certs    []essCertID
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+type essCertID struct {
+	CertHash     []byte
+	IssuerSerial essIssuerSerial `asn1:"optional"`
+}
+
+// essSigningCertificateV2 значение атрибута signingCertificateV2 (RFC5035 3).
+//
+//	SigningCertificateV2 ::=  SEQUENCE {
+//	  certs        SEQUENCE OF ESSCertIDv2,
+//	  policies     SEQUENCE OF PolicyInformation OPTIONAL }
+//
+//	ESSCertIDv2 ::=  SEQUENCE {
+//	  hashAlgorithm           AlgorithmIdentifier DEFAULT {algorithm id-sha256},
+//	  certHash                 Hash,
+//	  issuerSerial             IssuerSerial OPTIONAL }
+type essSigningCertificateV2 struct {
+	Certs    []essCertIDv2
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+type essCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  essIssuerSerial `asn1:"optional"`
+}
+
+// essIssuerSerial идентифицирует сертификат именем издателя и серийным номером.
+// Если поле отсутствует, то SerialNumber равен nil.
+//
+//	IssuerSerial ::= SEQUENCE {
+//	  issuer                   GeneralNames,
+//	  serialNumber             CertificateSerialNumber }
+type essIssuerSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
 	"errors"
@@ -11,13 +12,27 @@ import (
 
 // значения по умолчанию для "опасных" флагов
 const (
-	defaultTSPNonceSize             = 8    // байт
-	defaultTSPMaxResponseSize int64 = 8192 // байт
-	defaultTSPRetryInterval         = "15m"
+	defaultTSPNonceSize               = 8    // байт
+	defaultTSPMaxResponseSize   int64 = 8192 // байт
+	defaultTSPRetryInterval           = "15m"
+	defaultTSPCertExpiryWarning       = "720h,168h,24h" // 30, 7 и 1 день
+	defaultTSPKind                    = tspKindTimestamp
+)
+
+// Допустимые значения вида проверки (tspConfig.Kind)
+const (
+	tspKindTimestamp     = "timestamp"
+	tspKindBadPolicy     = "badpolicy"
+	tspKindBadDigestSize = "baddigestsize"
+	tspKindBadAlg        = "badalg"
 )
 
 // tspConfig определяет структуру с настройками взаимодействия с TSP сервером.
 type tspConfig struct {
+	// Name содержит имя цели мониторинга. Используется в протоколе и в метках метрик (target).
+	// Должно быть уникальным среди целей TSP. Может быть не указано, если цель одна.
+	Name string `json:"name" yaml:"name"`
+
 	// Disabled флаг позволяет отключить опрос TSP сервера при установке в значение true.
 	Disabled bool `json:"disabled" yaml:"disabled"`
 
@@ -29,6 +44,16 @@ type tspConfig struct {
 	Timeout      string        `json:"timeout" yaml:"timeout"`
 	TimeoutValue time.Duration `json:"-" yaml:"-"`
 
+	// Kind определяет вид проверки:
+	//   - timestamp - запрос метки времени по настройкам, проверяются ее подпись и содержимое;
+	//   - badpolicy - запрос с неподдерживаемой политикой (ReqPolicy), ожидается отказ с unacceptedPolicy;
+	//   - baddigestsize - запрос с хешем, размер которого не соответствует DigestOID, ожидается отказ
+	//     с badDataFormat;
+	//   - badalg - запрос с неизвестным алгоритмом хеширования, ожидается отказ с badAlg.
+	// Выдача метки времени на некорректный запрос считается ошибкой содержимого ответа.
+	// По умолчанию устанавливается в timestamp.
+	Kind string `json:"kind" yaml:"kind"`
+
 	// PolicyOID содержит значение OID алгоритма политики формирования метки времени. Фактически
 	// определяет алгоритм подписи метки времени.
 	// Предполагается, что данный OID будет иметь одно из следующих значений:
@@ -36,6 +61,7 @@ type tspConfig struct {
 	//   - "1.2.398.3.3.2.6.2" - политика для подписи квитанции метки времени на алгоритме RSA-SHA256;
 	//   - "1.2.398.3.3.2.6.3" - политика для подписи квитанции метки времени на алгоритме ГОСТ 34.310-2004 с OID 1.3.6.1.4.1.6801.1.2.2;
 	//   - "1.2.398.3.3.2.6.4" - политика для подписи квитанции метки времени на алгоритме ГОСТ 34.10-2015 (512) с OID 1.2.398.3.10.1.1.2.3.2;
+	// Подпись метки времени проверяется для всех перечисленных алгоритмов (см. signature.go, gostSignature.go).
 	PolicyOID      string                `json:"policyoid" yaml:"policyoid"`
 	PolicyOIDValue asn1.ObjectIdentifier `json:"-" yaml:"-"`
 
@@ -72,11 +98,52 @@ type tspConfig struct {
 	RetryInterval      string        `json:"retryinterval" yaml:"retryinterval"`
 	RetryIntervalValue time.Duration `json:"-" yaml:"-"`
 
+	// MaxClockSkew содержит максимально допустимое расхождение времени метки (TSTInfo.genTime) с локальным
+	// временем (серединой интервала от отправки запроса до получения ответа). К допустимому расхождению
+	// добавляются заявленная TSA точность (TSTInfo.accuracy) и половина времени обработки запроса.
+	// Должно быть значение допустимое для time.ParseDuration(). Пустая строка - без проверки.
+	MaxClockSkew      string        `json:"maxclockskew" yaml:"maxclockskew"`
+	MaxClockSkewValue time.Duration `json:"-" yaml:"-"`
+
+	// CertExpiryWarning содержит пороги (через запятую) до окончания срока действия сертификата подписи TSA.
+	// При прохождении каждого порога и при истечении срока действия в протокол приложения однократно пишется
+	// предупреждение (уровень warn). Пока до окончания срока действия меньше наибольшего порога, предупреждение
+	// также выводится в протокол каждой проверки (поле certWarnings).
+	// Каждый порог должен быть значением допустимым для time.ParseDuration().
+	// По умолчанию устанавливается в 720h,168h,24h (30, 7 и 1 день).
+	// 0 - предупреждения не выводятся (метрика ncatos_cert_not_after_seconds обновляется всегда).
+	CertExpiryWarning       string          `json:"certexpirywarning" yaml:"certexpirywarning"`
+	CertExpiryWarningValues []time.Duration `json:"-" yaml:"-"` // пороги в порядке убывания
+
+	// TrustFile содержит путь к файлу доверенных сертификатов (корневых и промежуточных сертификатов
+	// НУЦ РК) в PEM (один или несколько сертификатов) или в ASN.1 DER (один сертификат), дополняющих
+	// общее хранилище (секция trust). Если доверенные сертификаты есть, то цепочка сертификата подписи
+	// TSA должна строиться до одного из них. Расширенное назначение ключа и атрибут ESS сертификата
+	// подписи TSA проверяются всегда.
+	TrustFile         string              `json:"trustfile" yaml:"trustfile"`
+	TrustCertificates []*x509.Certificate `json:"-" yaml:"-"`
+
 	// MaxResponseSize определяет максимально допустимый размер ответа от сервера TSP в байтах.
 	// Если установлен в 0, то размер не ограничен.
 	MaxResponseSize *int64 `json:"maxresponsesize" yaml:"maxresponsesize"`
 }
 
+// TargetName возвращает имя цели мониторинга.
+func (cfg *tspConfig) TargetName() string {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Name
+}
+
+// SetTargetName устанавливает имя цели мониторинга.
+func (cfg *tspConfig) SetTargetName(name string) {
+	if cfg == nil {
+		return
+	}
+	cfg.Name = name
+}
+
 // SetDefaults позволяет инициализировать не заданные/критичные поля значениями по умолчанию.
 func (cfg *tspConfig) SetDefaults() {
 	if cfg == nil {
@@ -88,6 +155,12 @@ func (cfg *tspConfig) SetDefaults() {
 	if cfg.RetryInterval == "" {
 		cfg.RetryInterval = defaultTSPRetryInterval
 	}
+	if cfg.CertExpiryWarning == "" {
+		cfg.CertExpiryWarning = defaultTSPCertExpiryWarning
+	}
+	if cfg.Kind == "" {
+		cfg.Kind = defaultTSPKind
+	}
 	if cfg.MaxResponseSize == nil {
 		cfg.MaxResponseSize = new(int64)
 	}
@@ -110,6 +183,8 @@ func (cfg *tspConfig) UpdateCommandLine(givenFlags []*flag.Flag) {
 			cfg.URL = *clpTSPURL
 		case "tsp.timeout":
 			cfg.Timeout = *clpTSPTimeout
+		case "tsp.kind":
+			cfg.Kind = *clpTSPKind
 		case "tsp.digestoid":
 			cfg.DigestOID = *clpTSPDigestOID
 		case "tsp.policyoid":
@@ -124,6 +199,12 @@ func (cfg *tspConfig) UpdateCommandLine(givenFlags []*flag.Flag) {
 			cfg.RetryCount = *clpTSPRetryCount
 		case "tsp.retryinterval":
 			cfg.RetryInterval = *clpTSPRetryInterval
+		case "tsp.maxclockskew":
+			cfg.MaxClockSkew = *clpTSPMaxClockSkew
+		case "tsp.certexpirywarning":
+			cfg.CertExpiryWarning = *clpTSPCertExpiryWarning
+		case "tsp.trustfile":
+			cfg.TrustFile = *clpTSPTrustFile
 		case "tsp.maxresponsesize":
 			*cfg.MaxResponseSize = *clpTSPMaxResponseSize
 		}
@@ -152,6 +233,12 @@ func (cfg *tspConfig) Validate() error {
 		}
 	}
 
+	switch cfg.Kind {
+	case tspKindTimestamp, tspKindBadPolicy, tspKindBadDigestSize, tspKindBadAlg:
+	default:
+		return fmt.Errorf("invalid TSP config: unknown kind: [%s]", cfg.Kind)
+	}
+
 	cfg.PolicyOIDValue, err = oidToAsn(cfg.PolicyOID)
 	if err != nil {
 		return fmt.Errorf("invalid TSP config: failed to parse policyoid: [%w]", err)
@@ -178,6 +265,16 @@ func (cfg *tspConfig) Validate() error {
 		return errors.New("invalid TSP config: noncesize")
 	}
 
+	if cfg.MaxClockSkew != "" {
+		cfg.MaxClockSkewValue, err = time.ParseDuration(cfg.MaxClockSkew)
+		if err != nil {
+			return fmt.Errorf("invalid TSP config: failed to parse maxclockskew: [%w]", err)
+		}
+		if cfg.MaxClockSkewValue < 0 {
+			return errors.New("invalid TSP config: maxclockskew")
+		}
+	}
+
 	if cfg.RetryCount < 0 {
 		return errors.New("invalid TSP config: retrycount")
 	}
@@ -189,6 +286,18 @@ func (cfg *tspConfig) Validate() error {
 		}
 	}
 
+	cfg.CertExpiryWarningValues, err = certExpiryParseThresholds(cfg.CertExpiryWarning)
+	if err != nil {
+		return fmt.Errorf("invalid TSP config: failed to parse certexpirywarning: [%w]", err)
+	}
+
+	if cfg.TrustFile != "" {
+		cfg.TrustCertificates, err = loadCertificates(cfg.TrustFile)
+		if err != nil {
+			return fmt.Errorf("invalid TSP config: failed to load trustfile: [%w]", err)
+		}
+	}
+
 	if cfg.MaxResponseSize == nil {
 		return errors.New("invalid TSP config: nil maxresponsesize")
 	}
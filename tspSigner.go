@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+  Проверка сертификата подписи TSA (RFC3161 2.3, 2.4.2): сертификат должен содержать единственное
+  критичное расширенное назначение ключа id-kp-timeStamping, подписываемые атрибуты метки времени -
+  атрибут ESS signingCertificate или signingCertificateV2 с хешем этого сертификата. Если настроены
+  доверенные сертификаты, то строится цепочка сертификата TSA до одного из них (см. certChain.go).
+*/
+
+// Причины ошибок проверки сертификата подписи TSA (метка reason метрики response_error_reasons)
+const (
+	tspSignerReasonEKU         = "tsa_eku"      // нет критичного назначения ключа id-kp-timeStamping
+	tspSignerReasonESSMissing  = "ess_missing"  // нет атрибута signingCertificate/signingCertificateV2
+	tspSignerReasonESSMismatch = "ess_mismatch" // атрибут не соответствует сертификату подписи
+)
+
+// tspSignerValidate проверяет сертификат signer, которым подтверждена подпись signerInfo метки
+// времени signedData: расширенное назначение ключа, атрибут ESS и, если trust не пуст, цепочку
+// сертификатов до доверенного (промежуточные сертификаты берутся из signedData.Certificates).
+//
+// Возвращает построенную цепочку (nil, если trust пуст). Ошибки имеют тип responseErrorSignature
+// и причину tspSignerReason* или certChainReason*.
+func tspSignerValidate(signedData *cmsSignedData, signerInfo *cmsSignerInfo, signer *x509.Certificate, trust []*x509.Certificate) ([]*x509.Certificate, error) {
+	if err := tspSignerCheckEKU(signer); err != nil {
+		return nil, newValidationErrorReason(responseErrorSignature, tspSignerReasonEKU, err)
+	}
+
+	attributes, _, err := cmsSignedAttributes(signerInfo)
+	if err != nil {
+		return nil, newValidationError(responseErrorSignature, err)
+	}
+	if err := tspSignerCheckESS(attributes, signer); err != nil {
+		return nil, err
+	}
+
+	if len(trust) == 0 {
+		return nil, nil
+	}
+	certs, err := cmsCertificates(signedData)
+	if err != nil {
+		return nil, newValidationError(responseErrorSignature, err)
+	}
+	chain, err := certChainBuild(signer, certs, trust, time.Now())
+	if err != nil {
+		return chain, fmt.Errorf("TSA certificate chain: [%w]", err)
+	}
+	return chain, nil
+}
+
+// tspSignerCheckEKU проверяет, что сертификат TSA содержит критичное расширение extKeyUsage
+// с единственным назначением id-kp-timeStamping.
+func tspSignerCheckEKU(signer *x509.Certificate) error {
+	for i := range signer.Extensions {
+		if !signer.Extensions[i].Id.Equal(oidExtensionExtKeyUsage) {
+			continue
+		}
+		if !signer.Extensions[i].Critical {
+			return errors.New("TSA certificate extended key usage extension is not critical")
+		}
+		if len(signer.ExtKeyUsage) != 1 || signer.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping || len(signer.UnknownExtKeyUsage) != 0 {
+			return fmt.Errorf("TSA certificate extended key usage must be the only [%s]", oidExtKeyUsageTimeStamping.String())
+		}
+		return nil
+	}
+	return errors.New("TSA certificate has no extended key usage extension")
+}
+
+// tspSignerCheckESS проверяет, что первый идентификатор сертификата (ESSCertID/ESSCertIDv2) атрибута
+// signingCertificateV2 или, при его отсутствии, signingCertificate соответствует сертификату signer:
+// совпадают хеш сертификата и, если указано поле issuerSerial, имя издателя и серийный номер (RFC5035 5.4).
+func tspSignerCheckESS(attributes []cmsAttribute, signer *x509.Certificate) error {
+	var (
+		digestOID    asn1.ObjectIdentifier
+		certHash     []byte
+		issuerSerial *essIssuerSerial
+	)
+
+	switch {
+	case tspHasAttribute(attributes, oidCmsAttributeSigningCertificateV2):
+		value, err := cmsAttributeValue(attributes, oidCmsAttributeSigningCertificateV2)
+		if err != nil {
+			return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch, err)
+		}
+		var sc essSigningCertificateV2
+		if _, err := asn1.Unmarshal(value.FullBytes, &sc); err != nil {
+			return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch,
+				fmt.Errorf("failed to decode ESS signingCertificateV2 attribute: [%w]", err))
+		}
+		if len(sc.Certs) == 0 {
+			return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch,
+				errors.New("empty ESS signingCertificateV2 attribute"))
+		}
+		digestOID = sc.Certs[0].HashAlgorithm.Algorithm
+		if len(digestOID) == 0 {
+			digestOID = oidDigestSHA256
+		}
+		certHash, issuerSerial = sc.Certs[0].CertHash, &sc.Certs[0].IssuerSerial
+
+	case tspHasAttribute(attributes, oidCmsAttributeSigningCertificate):
+		value, err := cmsAttributeValue(attributes, oidCmsAttributeSigningCertificate)
+		if err != nil {
+			return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch, err)
+		}
+		var sc essSigningCertificate
+		if _, err := asn1.Unmarshal(value.FullBytes, &sc); err != nil {
+			return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch,
+				fmt.Errorf("failed to decode ESS signingCertificate attribute: [%w]", err))
+		}
+		if len(sc.Certs) == 0 {
+			return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch,
+				errors.New("empty ESS signingCertificate attribute"))
+		}
+		digestOID = oidDigestSHA1
+		certHash, issuerSerial = sc.Certs[0].CertHash, &sc.Certs[0].IssuerSerial
+
+	default:
+		return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMissing,
+			errors.New("TSP TimeStampToken has no ESS signingCertificate/signingCertificateV2 attribute"))
+	}
+
+	h, err := newDigest(digestOID)
+	if err != nil {
+		return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch,
+			fmt.Errorf("ESS certificate hash: [%w]", err))
+	}
+	h.Write(signer.Raw)
+	if !bytes.Equal(h.Sum(nil), certHash) {
+		return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch,
+			fmt.Errorf("ESS certificate hash mismatch: [%s]", signer.Subject.String()))
+	}
+	if issuerSerial.SerialNumber == nil {
+		return nil
+	}
+	if issuerSerial.SerialNumber.Cmp(signer.SerialNumber) != 0 {
+		return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch,
+			fmt.Errorf("ESS certificate serial number mismatch: [%s], [%s]", issuerSerial.SerialNumber.Text(16), signer.SerialNumber.Text(16)))
+	}
+	if err := tspSignerCheckESSIssuer(&issuerSerial.Issuer, signer); err != nil {
+		return newValidationErrorReason(responseErrorSignature, tspSignerReasonESSMismatch, err)
+	}
+	return nil
+}
+
+// tspSignerCheckESSIssuer проверяет, что поле issuer (GeneralNames) идентификатора сертификата ESS
+// содержит только имя издателя сертификата signer в варианте directoryName (RFC5035 5.4).
+//
+//	GeneralName ::= CHOICE {
+//	  ...
+//	  directoryName   [4] Name,
+//	  ... }
+func tspSignerCheckESSIssuer(issuer *asn1.RawValue, signer *x509.Certificate) error {
+	var names []asn1.RawValue
+	if _, err := asn1.Unmarshal(issuer.FullBytes, &names); err != nil {
+		return fmt.Errorf("failed to decode ESS certificate issuer: [%w]", err)
+	}
+	if len(names) != 1 || names[0].Class != asn1.ClassContextSpecific || names[0].Tag != 4 {
+		return errors.New("ESS certificate issuer must be the only directoryName")
+	}
+	// Name является CHOICE, поэтому тег directoryName явный: содержимое - DER кодировка имени
+	if !bytes.Equal(names[0].Bytes, signer.RawIssuer) {
+		return fmt.Errorf("ESS certificate issuer mismatch: [%s]", signer.Issuer.String())
+	}
+	return nil
+}
+
+// tspHasAttribute проверяет наличие атрибута с указанным OID.
+func tspHasAttribute(attributes []cmsAttribute, oid asn1.ObjectIdentifier) bool {
+	for i := range attributes {
+		if attributes[i].Type.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+// testESSIssuer кодирует имена rawNames (DER кодировки Name) в GeneralNames из вариантов directoryName.
+func testESSIssuer(t *testing.T, rawNames ...[]byte) asn1.RawValue {
+	t.Helper()
+	var names []byte
+	for _, rawName := range rawNames {
+		name, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: rawName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name...)
+	}
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: names}
+}
+
+func TestTSPSignerCheckESS(t *testing.T) {
+	signer, _ := testCA(t, "test TSA")
+	other, _ := testCA(t, "other CA")
+	certHash := sha256.Sum256(signer.Raw)
+
+	tests := []struct {
+		name         string
+		certHash     []byte
+		issuerSerial essIssuerSerial
+		wantErr      bool
+	}{
+		{name: "no issuerSerial", certHash: certHash[:]},
+		{name: "issuerSerial", certHash: certHash[:], issuerSerial: essIssuerSerial{testESSIssuer(t, signer.RawIssuer), signer.SerialNumber}},
+		{name: "hash mismatch", certHash: make([]byte, len(certHash)), wantErr: true},
+		{name: "serial mismatch", certHash: certHash[:], issuerSerial: essIssuerSerial{testESSIssuer(t, signer.RawIssuer), big.NewInt(2)}, wantErr: true},
+		{name: "issuer mismatch", certHash: certHash[:], issuerSerial: essIssuerSerial{testESSIssuer(t, other.RawSubject), signer.SerialNumber}, wantErr: true},
+		{name: "several issuer names", certHash: certHash[:], issuerSerial: essIssuerSerial{testESSIssuer(t, signer.RawIssuer, other.RawSubject), signer.SerialNumber}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := asn1.Marshal(essSigningCertificateV2{Certs: []essCertIDv2{{
+				HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256},
+				CertHash:      tt.certHash,
+				IssuerSerial:  tt.issuerSerial,
+			}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			attributes := []cmsAttribute{{Type: oidCmsAttributeSigningCertificateV2, Values: []asn1.RawValue{{FullBytes: value}}}}
+
+			err = tspSignerCheckESS(attributes, signer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tspSignerCheckESS() = %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && validationErrorReason(err) != tspSignerReasonESSMismatch {
+				t.Errorf("reason = %q, want %q", validationErrorReason(err), tspSignerReasonESSMismatch)
+			}
+		})
+	}
+}